@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const createAdminUsage = "usage: munit create-admin <email>"
+
+// createAdmin grants admin to the user with email. If there is no such user,
+// one is created with password read from stdin.
+func createAdmin(ctx context.Context, args []string, stdin io.Reader) error {
+	if len(args) != 1 {
+		return errors.New(createAdminUsage)
+	}
+	email := args[0]
+	now := time.Now().Truncate(time.Second)
+
+	u, err := model.GetUserByEmail(ctx, email)
+	if err == nil {
+		_, err = model.UpdateUser(ctx, u.ID, func(u *model.User) error {
+			u.Admin = true
+			u.Disabled = false
+			u.Modified = now
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.WithField("user", u.ID).Info("admin granted")
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	fmt.Print("Password: ")
+	passwd, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	passwd = strings.TrimRight(passwd, "\r\n")
+
+	u = &model.User{
+		Email:    email,
+		Verified: true,
+		Admin:    true,
+		Password: passwd,
+		Created:  now,
+		Modified: now,
+	}
+	u.ID, err = id.New()
+	if err != nil {
+		return err
+	}
+	u.PasswdHash, err = auth.HashPasswd([]byte(passwd))
+	if err != nil {
+		return err
+	}
+	if err = model.InsertUser(ctx, u); err != nil {
+		return err
+	}
+	log.WithField("user", u.ID).Info("admin created")
+	return nil
+}
@@ -3,15 +3,20 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/apex/log"
 	"github.com/sewiti/munit-backend/internal/auth"
 	"github.com/sewiti/munit-backend/internal/config"
+	"github.com/sewiti/munit-backend/internal/job"
+	"github.com/sewiti/munit-backend/internal/mail"
 	"github.com/sewiti/munit-backend/internal/model"
 	"github.com/sewiti/munit-backend/internal/web"
+	"github.com/sewiti/munit-backend/pkg/transcode"
 	"github.com/vrischmann/envconfig"
 )
 
@@ -30,6 +35,46 @@ func main() {
 		log.WithError(err).Fatal("unable to setup secret")
 		return
 	}
+	err := auth.SetArgon2Params(auth.Argon2Params{
+		Time:    cfg.Munit.Argon2.Time,
+		Memory:  cfg.Munit.Argon2.Memory,
+		Threads: cfg.Munit.Argon2.Threads,
+		KeyLen:  auth.DefaultArgon2Params.KeyLen,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("invalid argon2 parameters")
+		return
+	}
+
+	if _, ok := transcode.Lookup(cfg.Munit.Preview.Format); !ok {
+		log.WithField("formats", transcode.Formats()).Fatalf("no encoder for preview format %s", cfg.Munit.Preview.Format)
+		return
+	}
+	if rate := cfg.Munit.Preview.SampleRate; rate < 8000 || rate > transcode.MaxSampleRate {
+		log.Fatalf("preview sample rate must be between 8000 and %d", transcode.MaxSampleRate)
+		return
+	}
+	if cfg.Munit.Jobs.Workers <= 0 || cfg.Munit.Jobs.Queue <= 0 {
+		log.Fatal("job workers and queue size must be positive")
+		return
+	}
+
+	switch {
+	case cfg.Munit.Mail.SMTPAddr != "":
+		mail.Use(&mail.SMTPMailer{
+			Addr:     cfg.Munit.Mail.SMTPAddr,
+			From:     cfg.Munit.Mail.From,
+			Username: cfg.Munit.Mail.SMTPUsername,
+			Password: cfg.Munit.Mail.SMTPPassword,
+		})
+	case cfg.Munit.Mail.Dir != "":
+		mail.Use(&mail.FileMailer{
+			Dir:  cfg.Munit.Mail.Dir,
+			From: cfg.Munit.Mail.From,
+		})
+	default:
+		log.Warn("smtp is not configured, mail will be logged")
+	}
 
 	if err := model.OpenDB(cfg.Munit.DSN); err != nil {
 		log.WithError(err).Fatal("unable to open database")
@@ -37,6 +82,23 @@ func main() {
 	}
 	defer model.CloseDB()
 
+	// Commands
+	if len(os.Args) > 1 {
+		var err error
+		switch cmd := os.Args[1]; cmd {
+		case "create-admin":
+			err = createAdmin(context.Background(), os.Args[2:], os.Stdin)
+		default:
+			err = fmt.Errorf("unknown command: %s", cmd)
+		}
+		if err != nil {
+			log.WithError(err).Fatal("command failed")
+		}
+		return
+	}
+
+	job.Start(cfg.Munit.Jobs.Workers, cfg.Munit.Jobs.Queue)
+
 	// Create server
 	srv := &http.Server{
 		Addr:         cfg.Munit.Addr,
@@ -67,4 +129,5 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.WithError(err).Error("server shutdown")
 	}
+	job.Stop(ctx)
 }
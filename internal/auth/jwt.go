@@ -20,24 +20,58 @@ var secretKey ed25519.PrivateKey
 
 var ErrExpiredToken = errors.New("expired token")
 
+// challengeAudience marks tokens that only prove the first login step
+// (password) and cannot be used for authentication.
+const challengeAudience = "2fa"
+
 func MakeJWT(subject string) (string, error) {
+	return makeJWT(subject, "", tokenExpiry)
+}
+
+func VerifyJWT(token string) (subject string, err error) {
+	return verifyJWT(token, "", tokenExpiry)
+}
+
+// MakeChallengeJWT makes a short lived token, that is exchanged for a real one
+// after completing the second authentication factor.
+func MakeChallengeJWT(subject string) (string, error) {
+	return makeJWT(subject, challengeAudience, challengeExpiry)
+}
+
+func VerifyChallengeJWT(token string) (subject string, err error) {
+	return verifyJWT(token, challengeAudience, challengeExpiry)
+}
+
+func makeJWT(subject, audience string, expiry time.Duration) (string, error) {
 	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(now.Add(tokenExpiry)),
+	claims := jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
 		IssuedAt:  jwt.NewNumericDate(now),
 		Issuer:    hostname,
 		Subject:   subject,
-	})
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
 	return token.SignedString(secretKey)
 }
 
-func VerifyJWT(token string) (subject string, err error) {
+func verifyJWT(token, audience string, expiry time.Duration) (subject string, err error) {
 	var claims jwt.RegisteredClaims
 	_, err = jwt.ParseWithClaims(token, &claims, jwtKeyFunc)
 	if err != nil {
 		return "", err
 	}
 
+	if audience == "" {
+		if len(claims.Audience) != 0 {
+			return "", errors.New("unexpected token audience")
+		}
+	} else if !claims.VerifyAudience(audience, true) {
+		return "", errors.New("invalid token audience")
+	}
+
 	now := time.Now()
 	if claims.ExpiresAt != nil {
 		if claims.ExpiresAt.Time.Before(now) {
@@ -46,7 +80,7 @@ func VerifyJWT(token string) (subject string, err error) {
 		return claims.Subject, nil
 	}
 	if claims.IssuedAt != nil {
-		if claims.IssuedAt.Add(tokenExpiry).Before(now) {
+		if claims.IssuedAt.Add(expiry).Before(now) {
 			return "", ErrExpiredToken
 		}
 		return claims.Subject, nil
@@ -1,33 +1,145 @@
 package auth
 
 import (
-	"bytes"
-	crand "crypto/rand"
-	"io"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/argon2"
 )
 
 const (
-	argonTime    = 1
-	argonMemory  = 64 * 1024 // 64MiB
-	argonThreads = 4
-	argonKeyLen  = 32
+	tokenExpiry     = 7 * 24 * time.Hour // 7d
+	challengeExpiry = 5 * time.Minute
 
-	tokenExpiry = 7 * 24 * time.Hour // 7d
+	saltLen = 16
+
+	// Parameters of hashes made before the PHC format, which stored raw hash
+	// and salt separately.
+	legacyTime    = 1
+	legacyMemory  = 64 * 1024 // 64MiB
+	legacyThreads = 4
+	legacyKeyLen  = 32
 )
 
-func MakeSalt(rand io.Reader) ([]byte, error) {
-	salt := make([]byte, argonKeyLen)
-	_, err := crand.Read(salt)
-	return salt, err
+// Argon2Params are Argon2id parameters, recorded in each encoded hash.
+type Argon2Params struct {
+	Time    uint32 // Iterations
+	Memory  uint32 // KiB
+	Threads uint8
+	KeyLen  uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Time:    1,
+	Memory:  64 * 1024, // 64MiB
+	Threads: 4,
+	KeyLen:  32,
+}
+
+var params = DefaultArgon2Params
+
+// NoPasswd is a password hash no password matches, used for accounts that
+// sign in through an external identity provider only.
+const NoPasswd = "!"
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// SetArgon2Params sets parameters for new hashes. Existing hashes made with
+// weaker parameters are upgraded on next login.
+func SetArgon2Params(p Argon2Params) error {
+	if p.Time < 1 {
+		return errors.New("argon2: time must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return errors.New("argon2: memory must be at least 8*threads KiB")
+	}
+	if p.Threads < 1 {
+		return errors.New("argon2: threads must be at least 1")
+	}
+	if p.KeyLen < 16 {
+		return errors.New("argon2: key length must be at least 16")
+	}
+	params = p
+	return nil
 }
 
-func HashPasswd(password, salt []byte) []byte {
-	return argon2.IDKey(password, salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+// weakerThan reports whether any of p is weaker than other.
+func (p Argon2Params) weakerThan(other Argon2Params) bool {
+	return p.Time < other.Time ||
+		p.Memory < other.Memory ||
+		p.Threads < other.Threads ||
+		p.KeyLen < other.KeyLen
 }
 
-func VerifyPasswd(passwdHash, password, salt []byte) bool {
-	return bytes.Equal(passwdHash, HashPasswd(password, salt))
+// HashPasswd hashes password with Argon2id and encodes it in PHC string format:
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+func HashPasswd(password []byte) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := params
+	hash := argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// VerifyPasswd checks password against the encoded hash. Hashes predating the
+// PHC format are the raw hash, stored along with a non-empty legacySalt.
+//
+// If rehash is true, the hash was made with weaker parameters than the current
+// ones and should be replaced with HashPasswd.
+func VerifyPasswd(encoded string, password, legacySalt []byte) (ok, rehash bool) {
+	if len(legacySalt) > 0 {
+		hash := argon2.IDKey(password, legacySalt, legacyTime, legacyMemory, legacyThreads, legacyKeyLen)
+		return subtle.ConstantTimeCompare([]byte(encoded), hash) == 1, true
+	}
+
+	p, salt, hash, err := decodeHash(encoded)
+	if err != nil {
+		return false, false
+	}
+	other := argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	if subtle.ConstantTimeCompare(hash, other) != 1 {
+		return false, false
+	}
+	return true, p.weakerThan(params)
+}
+
+func decodeHash(encoded string) (p Argon2Params, salt, hash []byte, err error) {
+	// "", "argon2id", "v=19", "m=65536,t=1,p=4", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	hash, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	p.KeyLen = uint32(len(hash))
+	return p, salt, hash, nil
 }
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const tokenLen = 32
+
+// MakeToken returns a random URL safe token, suitable for links sent to users.
+func MakeToken() (string, error) {
+	b := make([]byte, tokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns a hex encoded SHA-256 hash of token, for storing tokens
+// that grant access on their own.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MakeRecoveryCode returns a random human friendly code, formatted as
+// xxxxx-xxxxx.
+func MakeRecoveryCode() (string, error) {
+	const symbols = "abcdefghijkmnpqrstuvwxyz23456789" // no 0, 1, l, o
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = symbols[int(b[i])%len(symbols)] // len(symbols) divides 256
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
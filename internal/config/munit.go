@@ -5,8 +5,57 @@ import "time"
 type Munit struct {
 	Addr          string        `envconfig:"default=:7878"`
 	AllowedOrigin string        `envconfig:"default=munit.digital"`
+	AppURL        string        `envconfig:"default=https://munit.digital"` // Frontend URL, used in links sent to users
 	Debug         bool          `envconfig:"default=false"`
 	DSN           string        // Data source name
 	SecretFile    string        `envconfig:"default=.secret"`
 	Timeout       time.Duration `envconfig:"default=30s"`
+	TrustProxy    bool          `envconfig:"default=false"` // Take client IP from X-Forwarded-For
+
+	RequireVerified bool `envconfig:"default=false"` // Restrict unverified accounts to their profile
+
+	Argon2  Argon2
+	Jobs    Jobs
+	Mail    Mail
+	OIDC    OIDC
+	Preview Preview
+}
+
+// Jobs configures background jobs, such as waveform generation.
+type Jobs struct {
+	Workers int `envconfig:"default=2"`
+	Queue   int `envconfig:"default=1024"` // Max queued jobs
+}
+
+// Preview configures preview renditions of audio files, which are generated
+// in background. Previews are regenerated on demand after changes.
+type Preview struct {
+	Format     string `envconfig:"default=wav"`   // Registered encoder, see transcode.Register
+	SampleRate int    `envconfig:"default=22050"` // Max, higher rates are downsampled
+}
+
+// OIDC configures OpenID Connect login. Disabled if Issuer is empty.
+type OIDC struct {
+	Issuer       string `envconfig:"optional"`
+	ClientID     string `envconfig:"optional"`
+	ClientSecret string `envconfig:"optional"`
+	RedirectURL  string `envconfig:"optional"` // This server's /oidc/callback URL
+}
+
+// Argon2 configures password hashing. Existing hashes are upgraded on login
+// when parameters are raised.
+type Argon2 struct {
+	Time    uint32 `envconfig:"default=1"`
+	Memory  uint32 `envconfig:"default=65536"` // KiB
+	Threads uint8  `envconfig:"default=4"`
+}
+
+// Mail configures outgoing mail. If SMTPAddr is empty, messages are written to
+// Dir, or logged if Dir is empty too.
+type Mail struct {
+	From         string `envconfig:"default=noreply@munit.digital"`
+	SMTPAddr     string `envconfig:"optional"` // host:port
+	SMTPUsername string `envconfig:"optional"`
+	SMTPPassword string `envconfig:"optional"`
+	Dir          string `envconfig:"optional"`
 }
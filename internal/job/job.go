@@ -0,0 +1,112 @@
+// Package job runs background jobs on a fixed pool of workers.
+//
+// Queued jobs are kept in memory only and are lost on shutdown, so a job must
+// be safe to enqueue again on demand, e.g. when its result is found missing.
+package job
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+type task struct {
+	key string
+	fn  func(ctx context.Context) error
+}
+
+var (
+	mu      sync.Mutex
+	queue   chan task
+	pending = make(map[string]bool) // Keys of queued and running jobs
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+)
+
+// Start starts workers, which run jobs from a queue of given size.
+func Start(workers, size int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	queue = make(chan task, size)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go work(ctx, queue)
+	}
+	log.Infof("started %d job workers", workers)
+}
+
+// Stop cancels running jobs, drops queued ones and waits for workers to exit
+// or ctx to be done.
+func Stop(ctx context.Context) {
+	mu.Lock()
+	if queue == nil {
+		mu.Unlock()
+		return
+	}
+	cancel()
+	close(queue)
+	queue = nil
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Enqueue queues fn to run in background. Jobs with the same key are run once
+// at a time: fn is not queued if a job with the key is already queued or
+// running. Returns false if fn was not queued, because of that, a full queue
+// or workers not being started.
+func Enqueue(key string, fn func(ctx context.Context) error) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if queue == nil || pending[key] {
+		return false
+	}
+	select {
+	case queue <- task{key, fn}:
+		pending[key] = true
+		return true
+	default:
+		log.WithField("job", key).Warn("job queue is full")
+		return false
+	}
+}
+
+func work(ctx context.Context, queue <-chan task) {
+	defer wg.Done()
+	for t := range queue {
+		run(ctx, t)
+	}
+}
+
+// run runs the task, recovering from its panic, so that neither the worker
+// nor the key is lost.
+func run(ctx context.Context, t task) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.WithField("job", t.key).WithField("panic", v).Errorf("job panicked:\n%s", debug.Stack())
+		}
+		mu.Lock()
+		delete(pending, t.key)
+		mu.Unlock()
+	}()
+	if ctx.Err() != nil {
+		return
+	}
+	if err := t.fn(ctx); err != nil {
+		log.WithError(err).WithField("job", t.key).Error("job failed")
+	}
+}
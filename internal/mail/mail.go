@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a plain text email message.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var mailer Mailer = LogMailer{}
+
+// Use sets the Mailer used by Send. LogMailer is used by default.
+func Use(m Mailer) {
+	mailer = m
+}
+
+// Send sends msg using the configured Mailer.
+func Send(ctx context.Context, msg *Message) error {
+	if msg.To == "" {
+		return errors.New("mail: recipient is empty")
+	}
+	return mailer.Send(ctx, msg)
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// LogMailer logs messages instead of sending them. Useful for local
+// development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.WithFields(log.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info(msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to a separate file in Dir instead of sending
+// it. Useful for local development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	file := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(file, compose(m.From, msg), 0600); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"to":   msg.To,
+		"file": file,
+	}).Debug("mail written")
+	return nil
+}
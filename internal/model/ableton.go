@@ -0,0 +1,81 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"path"
+	"strings"
+
+	"github.com/sewiti/munit-backend/pkg/ableton"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// IsAbletonSet reports whether file looks like an Ableton Live set, which is
+// then parsed in background.
+func IsAbletonSet(f *File) bool {
+	return isAbletonPath(f.Path) && ableton.IsSet(f.Data)
+}
+
+func isAbletonPath(p string) bool {
+	return strings.EqualFold(path.Ext(p), ".als")
+}
+
+// SetAbleton stores the parsed set for all not yet parsed sets with the blob's
+// contents.
+func SetAbleton(ctx context.Context, hash string, s *ableton.Set) error {
+	c, err := newAbletonColumn(s)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		"UPDATE file SET ableton=? WHERE blob_hash=? AND ableton IS NULL AND LOWER(path) LIKE '%.als'",
+		sql.NullString(c), hash)
+	return err
+}
+
+func newAbletonColumn(s *ableton.Set) (jsonColumn, error) {
+	return newJSONColumn(s, s == nil)
+}
+
+func (c *jsonColumn) ableton() *ableton.Set {
+	s := new(ableton.Set)
+	if !c.decode(s) {
+		return nil
+	}
+	return s
+}
+
+// flagMissingSamples flags samples of file's Ableton Live set, which are
+// missing from paths of the commit's file tree.
+func flagMissingSamples(f *File, paths map[string]bool) {
+	if f.Ableton != nil {
+		f.Ableton.FlagMissing(path.Dir(f.Path), func(p string) bool { return paths[p] })
+	}
+}
+
+// selectPaths returns paths of the commit's files.
+func selectPaths(ctx context.Context, q querier, pid, cid id.ID) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, "SELECT path FROM file WHERE project_id=? AND commit_id=?", pid, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		paths[p] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"strings"
+)
+
+// Stats are instance wide statistics.
+type Stats struct {
+	Users         int64 `json:"users"`
+	DisabledUsers int64 `json:"disabledUsers"`
+	Projects      int64 `json:"projects"`
+	Commits       int64 `json:"commits"`
+	Files         int64 `json:"files"`
+	FileBytes     int64 `json:"fileBytes"` // Stored, files sharing contents count once
+}
+
+// likePattern escapes s for use in a LIKE pattern matching any string
+// containing s.
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+// SearchUsers returns users whose display name or email contains query. All
+// users are returned if query is empty.
+func SearchUsers(ctx context.Context, query string, limit, offset int) ([]User, error) {
+	rows, err := db.QueryContext(ctx,
+		userSelect+" WHERE display_name LIKE ? OR email LIKE ? ORDER BY created DESC LIMIT ? OFFSET ?",
+		likePattern(query), likePattern(query), limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanUsers(rows)
+}
+
+// SearchProjects returns projects whose name contains query. All projects are
+// returned if query is empty.
+func SearchProjects(ctx context.Context, query string, limit, offset int) ([]Project, error) {
+	// Derived table, as MySQL does not support LIMIT in IN subqueries.
+	rows, err := db.QueryContext(ctx,
+		projectSelect+" WHERE p.id IN (SELECT id FROM (SELECT id FROM project WHERE name LIKE ? ORDER BY id LIMIT ? OFFSET ?) t) ORDER BY p.id",
+		likePattern(query), limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanProjects(rows)
+}
+
+func GetStats(ctx context.Context) (*Stats, error) {
+	s := new(Stats)
+	err := db.QueryRowContext(ctx,
+		"SELECT "+
+			"(SELECT COUNT(*) FROM user), "+
+			"(SELECT COUNT(*) FROM user WHERE disabled), "+
+			"(SELECT COUNT(*) FROM project), "+
+			"(SELECT COUNT(*) FROM commit), "+
+			"(SELECT COUNT(*) FROM file), "+
+			"(SELECT COALESCE(SUM(LENGTH(data)), 0) FROM `blob`)",
+	).Scan(
+		&s.Users,
+		&s.DisabledUsers,
+		&s.Projects,
+		&s.Commits,
+		&s.Files,
+		&s.FileBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
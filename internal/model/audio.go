@@ -0,0 +1,75 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/audio"
+)
+
+// Audio is technical metadata of an audio file.
+type Audio struct {
+	Format     string  `json:"format"` // wav, aiff, flac or mp3
+	Codec      string  `json:"codec"`
+	SampleRate int     `json:"sampleRate"`
+	BitDepth   int     `json:"bitDepth"` // 0 for lossy codecs
+	Channels   int     `json:"channels"`
+	Duration   float64 `json:"duration"` // Seconds
+}
+
+// parseAudio reads audio metadata from file's data. Returns nil if data is
+// not in a supported audio format or its headers are malformed, as metadata
+// is informational and must not prevent the upload.
+func parseAudio(data []byte) *Audio {
+	info, err := audio.Parse(data)
+	if err != nil {
+		return nil
+	}
+	return &Audio{
+		Format:     info.Format,
+		Codec:      info.Codec,
+		SampleRate: info.SampleRate,
+		BitDepth:   info.BitDepth,
+		Channels:   info.Channels,
+		Duration:   info.Duration.Seconds(),
+	}
+}
+
+// audioColumns are file's nullable audio columns, all NULL if file is not
+// audio.
+type audioColumns struct {
+	format     sql.NullString
+	codec      sql.NullString
+	sampleRate sql.NullInt64
+	bitDepth   sql.NullInt64
+	channels   sql.NullInt64
+	duration   sql.NullInt64 // Milliseconds
+}
+
+func newAudioColumns(a *Audio) audioColumns {
+	if a == nil {
+		return audioColumns{}
+	}
+	return audioColumns{
+		format:     sql.NullString{String: a.Format, Valid: true},
+		codec:      sql.NullString{String: a.Codec, Valid: true},
+		sampleRate: sql.NullInt64{Int64: int64(a.SampleRate), Valid: true},
+		bitDepth:   sql.NullInt64{Int64: int64(a.BitDepth), Valid: true},
+		channels:   sql.NullInt64{Int64: int64(a.Channels), Valid: true},
+		duration:   sql.NullInt64{Int64: int64(a.Duration * 1000), Valid: true},
+	}
+}
+
+func (c *audioColumns) audio() *Audio {
+	if !c.format.Valid {
+		return nil
+	}
+	return &Audio{
+		Format:     c.format.String,
+		Codec:      c.codec.String,
+		SampleRate: int(c.sampleRate.Int64),
+		BitDepth:   int(c.bitDepth.Int64),
+		Channels:   int(c.channels.Int64),
+		Duration:   (time.Duration(c.duration.Int64) * time.Millisecond).Seconds(),
+	}
+}
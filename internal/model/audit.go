@@ -0,0 +1,119 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	auditSelect = "SELECT id, action, subject, ip, detail, created FROM audit_log"
+	auditInsert = "INSERT INTO audit_log (id, action, subject, ip, detail, created) VALUES (?,?,?,?,?,?)"
+)
+
+// AuditAction identifies a security relevant event.
+type AuditAction string
+
+const (
+	AuditLoginLockout  AuditAction = "login.lockout"
+	AuditUserDisable   AuditAction = "user.disable"
+	AuditUserEnable    AuditAction = "user.enable"
+	AuditAdminGrant    AuditAction = "admin.grant"
+	AuditAdminRevoke   AuditAction = "admin.revoke"
+	AuditOwnerReassign AuditAction = "project.owner"
+)
+
+type AuditEntry struct {
+	ID      id.ID       `json:"id"`
+	Action  AuditAction `json:"action"`
+	Subject string      `json:"subject"` // User ID, email or other affected entity
+	IP      string      `json:"ip"`
+	Detail  string      `json:"detail"`
+	Created time.Time   `json:"created"`
+}
+
+func (e *AuditEntry) scan(sc scanner) (*AuditEntry, error) {
+	return e, sc.Scan(
+		&e.ID,
+		&e.Action,
+		&e.Subject,
+		&e.IP,
+		&e.Detail,
+		&e.Created,
+	)
+}
+
+func (e *AuditEntry) validate() error {
+	const (
+		maxSubject = 128
+		maxDetail  = 1024
+	)
+	if err := e.ID.Validate(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if e.Action == "" {
+		return errors.New("audit: action is empty")
+	}
+	if len(e.Subject) > maxSubject {
+		return fmt.Errorf("audit: subject is too long, max %d", maxSubject)
+	}
+	if len(e.Detail) > maxDetail {
+		return fmt.Errorf("audit: detail is too long, max %d", maxDetail)
+	}
+	return nil
+}
+
+// InsertAudit records an audit entry. ID and Created are set if empty.
+func InsertAudit(ctx context.Context, e *AuditEntry) error {
+	var err error
+	if e.ID == "" {
+		if e.ID, err = id.New(); err != nil {
+			return err
+		}
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now().Truncate(time.Second)
+	}
+	if err = e.validate(); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, auditInsert,
+		e.ID,
+		e.Action,
+		e.Subject,
+		e.IP,
+		e.Detail,
+		e.Created,
+	)
+	return err
+}
+
+// GetAuditLog returns audit entries, newest first.
+func GetAuditLog(ctx context.Context, limit, offset int) ([]AuditEntry, error) {
+	rows, err := db.QueryContext(ctx, auditSelect+" ORDER BY created DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		e, err := new(AuditEntry).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
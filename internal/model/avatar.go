@@ -0,0 +1,67 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// Avatar is a single thumbnail of user's avatar. All thumbnails of one upload
+// share the same key, so that they can be cached indefinitely.
+type Avatar struct {
+	User id.ID
+	Key  string
+	Size int
+	Data []byte
+}
+
+func GetAvatar(ctx context.Context, key string, size int) (*Avatar, error) {
+	a := new(Avatar)
+	err := db.QueryRowContext(ctx,
+		"SELECT user_id, avatar_key, size, data FROM avatar WHERE avatar_key=? AND size=?", key, size,
+	).Scan(&a.User, &a.Key, &a.Size, &a.Data)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetAvatar replaces user's avatar with thumbnails, which must share the same
+// key.
+func SetAvatar(ctx context.Context, uid id.ID, thumbs []Avatar) (*User, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM avatar WHERE user_id=?", uid)
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	for _, a := range thumbs {
+		key = a.Key
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO avatar (user_id, avatar_key, size, data) VALUES (?,?,?,?)",
+			uid, a.Key, a.Size, a.Data,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE user SET avatar=?, modified=? WHERE id=?",
+		key, time.Now().Truncate(time.Second), uid)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, uid)
+}
+
+func DeleteAvatar(ctx context.Context, uid id.ID) (*User, error) {
+	return SetAvatar(ctx, uid, nil)
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+)
+
+// Blobs store file contents addressed by their SHA-256 hash, so that identical
+// contents, e.g. of forked projects, are stored once. Blobs are deleted once no
+// file refers to them.
+
+func blobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// insertBlob stores data, unless it is already stored, and returns its hash.
+func insertBlob(ctx context.Context, ex execer, data []byte) (string, error) {
+	hash := blobHash(data)
+	_, err := ex.ExecContext(ctx,
+		"INSERT INTO `blob` (hash, data) VALUES (?,?) ON DUPLICATE KEY UPDATE hash=hash",
+		hash, data,
+	)
+	return hash, err
+}
+
+// selectBlobs returns distinct hashes of files matching the condition.
+func selectBlobs(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT blob_hash FROM file WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0)
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// deleteUnusedBlobs deletes given blobs no file refers to anymore, along with
+// data derived from them.
+func deleteUnusedBlobs(ctx context.Context, ex execer, hashes ...string) error {
+	for _, hash := range hashes {
+		_, err := ex.ExecContext(ctx,
+			"DELETE FROM `blob` WHERE hash=? AND NOT EXISTS (SELECT 1 FROM file WHERE blob_hash=?)",
+			hash, hash,
+		)
+		if err != nil {
+			return err
+		}
+		for _, table := range []string{"peaks", "loudness", "preview"} {
+			_, err = ex.ExecContext(ctx,
+				"DELETE FROM "+table+" WHERE blob_hash=? AND NOT EXISTS (SELECT 1 FROM `blob` WHERE hash=?)",
+				hash, hash,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetBlob returns blob's data.
+func GetBlob(ctx context.Context, hash string) ([]byte, error) {
+	var data []byte
+	err := db.QueryRowContext(ctx, "SELECT data FROM `blob` WHERE hash=?", hash).Scan(&data)
+	return data, err
+}
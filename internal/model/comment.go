@@ -0,0 +1,289 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	commentSelect   = "SELECT m.id, m.body, m.start_time, m.end_time, m.parent_id, m.resolved, m.resolved_by, m.resolved_at, m.created, m.modified, m.project_id, m.commit_id, m.file_id, m.path, m.author_id FROM comment m"
+	commentSelectID = commentSelect + " WHERE m.project_id=? AND m.id=?"
+
+	// commentCarried is a condition on comment m, matching comments made in
+	// commits created up to the commit. Arguments are project, project and
+	// commit.
+	commentCarried = " JOIN commit c ON c.project_id=m.project_id AND c.id=m.commit_id" +
+		" WHERE m.project_id=? AND c.created<=(SELECT created FROM commit WHERE project_id=? AND id=?)"
+
+	commentInsert = "INSERT INTO comment (id, body, start_time, end_time, parent_id, resolved, resolved_by, resolved_at, created, modified, project_id, commit_id, file_id, path, author_id) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	commentUpdate = "UPDATE comment SET body=?, start_time=?, end_time=?, resolved=?, resolved_by=?, resolved_at=?, modified=? WHERE project_id=? AND id=?"
+)
+
+// Comment is a comment on a file at a time position or range, or a reply to
+// one. Comments are carried forward to files at the same path in later
+// commits.
+type Comment struct {
+	ID         id.ID      `json:"id"`
+	Body       string     `json:"body"`
+	Start      float64    `json:"start"`              // Seconds, 0 for replies
+	End        *float64   `json:"end"`                // Seconds, nil if at a position or a reply
+	Parent     id.ID      `json:"parentID,omitempty"` // Comment replied to, empty for threads
+	Resolved   bool       `json:"resolved"`           // Only threads are resolved
+	ResolvedBy id.ID      `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	Created    time.Time  `json:"created"`
+	Modified   time.Time  `json:"modified"`
+
+	Project id.ID  `json:"projectID"`
+	Commit  id.ID  `json:"commitID"` // Commit commented on, replies share it with their thread
+	File    id.ID  `json:"fileID"`
+	Path    string `json:"path"` // File's path
+	Author  id.ID  `json:"authorID"`
+
+	CarriedForward bool      `json:"carriedForward"` // Whether made in an earlier commit than listed
+	Replies        []Comment `json:"replies,omitempty"`
+}
+
+func (m *Comment) scan(sc scanner) (*Comment, error) {
+	var (
+		end        sql.NullFloat64
+		resolvedAt sql.NullTime
+	)
+	err := sc.Scan(
+		&m.ID,
+		&m.Body,
+		&m.Start,
+		&end,
+		&m.Parent,
+		&m.Resolved,
+		&m.ResolvedBy,
+		&resolvedAt,
+		&m.Created,
+		&m.Modified,
+		&m.Project,
+		&m.Commit,
+		&m.File,
+		&m.Path,
+		&m.Author,
+	)
+	if err != nil {
+		return m, err
+	}
+	m.End = nil
+	if end.Valid {
+		m.End = &end.Float64
+	}
+	m.ResolvedAt = nil
+	if resolvedAt.Valid {
+		m.ResolvedAt = &resolvedAt.Time
+	}
+	return m, nil
+}
+
+func (m *Comment) validate() error {
+	const (
+		maxBody = 4096
+	)
+	if err := m.ID.Validate(); err != nil {
+		return fmt.Errorf("comment: %w", err)
+	}
+	if m.Body == "" {
+		return errors.New("comment: body is empty")
+	}
+	if len(m.Body) > maxBody {
+		return fmt.Errorf("comment: body is too long, max %d", maxBody)
+	}
+
+	if m.Parent != "" {
+		if err := m.Parent.Validate(); err != nil {
+			return fmt.Errorf("comment: parent: %w", err)
+		}
+		if m.Start != 0 || m.End != nil {
+			return errors.New("comment: replies cannot have a time position")
+		}
+		if m.Resolved {
+			return errors.New("comment: replies cannot be resolved")
+		}
+	}
+	if m.Start < 0 {
+		return errors.New("comment: start must not be negative")
+	}
+	if m.End != nil && *m.End <= m.Start {
+		return errors.New("comment: end must be after start")
+	}
+
+	if err := m.Project.Validate(); err != nil {
+		return fmt.Errorf("comment: project: %w", err)
+	}
+	if err := m.Commit.Validate(); err != nil {
+		return fmt.Errorf("comment: commit: %w", err)
+	}
+	if err := m.File.Validate(); err != nil {
+		return fmt.Errorf("comment: file: %w", err)
+	}
+	if m.Path == "" {
+		return errors.New("comment: path is empty")
+	}
+	if err := m.Author.Validate(); err != nil {
+		return fmt.Errorf("comment: author: %w", err)
+	}
+	return nil
+}
+
+func GetComment(ctx context.Context, pid, mid id.ID) (*Comment, error) {
+	row := db.QueryRowContext(ctx, commentSelectID, pid, mid)
+	return new(Comment).scan(row)
+}
+
+// GetFileComments returns threads on the file and those carried forward from
+// earlier commits, ordered by time position.
+func GetFileComments(ctx context.Context, pid, cid id.ID, f *File) ([]Comment, error) {
+	rows, err := db.QueryContext(ctx,
+		commentSelect+commentCarried+" AND (m.path=? OR m.commit_id=? AND m.file_id=?) ORDER BY m.created, m.id",
+		pid, pid, cid, f.Path, cid, f.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanThreads(rows, cid)
+}
+
+// GetCommitComments returns threads on commit's files and those carried
+// forward from earlier commits, ordered by path and time position.
+func GetCommitComments(ctx context.Context, pid, cid id.ID) ([]Comment, error) {
+	rows, err := db.QueryContext(ctx,
+		commentSelect+commentCarried+" AND m.path IN (SELECT path FROM file WHERE project_id=? AND commit_id=?) ORDER BY m.created, m.id",
+		pid, pid, cid, pid, cid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanThreads(rows, cid)
+}
+
+// scanThreads scans comments ordered by creation into threads with their
+// replies. Threads are ordered by path and time position.
+func scanThreads(rows *sql.Rows, cid id.ID) ([]Comment, error) {
+	comments := make([]Comment, 0)
+	for rows.Next() {
+		m, err := new(Comment).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		m.CarriedForward = m.Commit != cid
+		comments = append(comments, *m)
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	threads := make([]Comment, 0)
+	index := make(map[id.ID]int)
+	for _, m := range comments {
+		if m.Parent == "" {
+			m.Replies = make([]Comment, 0)
+			index[m.ID] = len(threads)
+			threads = append(threads, m)
+		}
+	}
+	for _, m := range comments {
+		if i, ok := index[m.Parent]; ok {
+			threads[i].Replies = append(threads[i].Replies, m)
+		}
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		a, b := threads[i], threads[j]
+		return a.Path < b.Path || a.Path == b.Path && a.Start < b.Start
+	})
+	return threads, nil
+}
+
+func InsertComment(ctx context.Context, m *Comment) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, commentInsert,
+		m.ID,
+		m.Body,
+		m.Start,
+		m.End,
+		m.Parent,
+		m.Resolved,
+		m.ResolvedBy,
+		m.ResolvedAt,
+		m.Created,
+		m.Modified,
+		m.Project,
+		m.Commit,
+		m.File,
+		m.Path,
+		m.Author,
+	)
+	return err
+}
+
+func UpdateComment(ctx context.Context, pid, mid id.ID, modifyFn func(*Comment) error) (*Comment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, commentSelectID+" FOR UPDATE", pid, mid)
+	m, err := new(Comment).scan(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = modifyFn(m); err != nil {
+		return nil, err
+	}
+	if err = m.validate(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, commentUpdate,
+		m.Body,
+		m.Start,
+		m.End,
+		m.Resolved,
+		m.ResolvedBy,
+		m.ResolvedAt,
+		m.Modified,
+		pid,
+		mid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+// DeleteComment deletes the comment with its replies.
+func DeleteComment(ctx context.Context, pid, mid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM comment WHERE project_id=? AND (id=? OR parent_id=?)", pid, mid, mid)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
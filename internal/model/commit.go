@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -10,12 +11,12 @@ import (
 )
 
 const (
-	commitSelect       = "SELECT id, title, message, created, modified, project_id, user_id FROM commit"
-	commitSelectID     = commitSelect + " WHERE project_id=? AND id=?"
-	commitSelectAllPID = commitSelect + " WHERE project_id=?"
+	commitSelect       = "SELECT c.id, c.title, c.message, c.created, c.modified, c.project_id, c.user_id, " + commitMusicColumns + ", " + projectMusicColumns + " FROM commit c JOIN project p ON p.id=c.project_id"
+	commitSelectID     = commitSelect + " WHERE c.project_id=? AND c.id=?"
+	commitSelectAllPID = commitSelect + " WHERE c.project_id=?"
 
-	commitInsert = "INSERT INTO commit (id, title, message, created, modified, project_id, user_id) VALUES (?,?,?,?,?,?,?)"
-	commitUpdate = "UPDATE commit SET title=?, message=?, modified=? WHERE project_id=? AND id=?"
+	commitInsert = "INSERT INTO commit (id, title, message, created, modified, project_id, user_id, bpm, music_key, time_signature, genre, isrc, working_title) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	commitUpdate = "UPDATE commit SET title=?, message=?, modified=?, bpm=?, music_key=?, time_signature=?, genre=?, isrc=?, working_title=? WHERE project_id=? AND id=?"
 )
 
 type Commit struct {
@@ -25,12 +26,18 @@ type Commit struct {
 	Created  time.Time `json:"created"`
 	Modified time.Time `json:"modified"`
 
+	Music     MusicOverride `json:"music"`
+	Effective Music         `json:"effectiveMusic"` // Project's music with commit's overrides, read-only
+
 	Project id.ID `json:"projectID"`
 	User    id.ID `json:"userID"`
+
+	projectMusic Music
 }
 
 func (c *Commit) scan(sc scanner) (*Commit, error) {
-	return c, sc.Scan(
+	p := &c.projectMusic
+	err := sc.Scan(
 		&c.ID,
 		&c.Title,
 		&c.Message,
@@ -38,7 +45,27 @@ func (c *Commit) scan(sc scanner) (*Commit, error) {
 		&c.Modified,
 		&c.Project,
 		&c.User,
+		&c.Music.BPM,
+		&c.Music.Key,
+		&c.Music.TimeSignature,
+		&c.Music.Genre,
+		&c.Music.ISRC,
+		&c.Music.WorkingTitle,
+		&p.BPM,
+		&p.Key,
+		&p.TimeSignature,
+		&p.Genre,
+		&p.ISRC,
+		&p.WorkingTitle,
 	)
+	c.resolveMusic()
+	return c, err
+}
+
+// resolveMusic sets commit's effective music.
+func (c *Commit) resolveMusic() {
+	c.Effective = c.projectMusic
+	c.Music.apply(&c.Effective)
 }
 
 func (c *Commit) validate() error {
@@ -55,6 +82,9 @@ func (c *Commit) validate() error {
 	if len(c.Message) > maxMessage {
 		return fmt.Errorf("commit: message is too long, max %d", maxMessage)
 	}
+	if err := c.Music.validate(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
 
 	if err := c.Project.Validate(); err != nil {
 		return fmt.Errorf("commit: project: %w", err)
@@ -75,7 +105,10 @@ func GetAllCommits(ctx context.Context, pid id.ID) ([]Commit, error) {
 	if err != nil {
 		return nil, err
 	}
+	return scanCommits(rows)
+}
 
+func scanCommits(rows *sql.Rows) ([]Commit, error) {
 	commits := make([]Commit, 0)
 	for rows.Next() {
 		c, err := new(Commit).scan(rows)
@@ -86,11 +119,11 @@ func GetAllCommits(ctx context.Context, pid id.ID) ([]Commit, error) {
 		commits = append(commits, *c)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		_ = rows.Close()
 		return nil, err
 	}
-	if err = rows.Close(); err != nil {
+	if err := rows.Close(); err != nil {
 		return nil, err
 	}
 	return commits, nil
@@ -100,7 +133,24 @@ func InsertCommit(ctx context.Context, c *Commit) error {
 	if err := c.validate(); err != nil {
 		return err
 	}
-	_, err := db.ExecContext(ctx, commitInsert,
+	p := &c.projectMusic
+	err := db.QueryRowContext(ctx, "SELECT "+projectMusicColumns+" FROM project p WHERE p.id=?", c.Project).Scan(
+		&p.BPM,
+		&p.Key,
+		&p.TimeSignature,
+		&p.Genre,
+		&p.ISRC,
+		&p.WorkingTitle,
+	)
+	if err != nil {
+		return err
+	}
+	c.resolveMusic()
+	return insertCommit(ctx, db, c)
+}
+
+func insertCommit(ctx context.Context, ex execer, c *Commit) error {
+	_, err := ex.ExecContext(ctx, commitInsert,
 		c.ID,
 		c.Title,
 		c.Message,
@@ -108,6 +158,12 @@ func InsertCommit(ctx context.Context, c *Commit) error {
 		c.Modified,
 		c.Project,
 		c.User,
+		c.Music.BPM,
+		c.Music.Key,
+		c.Music.TimeSignature,
+		c.Music.Genre,
+		c.Music.ISRC,
+		c.Music.WorkingTitle,
 	)
 	return err
 }
@@ -136,12 +192,19 @@ func EditCommit(ctx context.Context, pid, cid id.ID, modifyFn func(*Commit) erro
 		c.Title,
 		c.Message,
 		c.Modified,
+		c.Music.BPM,
+		c.Music.Key,
+		c.Music.TimeSignature,
+		c.Music.Genre,
+		c.Music.ISRC,
+		c.Music.WorkingTitle,
 		pid,
 		cid,
 	)
 	if err != nil {
 		return nil, err
 	}
+	c.resolveMusic()
 	return c, tx.Commit()
 }
 
@@ -152,7 +215,19 @@ func DeleteCommit(ctx context.Context, pid, cid id.ID) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, "DELETE FROM file WHERE project_id=? AND id=?", pid, cid)
+	hashes, err := selectBlobs(ctx, tx, "project_id=? AND commit_id=?", pid, cid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM file WHERE project_id=? AND commit_id=?", pid, cid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM share WHERE project_id=? AND commit_id=?", pid, cid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM comment WHERE project_id=? AND commit_id=?", pid, cid)
 	if err != nil {
 		return err
 	}
@@ -168,5 +243,8 @@ func DeleteCommit(ctx context.Context, pid, cid id.ID) error {
 	if n == 0 {
 		return ErrNotFound
 	}
+	if err = deleteUnusedBlobs(ctx, tx, hashes...); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
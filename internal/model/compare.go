@@ -0,0 +1,142 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+	"github.com/sewiti/munit-backend/pkg/midi"
+)
+
+// ErrNotMIDI is returned when comparing MIDI files, if a file is not one.
+var ErrNotMIDI = errors.New("file is not a MIDI file")
+
+type ChangeStatus string
+
+const (
+	ChangeAdded     ChangeStatus = "added"
+	ChangeRemoved   ChangeStatus = "removed"
+	ChangeModified  ChangeStatus = "modified"
+	ChangeUnchanged ChangeStatus = "unchanged"
+)
+
+// Comparison of files of two commits, matched by path.
+type Comparison struct {
+	Base  id.ID        `json:"baseID"`
+	Head  id.ID        `json:"headID"`
+	Files []FileChange `json:"files"`
+}
+
+// FileChange is a change of file at a path from base to head commit. Files are
+// without their data.
+type FileChange struct {
+	Path   string       `json:"path"`
+	Status ChangeStatus `json:"status"`
+	Base   *File        `json:"base"` // nil if added
+	Head   *File        `json:"head"` // nil if removed
+
+	LoudnessDelta *Loudness `json:"loudnessDelta,omitempty"` // Head's minus base's, if both are analyzed
+}
+
+// CompareCommits compares files of head commit to those of base commit.
+// Changes are ordered by path.
+func CompareCommits(ctx context.Context, pid, base, head id.ID) (*Comparison, error) {
+	for _, cid := range []id.ID{base, head} {
+		if _, err := GetCommit(ctx, pid, cid); err != nil {
+			return nil, err
+		}
+	}
+	baseFiles, err := GetAllFilesMeta(ctx, pid, base)
+	if err != nil {
+		return nil, err
+	}
+	headFiles, err := GetAllFilesMeta(ctx, pid, head)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collation may order paths differently, sort them bytewise for merging.
+	for _, files := range [][]File{baseFiles, headFiles} {
+		files := files
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	}
+
+	c := &Comparison{Base: base, Head: head, Files: make([]FileChange, 0)}
+	i, j := 0, 0
+	for i < len(baseFiles) || j < len(headFiles) {
+		switch {
+		case j == len(headFiles) || i < len(baseFiles) && baseFiles[i].Path < headFiles[j].Path:
+			b := &baseFiles[i]
+			c.Files = append(c.Files, FileChange{Path: b.Path, Status: ChangeRemoved, Base: b})
+			i++
+		case i == len(baseFiles) || headFiles[j].Path < baseFiles[i].Path:
+			h := &headFiles[j]
+			c.Files = append(c.Files, FileChange{Path: h.Path, Status: ChangeAdded, Head: h})
+			j++
+		default:
+			b, h := &baseFiles[i], &headFiles[j]
+			change := FileChange{Path: h.Path, Status: ChangeModified, Base: b, Head: h}
+			if b.Hash == h.Hash {
+				change.Status = ChangeUnchanged
+			}
+			if b.Loudness != nil && h.Loudness != nil {
+				change.LoudnessDelta = h.Loudness.Delta(b.Loudness)
+			}
+			c.Files = append(c.Files, change)
+			i++
+			j++
+		}
+	}
+	return c, nil
+}
+
+// MIDIComparison is a musical comparison of MIDI file at a path in two
+// commits.
+type MIDIComparison struct {
+	Path   string       `json:"path"`
+	Status ChangeStatus `json:"status"`
+	Base   id.ID        `json:"baseID"`
+	Head   id.ID        `json:"headID"`
+	Diff   *midi.Diff   `json:"diff"`
+}
+
+// CompareMIDI compares MIDI file at the path in head commit to that in base
+// commit. The file may be missing from one of the commits.
+func CompareMIDI(ctx context.Context, pid, base, head id.ID, path string) (*MIDIComparison, error) {
+	var seqs [2]*midi.Sequence
+	var hashes [2]string
+	for i, cid := range []id.ID{base, head} {
+		if _, err := GetCommit(ctx, pid, cid); err != nil {
+			return nil, err
+		}
+		f, err := GetFileByPath(ctx, pid, cid, path)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		seqs[i], err = midi.Parse(f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrNotMIDI, f.Path, err)
+		}
+		hashes[i] = f.Hash
+	}
+
+	c := &MIDIComparison{Path: path, Status: ChangeModified, Base: base, Head: head}
+	switch {
+	case seqs[0] == nil && seqs[1] == nil:
+		return nil, ErrNotFound
+	case seqs[0] == nil:
+		c.Status = ChangeAdded
+	case seqs[1] == nil:
+		c.Status = ChangeRemoved
+	case hashes[0] == hashes[1]:
+		c.Status = ChangeUnchanged
+	}
+	c.Diff = midi.Compare(seqs[0], seqs[1])
+	return c, nil
+}
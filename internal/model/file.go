@@ -2,45 +2,93 @@ package model
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"path"
 	"strings"
 	"time"
 
+	"github.com/sewiti/munit-backend/pkg/ableton"
 	"github.com/sewiti/munit-backend/pkg/id"
+	"github.com/sewiti/munit-backend/pkg/midi"
 )
 
 const (
-	fileSelect      = "SELECT id, path, data, created, modified, commit_id, project_id FROM file"
-	fileSelectID    = fileSelect + " WHERE project_id=? AND commit_id=? AND id=?"
-	fileSelectAllID = fileSelect + " WHERE project_id=? AND commit_id=?"
+	fileSelect      = "SELECT f.id, f.path, f.blob_hash, b.data, " + fileColumns + " FROM file f JOIN `blob` b ON b.hash=f.blob_hash" + fileJoins
+	fileSelectID    = fileSelect + " WHERE f.project_id=? AND f.commit_id=? AND f.id=?"
+	fileSelectAllID = fileSelect + " WHERE f.project_id=? AND f.commit_id=?"
+	fileSelectPath  = fileSelect + " WHERE f.project_id=? AND f.commit_id=? AND f.path=?"
 
-	fileInsert = "INSERT INTO file (id, path, data, created, modified, commit_id, project_id) VALUES (?,?,?,?,?,?,?)"
-	fileUpdate = "UPDATE file SET path=?, data=?, modified=? WHERE project_id=? AND commit_id=? AND id=?"
+	// fileSelectMeta selects files without their data.
+	fileSelectMeta      = "SELECT f.id, f.path, f.blob_hash, NULL, " + fileColumns + " FROM file f" + fileJoins
+	fileSelectMetaID    = fileSelectMeta + " WHERE f.project_id=? AND f.commit_id=? AND f.id=?"
+	fileSelectMetaAllID = fileSelectMeta + " WHERE f.project_id=? AND f.commit_id=? ORDER BY f.path"
+
+	fileColumns = "f.created, f.modified, f.commit_id, f.project_id, " + fileAudioColumns + ", f.midi, f.ableton, f.markers, " + fileLoudnessColumns
+	fileJoins   = " LEFT JOIN loudness l ON l.blob_hash=f.blob_hash"
+
+	fileInsert = "INSERT INTO file (id, path, blob_hash, created, modified, commit_id, project_id, audio_format, audio_codec, sample_rate, bit_depth, channels, duration_ms, midi, ableton, markers) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	fileUpdate = "UPDATE file SET path=?, blob_hash=?, modified=?, audio_format=?, audio_codec=?, sample_rate=?, bit_depth=?, channels=?, duration_ms=?, midi=?, ableton=?, markers=? WHERE project_id=? AND commit_id=? AND id=?"
+
+	fileAudioColumns = "f.audio_format, f.audio_codec, f.sample_rate, f.bit_depth, f.channels, f.duration_ms"
 )
 
 type File struct {
-	ID       id.ID     `json:"id"`
-	Path     string    `json:"path"`
-	Data     []byte    `json:"data"`
-	Created  time.Time `json:"created"`
-	Modified time.Time `json:"modified"`
+	ID       id.ID         `json:"id"`
+	Path     string        `json:"path"`
+	Hash     string        `json:"hash"` // SHA-256 of data, set on insert and update
+	Data     []byte        `json:"data"`
+	Created  time.Time     `json:"created"`
+	Modified time.Time     `json:"modified"`
+	Audio    *Audio        `json:"audio"`    // Read from data on insert and update, nil if not audio
+	MIDI     *midi.Summary `json:"midi"`     // Read from data on insert and update, nil if not MIDI
+	Ableton  *ableton.Set  `json:"ableton"`  // Parsed in background, nil until then or if not an Ableton Live set
+	Markers  []Marker      `json:"markers"`  // Read from data on insert and update, editable, nil if not WAV
+	Loudness *Loudness     `json:"loudness"` // Analyzed in background, nil until then
 
 	Commit  id.ID `json:"commitID"`
 	Project id.ID `json:"projectID"`
 }
 
 func (f *File) scan(sc scanner) (*File, error) {
-	return f, sc.Scan(
+	var (
+		a audioColumns
+		m jsonColumn
+		s jsonColumn
+		k jsonColumn
+		l loudnessColumns
+	)
+	err := sc.Scan(
 		&f.ID,
 		&f.Path,
+		&f.Hash,
 		&f.Data,
 		&f.Created,
 		&f.Modified,
 		&f.Commit,
 		&f.Project,
+		&a.format,
+		&a.codec,
+		&a.sampleRate,
+		&a.bitDepth,
+		&a.channels,
+		&a.duration,
+		(*sql.NullString)(&m),
+		(*sql.NullString)(&s),
+		(*sql.NullString)(&k),
+		&l.integrated,
+		&l.truePeak,
+		&l.samplePeak,
+		&l.rms,
+		&l.dynamicRange,
 	)
+	f.Audio = a.audio()
+	f.MIDI = m.midi()
+	f.Ableton = s.ableton()
+	f.Markers = k.markers()
+	f.Loudness = l.loudness()
+	return f, err
 }
 
 func (f *File) validate() error {
@@ -61,11 +109,46 @@ func (f *File) validate() error {
 
 func GetFile(ctx context.Context, pid, cid, fid id.ID) (*File, error) {
 	row := db.QueryRowContext(ctx, fileSelectID, pid, cid, fid)
-	return new(File).scan(row)
+	return getFile(ctx, row)
+}
+
+// GetFileMeta returns file without its data.
+func GetFileMeta(ctx context.Context, pid, cid, fid id.ID) (*File, error) {
+	row := db.QueryRowContext(ctx, fileSelectMetaID, pid, cid, fid)
+	return getFile(ctx, row)
+}
+
+func GetFileByPath(ctx context.Context, pid, cid id.ID, path string) (*File, error) {
+	row := db.QueryRowContext(ctx, fileSelectPath, pid, cid, path)
+	return getFile(ctx, row)
+}
+
+func getFile(ctx context.Context, row scanner) (*File, error) {
+	f, err := new(File).scan(row)
+	if err != nil {
+		return nil, err
+	}
+	if f.Ableton != nil {
+		paths, err := selectPaths(ctx, db, f.Project, f.Commit)
+		if err != nil {
+			return nil, err
+		}
+		flagMissingSamples(f, paths)
+	}
+	return f, nil
 }
 
 func GetAllFiles(ctx context.Context, pid, cid id.ID) ([]File, error) {
-	rows, err := db.QueryContext(ctx, fileSelectAllID, pid, cid)
+	return getAllFiles(ctx, fileSelectAllID, pid, cid)
+}
+
+// GetAllFilesMeta returns commit's files without their data, ordered by path.
+func GetAllFilesMeta(ctx context.Context, pid, cid id.ID) ([]File, error) {
+	return getAllFiles(ctx, fileSelectMetaAllID, pid, cid)
+}
+
+func getAllFiles(ctx context.Context, query string, pid, cid id.ID) ([]File, error) {
+	rows, err := db.QueryContext(ctx, query, pid, cid)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +170,14 @@ func GetAllFiles(ctx context.Context, pid, cid id.ID) ([]File, error) {
 	if err = rows.Close(); err != nil {
 		return nil, err
 	}
+
+	paths := make(map[string]bool, len(files))
+	for _, f := range files {
+		paths[f.Path] = true
+	}
+	for i := range files {
+		flagMissingSamples(&files[i], paths)
+	}
 	return files, nil
 }
 
@@ -94,14 +185,60 @@ func InsertFile(ctx context.Context, f *File) error {
 	if err := f.validate(); err != nil {
 		return err
 	}
-	_, err := db.ExecContext(ctx, fileInsert,
+	f.Audio = parseAudio(f.Data)
+	f.MIDI = parseMIDI(f.Data)
+	f.Ableton = nil
+	f.Markers = parseMarkers(f.Data, f.Audio)
+	f.Loudness = nil
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	f.Hash, err = insertBlob(ctx, tx, f.Data)
+	if err != nil {
+		return err
+	}
+	if err = insertFile(ctx, tx, f); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertFile inserts file referring to an already stored blob.
+func insertFile(ctx context.Context, ex execer, f *File) error {
+	a := newAudioColumns(f.Audio)
+	m, err := newMIDIColumn(f.MIDI)
+	if err != nil {
+		return err
+	}
+	s, err := newAbletonColumn(f.Ableton)
+	if err != nil {
+		return err
+	}
+	k, err := newMarkersColumn(f.Markers)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx, fileInsert,
 		f.ID,
 		f.Path,
-		f.Data,
+		f.Hash,
 		f.Created,
 		f.Modified,
 		f.Commit,
 		f.Project,
+		a.format,
+		a.codec,
+		a.sampleRate,
+		a.bitDepth,
+		a.channels,
+		a.duration,
+		sql.NullString(m),
+		sql.NullString(s),
+		sql.NullString(k),
 	)
 	return err
 }
@@ -119,17 +256,69 @@ func UpdateFile(ctx context.Context, pid, cid, fid id.ID, modifyFn func(*File) e
 		return nil, err
 	}
 
+	origHash, origPath, set := f.Hash, f.Path, f.Ableton
+	origMarkers, err := newMarkersColumn(f.Markers)
+	if err != nil {
+		return nil, err
+	}
 	if err = modifyFn(f); err != nil {
 		return nil, err
 	}
 	if err = f.validate(); err != nil {
 		return nil, err
 	}
+	f.Audio = parseAudio(f.Data)
+	f.MIDI = parseMIDI(f.Data)
 
+	f.Hash, err = insertBlob(ctx, tx, f.Data)
+	if err != nil {
+		return nil, err
+	}
+	f.Ableton = set
+	if f.Hash != origHash || !isAbletonPath(f.Path) {
+		f.Ableton = nil // parsed anew
+	}
+	switch {
+	case f.Hash != origHash:
+		f.Markers = parseMarkers(f.Data, f.Audio) // edits are lost with new data
+	case isWAV(f.Audio) && f.Markers == nil:
+		f.Markers = make([]Marker, 0)
+	}
+	k, err := newMarkersColumn(f.Markers)
+	if err != nil {
+		return nil, err
+	}
+	if f.Hash == origHash && k != origMarkers {
+		// Only edited markers are validated, those read from data fit already.
+		if err = validateMarkers(f.Markers, f.Audio); err != nil {
+			return nil, err
+		}
+		if k, err = newMarkersColumn(f.Markers); err != nil { // ordered by validation
+			return nil, err
+		}
+	}
+	a := newAudioColumns(f.Audio)
+	m, err := newMIDIColumn(f.MIDI)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newAbletonColumn(f.Ableton)
+	if err != nil {
+		return nil, err
+	}
 	_, err = tx.ExecContext(ctx, fileUpdate,
 		f.Path,
-		f.Data,
+		f.Hash,
 		f.Modified,
+		a.format,
+		a.codec,
+		a.sampleRate,
+		a.bitDepth,
+		a.channels,
+		a.duration,
+		sql.NullString(m),
+		sql.NullString(s),
+		sql.NullString(k),
 		pid,
 		cid,
 		fid,
@@ -137,6 +326,26 @@ func UpdateFile(ctx context.Context, pid, cid, fid id.ID, modifyFn func(*File) e
 	if err != nil {
 		return nil, err
 	}
+	if f.Path != origPath {
+		// Comments follow the file, and are carried forward by its new path.
+		_, err = tx.ExecContext(ctx, "UPDATE comment SET path=? WHERE project_id=? AND commit_id=? AND file_id=?", f.Path, pid, cid, fid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if f.Hash != origHash {
+		f.Loudness = nil // analyzed anew
+		if err = deleteUnusedBlobs(ctx, tx, origHash); err != nil {
+			return nil, err
+		}
+	}
+	if f.Ableton != nil {
+		paths, err := selectPaths(ctx, tx, pid, cid)
+		if err != nil {
+			return nil, err
+		}
+		flagMissingSamples(f, paths)
+	}
 	return f, tx.Commit()
 }
 
@@ -147,6 +356,18 @@ func DeleteFile(ctx context.Context, pid, cid, fid id.ID) error {
 	}
 	defer tx.Rollback()
 
+	_, err = tx.ExecContext(ctx, "DELETE FROM share WHERE project_id=? AND commit_id=? AND file_id=?", pid, cid, fid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM comment WHERE project_id=? AND commit_id=? AND file_id=?", pid, cid, fid)
+	if err != nil {
+		return err
+	}
+	hashes, err := selectBlobs(ctx, tx, "project_id=? AND commit_id=? AND id=?", pid, cid, fid)
+	if err != nil {
+		return err
+	}
 	res, err := tx.ExecContext(ctx, "DELETE FROM file WHERE project_id=? AND commit_id=? AND id=?", pid, cid, fid)
 	if err != nil {
 		return err
@@ -159,5 +380,8 @@ func DeleteFile(ctx context.Context, pid, cid, fid id.ID) error {
 	if n == 0 {
 		return ErrNotFound
 	}
+	if err = deleteUnusedBlobs(ctx, tx, hashes...); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
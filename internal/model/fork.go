@@ -0,0 +1,100 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// ForkProject inserts fork of the upstream project with copies of all its
+// commits and files. Files share blobs with upstream, so their contents are not
+// copied. Fork's Upstream is set.
+func ForkProject(ctx context.Context, upstream id.ID, fork *Project) error {
+	fork.Upstream = upstream
+	if err := fork.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock upstream's commits, so that the copy is consistent.
+	rows, err := tx.QueryContext(ctx, commitSelectAllPID+" LOCK IN SHARE MODE", upstream)
+	if err != nil {
+		return err
+	}
+	commits, err := scanCommits(rows)
+	if err != nil {
+		return err
+	}
+	rows, err = tx.QueryContext(ctx,
+		"SELECT f.id, f.path, f.blob_hash, f.created, f.modified, f.commit_id, "+fileAudioColumns+", f.midi, f.ableton, f.markers"+
+			" FROM file f WHERE f.project_id=? LOCK IN SHARE MODE", upstream)
+	if err != nil {
+		return err
+	}
+	files := make([]File, 0)
+	for rows.Next() {
+		var (
+			f File
+			a audioColumns
+			m jsonColumn
+			s jsonColumn
+			k jsonColumn
+		)
+		err = rows.Scan(&f.ID, &f.Path, &f.Hash, &f.Created, &f.Modified, &f.Commit,
+			&a.format, &a.codec, &a.sampleRate, &a.bitDepth, &a.channels, &a.duration,
+			(*sql.NullString)(&m), (*sql.NullString)(&s), (*sql.NullString)(&k))
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		f.Audio = a.audio()
+		f.MIDI = m.midi()
+		f.Ableton = s.ableton()
+		f.Markers = k.markers()
+		files = append(files, f)
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+
+	if err = insertProject(ctx, tx, fork); err != nil {
+		return err
+	}
+
+	// Commits and files get new IDs, but keep their authors and timestamps.
+	commitIDs := make(map[id.ID]id.ID, len(commits))
+	for _, c := range commits {
+		newID, err := id.New()
+		if err != nil {
+			return err
+		}
+		commitIDs[c.ID] = newID
+		c.ID = newID
+		c.Project = fork.ID
+		if err = insertCommit(ctx, tx, &c); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		f.ID, err = id.New()
+		if err != nil {
+			return err
+		}
+		f.Commit = commitIDs[f.Commit]
+		f.Project = fork.ID
+		if err = insertFile(ctx, tx, &f); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// Identity links an external identity provider's account to a user.
+type Identity struct {
+	Issuer  string
+	Subject string
+	Created time.Time
+
+	User id.ID
+}
+
+func (i *Identity) validate() error {
+	const (
+		maxIssuer  = 256
+		maxSubject = 256
+	)
+	if i.Issuer == "" {
+		return errors.New("identity: issuer is empty")
+	}
+	if len(i.Issuer) > maxIssuer {
+		return fmt.Errorf("identity: issuer is too long, max %d", maxIssuer)
+	}
+	if i.Subject == "" {
+		return errors.New("identity: subject is empty")
+	}
+	if len(i.Subject) > maxSubject {
+		return fmt.Errorf("identity: subject is too long, max %d", maxSubject)
+	}
+	if err := i.User.Validate(); err != nil {
+		return fmt.Errorf("identity: user: %w", err)
+	}
+	return nil
+}
+
+// GetIdentityUser returns the user linked to the external identity.
+func GetIdentityUser(ctx context.Context, issuer, subject string) (*User, error) {
+	row := db.QueryRowContext(ctx,
+		userSelect+" WHERE id=(SELECT user_id FROM user_identity WHERE issuer=? AND subject=?)",
+		issuer, subject,
+	)
+	return new(User).scan(row)
+}
+
+func InsertIdentity(ctx context.Context, i *Identity) error {
+	if err := i.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO user_identity (issuer, subject, created, user_id) VALUES (?,?,?,?)",
+		i.Issuer,
+		i.Subject,
+		i.Created,
+		i.User,
+	)
+	if err != nil {
+		if isDuplicate(err) {
+			return errors.New("identity is already linked")
+		}
+		return err
+	}
+	return nil
+}
+
+// InsertUserIdentity creates a new user along with a linked identity.
+func InsertUserIdentity(ctx context.Context, u *User, i *Identity) error {
+	if err := u.validatePasswd(true); err != nil {
+		return err
+	}
+	if err := i.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertUser(ctx, tx, u); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO user_identity (issuer, subject, created, user_id) VALUES (?,?,?,?)",
+		i.Issuer,
+		i.Subject,
+		i.Created,
+		i.User,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
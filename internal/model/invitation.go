@@ -0,0 +1,229 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	invitationSelect        = "SELECT id, token_hash, email, role, created, expires, project_id, inviter_id, user_id FROM invitation"
+	invitationSelectID      = invitationSelect + " WHERE project_id=? AND id=?"
+	invitationSelectToken   = invitationSelect + " WHERE token_hash=?"
+	invitationSelectAllPID  = invitationSelect + " WHERE project_id=?"
+	invitationSelectPending = invitationSelect + " WHERE user_id=? AND expires>?"
+
+	invitationInsert = "INSERT INTO invitation (id, token_hash, email, role, created, expires, project_id, inviter_id, user_id) VALUES (?,?,?,?,?,?,?,?,?)"
+
+	// MaxInvitationExpiry is the longest time an invitation can stay pending.
+	MaxInvitationExpiry = 30 * 24 * time.Hour // 30d
+)
+
+var ErrInvitationExpired = errors.New("invitation has expired")
+
+type Invitation struct {
+	ID      id.ID     `json:"id"`
+	Token   string    `json:"-"` // Only known on creation, mailed to the invitee
+	Email   string    `json:"email"`
+	Role    Role      `json:"role"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	Project id.ID `json:"projectID"`
+	Inviter id.ID `json:"inviterID"`
+	User    id.ID `json:"userID"`
+
+	TokenHash string `json:"-"` // See auth.HashToken
+}
+
+func (inv *Invitation) scan(sc scanner) (*Invitation, error) {
+	return inv, sc.Scan(
+		&inv.ID,
+		&inv.TokenHash,
+		&inv.Email,
+		&inv.Role,
+		&inv.Created,
+		&inv.Expires,
+		&inv.Project,
+		&inv.Inviter,
+		&inv.User,
+	)
+}
+
+func (inv *Invitation) validate() error {
+	if err := inv.ID.Validate(); err != nil {
+		return fmt.Errorf("invitation: %w", err)
+	}
+	if inv.TokenHash == "" {
+		return errors.New("invitation: token hash is empty")
+	}
+	if err := inv.Role.Validate(); err != nil {
+		return fmt.Errorf("invitation: %w", err)
+	}
+	if !inv.Expires.After(inv.Created) {
+		return errors.New("invitation: expiry must be in the future")
+	}
+	if inv.Expires.Sub(inv.Created) > MaxInvitationExpiry {
+		return fmt.Errorf("invitation: expiry is too far, max %v", MaxInvitationExpiry)
+	}
+
+	if err := inv.Project.Validate(); err != nil {
+		return fmt.Errorf("invitation: project: %w", err)
+	}
+	if err := inv.Inviter.Validate(); err != nil {
+		return fmt.Errorf("invitation: inviter: %w", err)
+	}
+	if err := inv.User.Validate(); err != nil {
+		return fmt.Errorf("invitation: user: %w", err)
+	}
+	return nil
+}
+
+func GetInvitation(ctx context.Context, pid, iid id.ID) (*Invitation, error) {
+	row := db.QueryRowContext(ctx, invitationSelectID, pid, iid)
+	return new(Invitation).scan(row)
+}
+
+// GetAllInvitations returns all project's invitations, including expired ones.
+func GetAllInvitations(ctx context.Context, pid id.ID) ([]Invitation, error) {
+	rows, err := db.QueryContext(ctx, invitationSelectAllPID, pid)
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// GetPendingInvitations returns user's invitations that have not expired yet.
+func GetPendingInvitations(ctx context.Context, uid id.ID) ([]Invitation, error) {
+	rows, err := db.QueryContext(ctx, invitationSelectPending, uid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+func scanInvitations(rows *sql.Rows) ([]Invitation, error) {
+	invitations := make([]Invitation, 0)
+	for rows.Next() {
+		inv, err := new(Invitation).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func InsertInvitation(ctx context.Context, inv *Invitation) error {
+	if err := inv.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, invitationInsert,
+		inv.ID,
+		inv.TokenHash,
+		inv.Email,
+		inv.Role,
+		inv.Created,
+		inv.Expires,
+		inv.Project,
+		inv.Inviter,
+		inv.User,
+	)
+	if err != nil {
+		if isDuplicate(err) {
+			return errors.New("user is already invited")
+		}
+		return err
+	}
+	return nil
+}
+
+// AcceptInvitation adds user to the project with invitation's role and
+// removes the invitation.
+func AcceptInvitation(ctx context.Context, hash string, uid id.ID) (*Invitation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, invitationSelectToken, hash)
+	inv, err := new(Invitation).scan(row)
+	if err != nil {
+		return nil, err
+	}
+	if inv.User != uid {
+		return nil, ErrNotFound // do not reveal others' invitations
+	}
+	if inv.Expires.Before(time.Now()) {
+		return nil, ErrInvitationExpired
+	}
+
+	var associated bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM project p LEFT JOIN contributor c ON p.id=c.project_id AND c.user_id=? WHERE p.id=? AND (p.owner_id=? OR c.user_id IS NOT NULL))",
+		uid, inv.Project, uid,
+	).Scan(&associated)
+	if err != nil {
+		return nil, err
+	}
+	if !associated {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO contributor (project_id, user_id, role) VALUES (?,?,?)",
+			inv.Project, inv.User, inv.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM invitation WHERE id=?", inv.ID)
+	if err != nil {
+		return nil, err
+	}
+	return inv, tx.Commit()
+}
+
+// DeclineInvitation removes user's invitation.
+func DeclineInvitation(ctx context.Context, hash string, uid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM invitation WHERE token_hash=? AND user_id=?", hash, uid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func DeleteInvitation(ctx context.Context, pid, iid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM invitation WHERE project_id=? AND id=?", pid, iid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const fileLoudnessColumns = "l.integrated, l.true_peak, l.sample_peak, l.rms, l.dynamic_range"
+
+// Loudness are loudness and levels of an audio file. Like peaks, they are
+// analyzed in background and shared by all files with the same contents.
+type Loudness struct {
+	Integrated   float64 `json:"integrated"`   // LUFS
+	TruePeak     float64 `json:"truePeak"`     // dBTP
+	SamplePeak   float64 `json:"samplePeak"`   // dBFS
+	RMS          float64 `json:"rms"`          // dBFS
+	DynamicRange float64 `json:"dynamicRange"` // Loudness range (EBU Tech 3342), LU
+}
+
+// Delta returns the difference of l from base.
+func (l *Loudness) Delta(base *Loudness) *Loudness {
+	return &Loudness{
+		Integrated:   l.Integrated - base.Integrated,
+		TruePeak:     l.TruePeak - base.TruePeak,
+		SamplePeak:   l.SamplePeak - base.SamplePeak,
+		RMS:          l.RMS - base.RMS,
+		DynamicRange: l.DynamicRange - base.DynamicRange,
+	}
+}
+
+// loudnessColumns are file's loudness columns, all NULL until analyzed.
+type loudnessColumns struct {
+	integrated   sql.NullFloat64
+	truePeak     sql.NullFloat64
+	samplePeak   sql.NullFloat64
+	rms          sql.NullFloat64
+	dynamicRange sql.NullFloat64
+}
+
+func (c *loudnessColumns) loudness() *Loudness {
+	if !c.integrated.Valid {
+		return nil
+	}
+	return &Loudness{
+		Integrated:   c.integrated.Float64,
+		TruePeak:     c.truePeak.Float64,
+		SamplePeak:   c.samplePeak.Float64,
+		RMS:          c.rms.Float64,
+		DynamicRange: c.dynamicRange.Float64,
+	}
+}
+
+// HasLoudness reports whether loudness of the blob was analyzed.
+func HasLoudness(ctx context.Context, hash string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM loudness WHERE blob_hash=?)", hash).Scan(&exists)
+	return exists, err
+}
+
+// SetLoudness inserts or replaces blob's loudness. Nothing is stored if the
+// blob was deleted meanwhile.
+func SetLoudness(ctx context.Context, hash string, l *Loudness, created time.Time) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO loudness (blob_hash, integrated, true_peak, sample_peak, rms, dynamic_range, created) "+
+			"SELECT hash, ?, ?, ?, ?, ?, ? FROM `blob` WHERE hash=? "+
+			"ON DUPLICATE KEY UPDATE integrated=VALUES(integrated), true_peak=VALUES(true_peak), "+
+			"sample_peak=VALUES(sample_peak), rms=VALUES(rms), dynamic_range=VALUES(dynamic_range), created=VALUES(created)",
+		l.Integrated,
+		l.TruePeak,
+		l.SamplePeak,
+		l.RMS,
+		l.DynamicRange,
+		created,
+		hash,
+	)
+	return err
+}
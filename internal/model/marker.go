@@ -0,0 +1,161 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sewiti/munit-backend/pkg/audio"
+)
+
+// Limits of file's markers.
+const (
+	maxMarkers    = 256
+	maxMarkerName = 64
+	maxMarkerNote = 1024
+	markerSlack   = 0.001 // Seconds past the end allowed, as duration is stored in milliseconds
+)
+
+// ErrNotWAV is returned when embedding markers, if file is not a WAV file.
+var ErrNotWAV = errors.New("file is not a WAV file")
+
+// Marker is a song section marker of a WAV file, e.g. intro, verse or chorus.
+type Marker struct {
+	Name  string   `json:"name"`
+	Start float64  `json:"start"` // Seconds
+	End   *float64 `json:"end"`   // Seconds, nil if at a position
+	Note  string   `json:"note"`
+}
+
+// isWAV reports whether file has WAV markers.
+func isWAV(a *Audio) bool {
+	return a != nil && a.Format == "wav" && a.SampleRate > 0
+}
+
+// parseMarkers reads markers from cue points of WAV file's data, ordered by
+// start. Returns nil if data is not a WAV file, and none if it's malformed, as
+// with parseAudio. Markers are fit into the limits of validateMarkers: those
+// past the end of the file or over the limit are dropped, long names and notes
+// are truncated.
+func parseMarkers(data []byte, a *Audio) []Marker {
+	if !isWAV(a) {
+		return nil
+	}
+	markers := make([]Marker, 0)
+	cues, err := audio.ReadMarkers(data)
+	if err != nil {
+		return markers
+	}
+	rate := float64(a.SampleRate)
+	for _, c := range cues {
+		m := Marker{
+			Name:  truncate(c.Label, maxMarkerName),
+			Start: float64(c.Offset) / rate,
+			Note:  truncate(c.Note, maxMarkerNote),
+		}
+		if m.Start > a.Duration+markerSlack {
+			continue
+		}
+		if c.Length > 0 {
+			end := math.Min((float64(c.Offset)+float64(c.Length))/rate, a.Duration)
+			if end > m.Start {
+				m.End = &end
+			}
+		}
+		markers = append(markers, m)
+	}
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Start < markers[j].Start })
+	if len(markers) > maxMarkers {
+		markers = markers[:maxMarkers]
+	}
+	return markers
+}
+
+// truncate truncates s to at most n bytes, without splitting a UTF-8 encoded
+// rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// validateMarkers validates markers of a file with audio a and orders them by
+// start.
+func validateMarkers(markers []Marker, a *Audio) error {
+	if markers == nil {
+		return nil
+	}
+	if !isWAV(a) {
+		return errors.New("file: markers: only WAV files have markers")
+	}
+	if len(markers) > maxMarkers {
+		return fmt.Errorf("file: markers: too many, max %d", maxMarkers)
+	}
+	for _, m := range markers {
+		if len(m.Name) > maxMarkerName {
+			return fmt.Errorf("file: marker: name is too long, max %d", maxMarkerName)
+		}
+		if len(m.Note) > maxMarkerNote {
+			return fmt.Errorf("file: marker: note is too long, max %d", maxMarkerNote)
+		}
+		end := m.Start
+		if m.Start < 0 {
+			return errors.New("file: marker: start must not be negative")
+		}
+		if m.End != nil {
+			if *m.End <= m.Start {
+				return errors.New("file: marker: end must be after start")
+			}
+			end = *m.End
+		}
+		if end > a.Duration+markerSlack {
+			return errors.New("file: marker: past the end of the file")
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Start < markers[j].Start })
+	return nil
+}
+
+func newMarkersColumn(markers []Marker) (jsonColumn, error) {
+	return newJSONColumn(markers, markers == nil)
+}
+
+func (c *jsonColumn) markers() []Marker {
+	var markers []Marker
+	if !c.decode(&markers) {
+		return nil
+	}
+	return markers
+}
+
+// EmbedMarkers returns file's data with its markers written as cue points,
+// replacing those in the data.
+func EmbedMarkers(f *File) ([]byte, error) {
+	if !isWAV(f.Audio) {
+		return nil, ErrNotWAV
+	}
+	rate := float64(f.Audio.SampleRate)
+	frames := func(sec float64) uint32 {
+		return uint32(math.Min(math.Round(sec*rate), math.MaxUint32))
+	}
+
+	cues := make([]audio.Marker, 0, len(f.Markers))
+	for _, m := range f.Markers {
+		c := audio.Marker{
+			Offset: frames(m.Start),
+			Label:  m.Name,
+			Note:   m.Note,
+		}
+		if m.End != nil {
+			c.Length = frames(*m.End) - c.Offset
+		}
+		cues = append(cues, c)
+	}
+	return audio.WriteMarkers(f.Data, cues)
+}
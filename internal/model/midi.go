@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/sewiti/munit-backend/pkg/midi"
+)
+
+// parseMIDI summarizes Standard MIDI File in file's data. Returns nil if data
+// is not a MIDI file or it's malformed, as with parseAudio.
+func parseMIDI(data []byte) *midi.Summary {
+	if !midi.IsMIDI(data) {
+		return nil
+	}
+	s, err := midi.Parse(data)
+	if err != nil {
+		return nil
+	}
+	return s.Summary()
+}
+
+func newMIDIColumn(s *midi.Summary) (jsonColumn, error) {
+	return newJSONColumn(s, s == nil)
+}
+
+func (c *jsonColumn) midi() *midi.Summary {
+	s := new(midi.Summary)
+	if !c.decode(s) {
+		return nil
+	}
+	return s
+}
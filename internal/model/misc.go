@@ -1,17 +1,33 @@
 package model
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"unicode"
 
 	"github.com/go-sql-driver/mysql"
 )
 
+// querier is either *sql.DB or *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 type scanner interface {
 	Scan(...interface{}) error
 }
 
-var ErrNotFound = errors.New("resource not found")
+// execer is either *sql.DB or *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+var (
+	ErrNotFound     = errors.New("resource not found")
+	ErrOwnsProjects = errors.New("user owns projects, transfer or delete them first")
+)
 
 func stringMadeOf(s string, ranges ...*unicode.RangeTable) bool {
 	for _, r := range s {
@@ -26,3 +42,39 @@ func isDuplicate(err error) bool {
 	sqlErr, ok := err.(*mysql.MySQLError)
 	return ok && sqlErr.Number == 1062
 }
+
+// marshalStrings encodes ss for a JSON column. Nil is stored as an empty list.
+func marshalStrings(ss []string) []byte {
+	if ss == nil {
+		return []byte("[]")
+	}
+	data, _ := json.Marshal(ss) // cannot fail for strings
+	return data
+}
+
+func unmarshalStrings(data []byte) ([]string, error) {
+	ss := make([]string, 0)
+	if len(data) == 0 {
+		return ss, nil
+	}
+	return ss, json.Unmarshal(data, &ss)
+}
+
+// jsonColumn is a nullable JSON column.
+type jsonColumn sql.NullString
+
+func newJSONColumn(v interface{}, null bool) (jsonColumn, error) {
+	if null {
+		return jsonColumn{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return jsonColumn{}, err
+	}
+	return jsonColumn{String: string(data), Valid: true}, nil
+}
+
+// decode decodes column into v. Reports false if it's NULL or malformed.
+func (c *jsonColumn) decode(v interface{}) bool {
+	return c.Valid && json.Unmarshal([]byte(c.String), v) == nil
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	projectMusicColumns = "p.bpm, p.music_key, p.time_signature, p.genre, p.isrc, p.working_title"
+	commitMusicColumns  = "c.bpm, c.music_key, c.time_signature, c.genre, c.isrc, c.working_title"
+)
+
+var (
+	keyPattern  = regexp.MustCompile(`^[A-G][#b]? (major|minor)$`)
+	isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+)
+
+// Music is musical metadata of a project. Empty values are unknown.
+type Music struct {
+	BPM           float64 `json:"bpm"`
+	Key           string  `json:"key"`           // e.g. "F# minor"
+	TimeSignature string  `json:"timeSignature"` // e.g. "6/8"
+	Genre         string  `json:"genre"`
+	ISRC          string  `json:"isrc"` // e.g. "USRC17607839", without hyphens
+	WorkingTitle  string  `json:"workingTitle"`
+}
+
+func (m *Music) validate() error {
+	const (
+		minBPM          = 1
+		maxBPM          = 999
+		maxGenre        = 64
+		maxWorkingTitle = 72
+	)
+	if m.BPM != 0 && (m.BPM < minBPM || m.BPM > maxBPM) {
+		return fmt.Errorf("bpm: must be between %d and %d", minBPM, maxBPM)
+	}
+	if m.Key != "" && !keyPattern.MatchString(m.Key) {
+		return errors.New(`key: must be a tonic and major or minor, e.g. "F# minor"`)
+	}
+	if m.TimeSignature != "" && !validTimeSignature(m.TimeSignature) {
+		return errors.New(`time signature: must be a numerator and a power of 2 denominator, e.g. "6/8"`)
+	}
+	if len(m.Genre) > maxGenre {
+		return fmt.Errorf("genre: too long, max %d", maxGenre)
+	}
+	if m.ISRC != "" && !isrcPattern.MatchString(m.ISRC) {
+		return errors.New(`isrc: must be 12 characters without hyphens, e.g. "USRC17607839"`)
+	}
+	if len(m.WorkingTitle) > maxWorkingTitle {
+		return fmt.Errorf("working title: too long, max %d", maxWorkingTitle)
+	}
+	return nil
+}
+
+func validTimeSignature(s string) bool {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return false
+	}
+	num, err := strconv.Atoi(parts[0])
+	if err != nil || num < 1 || num > 32 || parts[0] != strconv.Itoa(num) {
+		return false
+	}
+	den, err := strconv.Atoi(parts[1])
+	if err != nil || den < 1 || den > 64 || den&(den-1) != 0 || parts[1] != strconv.Itoa(den) {
+		return false
+	}
+	return true
+}
+
+// MusicOverride overrides project's musical metadata in a commit, e.g. when
+// tempo changes between versions. Nil values are inherited from the project.
+type MusicOverride struct {
+	BPM           *float64 `json:"bpm"`
+	Key           *string  `json:"key"`
+	TimeSignature *string  `json:"timeSignature"`
+	Genre         *string  `json:"genre"`
+	ISRC          *string  `json:"isrc"`
+	WorkingTitle  *string  `json:"workingTitle"`
+}
+
+func (o *MusicOverride) validate() error {
+	var m Music
+	o.apply(&m)
+	return m.validate()
+}
+
+// apply overrides m's values.
+func (o *MusicOverride) apply(m *Music) {
+	if o.BPM != nil {
+		m.BPM = *o.BPM
+	}
+	if o.Key != nil {
+		m.Key = *o.Key
+	}
+	if o.TimeSignature != nil {
+		m.TimeSignature = *o.TimeSignature
+	}
+	if o.Genre != nil {
+		m.Genre = *o.Genre
+	}
+	if o.ISRC != nil {
+		m.ISRC = *o.ISRC
+	}
+	if o.WorkingTitle != nil {
+		m.WorkingTitle = *o.WorkingTitle
+	}
+}
+
+// ProjectFilter filters project listings by musical metadata. Zero values
+// match all projects.
+type ProjectFilter struct {
+	MinBPM        float64
+	MaxBPM        float64
+	Key           string
+	TimeSignature string
+	Genre         string
+}
+
+// condition returns filter's SQL condition on project p, prefixed by AND, and
+// its arguments.
+func (f *ProjectFilter) condition() (string, []interface{}) {
+	var (
+		cond strings.Builder
+		args []interface{}
+	)
+	add := func(c string, arg interface{}) {
+		cond.WriteString(" AND " + c)
+		args = append(args, arg)
+	}
+	if f.MinBPM > 0 {
+		add("p.bpm>=?", f.MinBPM)
+	}
+	if f.MaxBPM > 0 {
+		add("p.bpm<=?", f.MaxBPM)
+	}
+	if f.Key != "" {
+		add("p.music_key=?", f.Key)
+	}
+	if f.TimeSignature != "" {
+		add("p.time_signature=?", f.TimeSignature)
+	}
+	if f.Genre != "" {
+		add("p.genre=?", f.Genre)
+	}
+	return cond.String(), args
+}
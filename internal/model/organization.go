@@ -0,0 +1,349 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	orgSelect     = "SELECT id, name, description, created, modified FROM organization"
+	orgSelectID   = orgSelect + " WHERE id=?"
+	orgSelectUser = orgSelect + " WHERE id IN (SELECT org_id FROM org_member WHERE user_id=?) ORDER BY name, id"
+)
+
+var (
+	ErrLastOrgAdmin   = errors.New("user is the last admin of an organization, appoint another admin first")
+	ErrOrgOwnsProject = errors.New("organization owns projects, transfer or delete them first")
+)
+
+// OrgRole is a user's role in an organization. Admins manage the organization
+// and have owner's rights on all of its projects.
+type OrgRole string
+
+const (
+	OrgRoleMember OrgRole = "member"
+	OrgRoleAdmin  OrgRole = "admin"
+)
+
+func (r OrgRole) Validate() error {
+	switch r {
+	case OrgRoleMember, OrgRoleAdmin:
+		return nil
+	}
+	return fmt.Errorf("invalid organization role: %q", r)
+}
+
+// Organization owns projects on behalf of its members, so that projects
+// outlive any single user's account.
+type Organization struct {
+	ID          id.ID       `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Created     time.Time   `json:"created"`
+	Modified    time.Time   `json:"modified"`
+	Members     []OrgMember `json:"members"`
+}
+
+type OrgMember struct {
+	User id.ID   `json:"userID"`
+	Role OrgRole `json:"role"`
+}
+
+func (o *Organization) scan(sc scanner) (*Organization, error) {
+	return o, sc.Scan(
+		&o.ID,
+		&o.Name,
+		&o.Description,
+		&o.Created,
+		&o.Modified,
+	)
+}
+
+func (o *Organization) validate() error {
+	const (
+		maxName        = 72
+		maxDescription = 1024
+	)
+
+	if err := o.ID.Validate(); err != nil {
+		return fmt.Errorf("organization: %w", err)
+	}
+	if o.Name == "" {
+		return errors.New("organization: name is empty")
+	}
+	if len(o.Name) > maxName {
+		return fmt.Errorf("organization: name is too long, max %d", maxName)
+	}
+	if len(o.Description) > maxDescription {
+		return fmt.Errorf("organization: description is too long, max %d", maxDescription)
+	}
+
+	admins := 0
+	seen := make(map[id.ID]bool, len(o.Members))
+	for _, m := range o.Members {
+		if err := m.User.Validate(); err != nil {
+			return fmt.Errorf("organization: member: %w", err)
+		}
+		if err := m.Role.Validate(); err != nil {
+			return fmt.Errorf("organization: member: %w", err)
+		}
+		if seen[m.User] {
+			return fmt.Errorf("organization: member %s is listed twice", m.User)
+		}
+		seen[m.User] = true
+		if m.Role == OrgRoleAdmin {
+			admins++
+		}
+	}
+	if admins == 0 {
+		return errors.New("organization: must have at least one admin")
+	}
+	return nil
+}
+
+// RoleOf returns user's role in the organization.
+// Returns false if user is not a member.
+func (o *Organization) RoleOf(uid id.ID) (OrgRole, bool) {
+	for _, m := range o.Members {
+		if m.User == uid {
+			return m.Role, true
+		}
+	}
+	return "", false
+}
+
+func GetOrganization(ctx context.Context, oid id.ID) (*Organization, error) {
+	o, err := new(Organization).scan(db.QueryRowContext(ctx, orgSelectID, oid))
+	if err != nil {
+		return nil, err
+	}
+	o.Members, err = selectOrgMembers(ctx, db, oid)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetUserOrganizations returns organizations the user is a member of.
+func GetUserOrganizations(ctx context.Context, uid id.ID) ([]Organization, error) {
+	rows, err := db.QueryContext(ctx, orgSelectUser, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]Organization, 0)
+	for rows.Next() {
+		o, err := new(Organization).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		orgs = append(orgs, *o)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	for i := range orgs {
+		orgs[i].Members, err = selectOrgMembers(ctx, db, orgs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return orgs, nil
+}
+
+func selectOrgMembers(ctx context.Context, q querier, oid id.ID) ([]OrgMember, error) {
+	rows, err := q.QueryContext(ctx, "SELECT user_id, role FROM org_member WHERE org_id=? ORDER BY user_id", oid)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]OrgMember, 0)
+	for rows.Next() {
+		var m OrgMember
+		if err = rows.Scan(&m.User, &m.Role); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func InsertOrganization(ctx context.Context, o *Organization) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO organization (id, name, description, created, modified) VALUES (?,?,?,?,?)",
+		o.ID,
+		o.Name,
+		o.Description,
+		o.Created,
+		o.Modified,
+	)
+	if err != nil {
+		return err
+	}
+	if err = insertOrgMembers(ctx, tx, o); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateOrganization updates organization and its members. Removed members are
+// removed from organization's teams as well.
+func UpdateOrganization(ctx context.Context, oid id.ID, modifyFn func(*Organization) error) (*Organization, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	o, err := new(Organization).scan(tx.QueryRowContext(ctx, orgSelectID+" FOR UPDATE", oid))
+	if err != nil {
+		return nil, err
+	}
+	o.Members, err = selectOrgMembers(ctx, tx, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = modifyFn(o); err != nil {
+		return nil, err
+	}
+	if err = o.validate(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE organization SET name=?, description=?, modified=? WHERE id=?",
+		o.Name,
+		o.Description,
+		o.Modified,
+		oid,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_member WHERE org_id=?", oid)
+	if err != nil {
+		return nil, err
+	}
+	if err = insertOrgMembers(ctx, tx, o); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"DELETE tm FROM team_member tm JOIN team t ON t.id=tm.team_id "+
+			"WHERE t.org_id=? AND tm.user_id NOT IN (SELECT user_id FROM org_member WHERE org_id=?)",
+		oid, oid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, tx.Commit()
+}
+
+func insertOrgMembers(ctx context.Context, tx *sql.Tx, o *Organization) error {
+	for _, m := range o.Members {
+		// Verify that user exists
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user WHERE id=?)", m.User).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("organization: member %s does not exist", m.User)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO org_member (org_id, user_id, role) VALUES (?,?,?)",
+			o.ID, m.User, m.Role,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteOrganization deletes organization with its teams. ErrOrgOwnsProject
+// is returned if it still owns any projects.
+func DeleteOrganization(ctx context.Context, oid id.ID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owns bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM project WHERE org_id=?)", oid).Scan(&owns)
+	if err != nil {
+		return err
+	}
+	if owns {
+		return ErrOrgOwnsProject
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE tp FROM team_project tp JOIN team t ON t.id=tp.team_id WHERE t.org_id=?", oid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE tm FROM team_member tm JOIN team t ON t.id=tm.team_id WHERE t.org_id=?", oid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM team WHERE org_id=?", oid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_member WHERE org_id=?", oid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_invitation WHERE org_id=?", oid)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM organization WHERE id=?", oid)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,233 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	orgInvitationSelect        = "SELECT id, token_hash, email, role, created, expires, org_id, inviter_id, user_id FROM org_invitation"
+	orgInvitationSelectID      = orgInvitationSelect + " WHERE org_id=? AND id=?"
+	orgInvitationSelectToken   = orgInvitationSelect + " WHERE token_hash=?"
+	orgInvitationSelectAllOID  = orgInvitationSelect + " WHERE org_id=?"
+	orgInvitationSelectPending = orgInvitationSelect + " WHERE user_id=? AND expires>?"
+
+	orgInvitationInsert = "INSERT INTO org_invitation (id, token_hash, email, role, created, expires, org_id, inviter_id, user_id) VALUES (?,?,?,?,?,?,?,?,?)"
+)
+
+// OrgInvitation invites a user to join an organization. Users become members
+// only by accepting one.
+type OrgInvitation struct {
+	ID      id.ID     `json:"id"`
+	Token   string    `json:"-"` // Only known on creation, mailed to the invitee
+	Email   string    `json:"email"`
+	Role    OrgRole   `json:"role"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	Org     id.ID `json:"orgID"`
+	Inviter id.ID `json:"inviterID"`
+	User    id.ID `json:"userID"`
+
+	TokenHash string `json:"-"` // See auth.HashToken
+}
+
+func (inv *OrgInvitation) scan(sc scanner) (*OrgInvitation, error) {
+	return inv, sc.Scan(
+		&inv.ID,
+		&inv.TokenHash,
+		&inv.Email,
+		&inv.Role,
+		&inv.Created,
+		&inv.Expires,
+		&inv.Org,
+		&inv.Inviter,
+		&inv.User,
+	)
+}
+
+func (inv *OrgInvitation) validate() error {
+	if err := inv.ID.Validate(); err != nil {
+		return fmt.Errorf("invitation: %w", err)
+	}
+	if inv.TokenHash == "" {
+		return errors.New("invitation: token hash is empty")
+	}
+	if err := inv.Role.Validate(); err != nil {
+		return fmt.Errorf("invitation: %w", err)
+	}
+	if !inv.Expires.After(inv.Created) {
+		return errors.New("invitation: expiry must be in the future")
+	}
+	if inv.Expires.Sub(inv.Created) > MaxInvitationExpiry {
+		return fmt.Errorf("invitation: expiry is too far, max %v", MaxInvitationExpiry)
+	}
+
+	if err := inv.Org.Validate(); err != nil {
+		return fmt.Errorf("invitation: organization: %w", err)
+	}
+	if err := inv.Inviter.Validate(); err != nil {
+		return fmt.Errorf("invitation: inviter: %w", err)
+	}
+	if err := inv.User.Validate(); err != nil {
+		return fmt.Errorf("invitation: user: %w", err)
+	}
+	return nil
+}
+
+func GetOrgInvitation(ctx context.Context, oid, iid id.ID) (*OrgInvitation, error) {
+	row := db.QueryRowContext(ctx, orgInvitationSelectID, oid, iid)
+	return new(OrgInvitation).scan(row)
+}
+
+// GetAllOrgInvitations returns all organization's invitations, including
+// expired ones.
+func GetAllOrgInvitations(ctx context.Context, oid id.ID) ([]OrgInvitation, error) {
+	rows, err := db.QueryContext(ctx, orgInvitationSelectAllOID, oid)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrgInvitations(rows)
+}
+
+// GetPendingOrgInvitations returns user's organization invitations that have
+// not expired yet.
+func GetPendingOrgInvitations(ctx context.Context, uid id.ID) ([]OrgInvitation, error) {
+	rows, err := db.QueryContext(ctx, orgInvitationSelectPending, uid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return scanOrgInvitations(rows)
+}
+
+func scanOrgInvitations(rows *sql.Rows) ([]OrgInvitation, error) {
+	invitations := make([]OrgInvitation, 0)
+	for rows.Next() {
+		inv, err := new(OrgInvitation).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func InsertOrgInvitation(ctx context.Context, inv *OrgInvitation) error {
+	if err := inv.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, orgInvitationInsert,
+		inv.ID,
+		inv.TokenHash,
+		inv.Email,
+		inv.Role,
+		inv.Created,
+		inv.Expires,
+		inv.Org,
+		inv.Inviter,
+		inv.User,
+	)
+	if err != nil {
+		if isDuplicate(err) {
+			return errors.New("user is already invited")
+		}
+		return err
+	}
+	return nil
+}
+
+// AcceptOrgInvitation adds user to the organization with invitation's role and
+// removes the invitation.
+func AcceptOrgInvitation(ctx context.Context, hash string, uid id.ID) (*OrgInvitation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, orgInvitationSelectToken, hash)
+	inv, err := new(OrgInvitation).scan(row)
+	if err != nil {
+		return nil, err
+	}
+	if inv.User != uid {
+		return nil, ErrNotFound // do not reveal others' invitations
+	}
+	if inv.Expires.Before(time.Now()) {
+		return nil, ErrInvitationExpired
+	}
+
+	// Lock the organization, as UpdateOrganization rewrites its members.
+	var oid id.ID
+	err = tx.QueryRowContext(ctx, "SELECT id FROM organization WHERE id=? FOR UPDATE", inv.Org).Scan(&oid)
+	if err != nil {
+		return nil, err
+	}
+	var member bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM org_member WHERE org_id=? AND user_id=?)", inv.Org, uid,
+	).Scan(&member)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO org_member (org_id, user_id, role) VALUES (?,?,?)",
+			inv.Org, inv.User, inv.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_invitation WHERE id=?", inv.ID)
+	if err != nil {
+		return nil, err
+	}
+	return inv, tx.Commit()
+}
+
+// DeclineOrgInvitation removes user's organization invitation.
+func DeclineOrgInvitation(ctx context.Context, hash string, uid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM org_invitation WHERE token_hash=? AND user_id=?", hash, uid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func DeleteOrgInvitation(ctx context.Context, oid, iid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM org_invitation WHERE org_id=? AND id=?", oid, iid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Peaks are waveform peaks of a blob, generated in background. They are
+// shared by all files with the same contents.
+type Peaks struct {
+	Hash    string // Blob hash
+	Data    []byte // Encoded peaks, nil if generation failed
+	Error   string // Why generation failed
+	Created time.Time
+}
+
+func GetPeaks(ctx context.Context, hash string) (*Peaks, error) {
+	var (
+		p       = Peaks{Hash: hash}
+		errText sql.NullString
+	)
+	err := db.QueryRowContext(ctx,
+		"SELECT data, error, created FROM peaks WHERE blob_hash=?", hash,
+	).Scan(&p.Data, &errText, &p.Created)
+	if err != nil {
+		return nil, err
+	}
+	p.Error = errText.String
+	return &p, nil
+}
+
+// SetPeaks inserts or replaces blob's peaks. Nothing is stored if the blob was
+// deleted meanwhile.
+func SetPeaks(ctx context.Context, p *Peaks) error {
+	errText := sql.NullString{String: p.Error, Valid: p.Error != ""}
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO peaks (blob_hash, data, error, created) SELECT hash, ?, ?, ? FROM `blob` WHERE hash=? "+
+			"ON DUPLICATE KEY UPDATE data=VALUES(data), error=VALUES(error), created=VALUES(created)",
+		p.Data,
+		errText,
+		p.Created,
+		p.Hash,
+	)
+	return err
+}
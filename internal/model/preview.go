@@ -0,0 +1,63 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Preview is a lightweight rendition of a blob for auditioning, in a format
+// and at most a sample rate, generated in background. Like peaks, it's shared
+// by all files with the same contents.
+type Preview struct {
+	Hash        string // Blob hash
+	Format      string
+	SampleRate  int // Max, lower if blob's is
+	ContentType string
+	Data        []byte // Encoded audio, nil if generation failed
+	Error       string // Why generation failed
+	Created     time.Time
+}
+
+func GetPreview(ctx context.Context, hash, format string, rate int) (*Preview, error) {
+	var (
+		p       = Preview{Hash: hash, Format: format, SampleRate: rate}
+		errText sql.NullString
+	)
+	err := db.QueryRowContext(ctx,
+		"SELECT content_type, data, error, created FROM preview WHERE blob_hash=? AND format=? AND sample_rate=?", hash, format, rate,
+	).Scan(&p.ContentType, &p.Data, &errText, &p.Created)
+	if err != nil {
+		return nil, err
+	}
+	p.Error = errText.String
+	return &p, nil
+}
+
+// HasPreview reports whether preview of the blob in the format and at the
+// sample rate was generated.
+func HasPreview(ctx context.Context, hash, format string, rate int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM preview WHERE blob_hash=? AND format=? AND sample_rate=?)", hash, format, rate,
+	).Scan(&exists)
+	return exists, err
+}
+
+// SetPreview inserts or replaces blob's preview in its format and at its
+// sample rate. Nothing is stored if the blob was deleted meanwhile.
+func SetPreview(ctx context.Context, p *Preview) error {
+	errText := sql.NullString{String: p.Error, Valid: p.Error != ""}
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO preview (blob_hash, format, sample_rate, content_type, data, error, created) SELECT hash, ?, ?, ?, ?, ?, ? FROM `blob` WHERE hash=? "+
+			"ON DUPLICATE KEY UPDATE content_type=VALUES(content_type), data=VALUES(data), error=VALUES(error), created=VALUES(created)",
+		p.Format,
+		p.SampleRate,
+		p.ContentType,
+		p.Data,
+		errText,
+		p.Created,
+		p.Hash,
+	)
+	return err
+}
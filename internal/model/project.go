@@ -11,30 +11,114 @@ import (
 	"github.com/sewiti/munit-backend/pkg/id"
 )
 
-type Project struct {
-	ID          id.ID     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Created     time.Time `json:"created"`
-	Modified    time.Time `json:"modified"`
+const (
+	projectSelect   = "SELECT p.id, p.name, p.description, p.visibility, p.created, p.modified, p.owner_id, p.org_id, p.upstream_id, " + projectMusicColumns + ", c.user_id, c.role FROM project p LEFT JOIN contributor c ON p.id=c.project_id"
+	projectSelectID = projectSelect + " WHERE p.id=?"
+
+	// projectAssociate is a condition on project p, matching projects the user
+	// is associated with directly or through an organization. User is given as
+	// arguments, see associateArgs.
+	projectAssociate = "(p.owner_id=? OR p.id IN (SELECT project_id FROM contributor WHERE user_id=?)" +
+		" OR p.org_id IN (SELECT org_id FROM org_member WHERE user_id=? AND role='admin')" +
+		" OR p.id IN (SELECT tp.project_id FROM team_project tp JOIN team_member tm ON tm.team_id=tp.team_id WHERE tm.user_id=?))"
+)
+
+// associateArgs returns arguments of projectAssociate for the user.
+func associateArgs(uid id.ID) []interface{} {
+	return []interface{}{uid, uid, uid, uid}
+}
+
+// Role is a user's role in a project.
+type Role string
+
+const (
+	RoleContributor Role = "contributor"
+	RoleMaintainer  Role = "maintainer"
+	RoleOwner       Role = "owner"
+)
+
+var roleRank = map[Role]int{
+	RoleContributor: 1,
+	RoleMaintainer:  2,
+	RoleOwner:       3,
+}
+
+// Visibility is who can see a project besides its associates.
+type Visibility string
+
+const (
+	VisibilityPrivate  Visibility = "private"  // Associates only
+	VisibilityUnlisted Visibility = "unlisted" // Anyone knowing project's ID can read it
+	VisibilityPublic   Visibility = "public"   // Unlisted and listed in the directory
+)
 
-	Owner        id.ID   `json:"ownerID"`
+func (v Visibility) Validate() error {
+	switch v {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return nil
+	}
+	return fmt.Errorf("invalid visibility: %q", v)
+}
+
+// Validate checks whether role can be assigned to a contributor.
+func (r Role) Validate() error {
+	switch r {
+	case RoleContributor, RoleMaintainer:
+		return nil
+	}
+	return fmt.Errorf("invalid role: %q", r)
+}
+
+type Project struct {
+	ID          id.ID      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	Created     time.Time  `json:"created"`
+	Modified    time.Time  `json:"modified"`
+
+	Owner        id.ID   `json:"ownerID"`                  // Empty, if owned by an organization
+	Org          id.ID   `json:"organizationID,omitempty"` // Empty, if owned by a user
 	Contributors []id.ID `json:"contributors"`
+	Maintainers  []id.ID `json:"maintainers"`
+
+	Upstream id.ID `json:"upstreamID,omitempty"` // Project this one was forked from
+
+	Music // Overridable by commits
+
+	// orgRoles are roles given by the owning organization: owner to its admins
+	// and team roles to team members. See loadOrgRoles.
+	orgRoles map[id.ID]Role
 }
 
 func (p *Project) scan(sc scanner) error {
 	var uid *id.ID
+	var role *Role
 	err := sc.Scan(
 		&p.ID,
 		&p.Name,
 		&p.Description,
+		&p.Visibility,
 		&p.Created,
 		&p.Modified,
 		&p.Owner,
+		&p.Org,
+		&p.Upstream,
+		&p.BPM,
+		&p.Key,
+		&p.TimeSignature,
+		&p.Genre,
+		&p.ISRC,
+		&p.WorkingTitle,
 		&uid,
+		&role,
 	)
 	if uid != nil {
-		p.Contributors = append(p.Contributors, *uid)
+		if role != nil && *role == RoleMaintainer {
+			p.Maintainers = append(p.Maintainers, *uid)
+		} else {
+			p.Contributors = append(p.Contributors, *uid)
+		}
 	}
 	return err
 }
@@ -48,8 +132,24 @@ func (p *Project) validate() error {
 	if err := p.ID.Validate(); err != nil {
 		return fmt.Errorf("project: %w", err)
 	}
-	if err := p.Owner.Validate(); err != nil {
-		return fmt.Errorf("project: owner: %w", err)
+	switch {
+	case p.Owner == "" && p.Org == "":
+		return errors.New("project: owner is empty")
+	case p.Owner != "" && p.Org != "":
+		return errors.New("project: cannot be owned by both a user and an organization")
+	case p.Org != "":
+		if err := p.Org.Validate(); err != nil {
+			return fmt.Errorf("project: organization: %w", err)
+		}
+	default:
+		if err := p.Owner.Validate(); err != nil {
+			return fmt.Errorf("project: owner: %w", err)
+		}
+	}
+	if p.Upstream != "" {
+		if err := p.Upstream.Validate(); err != nil {
+			return fmt.Errorf("project: upstream: %w", err)
+		}
 	}
 
 	// Name
@@ -65,29 +165,112 @@ func (p *Project) validate() error {
 		return fmt.Errorf("project: description is too long, max %d", maxDescription)
 	}
 
-	// Contributors
+	if err := p.Visibility.Validate(); err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+	if err := p.Music.validate(); err != nil {
+		return fmt.Errorf("project: %w", err)
+	}
+
+	// Contributors & Maintainers
+	seen := make(map[id.ID]bool, len(p.Contributors)+len(p.Maintainers))
 	for _, c := range p.Contributors {
 		if err := c.Validate(); err != nil {
 			return fmt.Errorf("project: contributor: %w", err)
 		}
-		if c == p.Owner {
-			return fmt.Errorf("project: owner cannot be a contributor")
+		if p.Owner != "" && c == p.Owner {
+			return errors.New("project: owner cannot be a contributor")
+		}
+		if seen[c] {
+			return fmt.Errorf("project: contributor %s is listed twice", c)
 		}
+		seen[c] = true
+	}
+	for _, m := range p.Maintainers {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("project: maintainer: %w", err)
+		}
+		if p.Owner != "" && m == p.Owner {
+			return errors.New("project: owner cannot be a maintainer")
+		}
+		if seen[m] {
+			return fmt.Errorf("project: maintainer %s is listed twice", m)
+		}
+		seen[m] = true
 	}
 	return nil
 }
 
+// RoleOf returns user's role in the project.
+// Returns false if user is not associated with the project.
+func (p *Project) RoleOf(uid id.ID) (Role, bool) {
+	if p.Owner != "" && uid == p.Owner {
+		return RoleOwner, true
+	}
+	role, ok := p.orgRoles[uid]
+	for _, m := range p.Maintainers {
+		if uid == m && roleRank[role] < roleRank[RoleMaintainer] {
+			return RoleMaintainer, true
+		}
+	}
+	for _, c := range p.Contributors {
+		if uid == c && !ok {
+			return RoleContributor, true
+		}
+	}
+	return role, ok
+}
+
+// HasRole reports whether user's role in the project is at least min.
+func (p *Project) HasRole(uid id.ID, min Role) bool {
+	role, ok := p.RoleOf(uid)
+	return ok && roleRank[role] >= roleRank[min]
+}
+
 func GetProject(ctx context.Context, pid id.ID) (*Project, error) {
-	rows, err := db.QueryContext(ctx,
-		"SELECT p.id, p.name, p.description, p.created, p.modified, p.owner_id, c.user_id "+
-			"FROM project p LEFT JOIN contributor c ON p.id=c.project_id "+
-			"WHERE p.id=?",
-		pid,
-	)
+	rows, err := db.QueryContext(ctx, projectSelectID, pid)
+	if err != nil {
+		return nil, err
+	}
+	p, err := getProject(rows)
 	if err != nil {
 		return nil, err
 	}
-	return getProject(rows)
+	return p, loadOrgRoles(ctx, db, p)
+}
+
+// loadOrgRoles loads roles given by project's organization, if any.
+func loadOrgRoles(ctx context.Context, q querier, p *Project) error {
+	p.orgRoles = nil
+	if p.Org == "" {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx,
+		"SELECT user_id, ? FROM org_member WHERE org_id=? AND role=? UNION ALL "+
+			"SELECT tm.user_id, tp.role FROM team_project tp JOIN team_member tm ON tm.team_id=tp.team_id WHERE tp.project_id=?",
+		RoleOwner, p.Org, OrgRoleAdmin, p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.orgRoles = make(map[id.ID]Role)
+	for rows.Next() {
+		var uid id.ID
+		var role Role
+		if err = rows.Scan(&uid, &role); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if roleRank[role] > roleRank[p.orgRoles[uid]] {
+			p.orgRoles[uid] = role
+		}
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	return rows.Close()
 }
 
 func getProject(rows *sql.Rows) (*Project, error) {
@@ -111,35 +294,95 @@ func getProject(rows *sql.Rows) (*Project, error) {
 	if p.Contributors == nil {
 		p.Contributors = make([]id.ID, 0)
 	}
+	if p.Maintainers == nil {
+		p.Maintainers = make([]id.ID, 0)
+	}
 	return p, nil
 }
 
-func GetAllProjects(ctx context.Context, uid id.ID) ([]Project, error) {
-	// TODO: Refactor
+func GetAllProjects(ctx context.Context, uid id.ID, filter ProjectFilter) ([]Project, error) {
+	cond, args := filter.condition()
+	rows, err := db.QueryContext(ctx, projectSelect+" WHERE "+projectAssociate+cond+" ORDER BY p.id", append(associateArgs(uid), args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanProjects(rows)
+}
+
+// GetOrgProjects returns projects owned by the organization.
+func GetOrgProjects(ctx context.Context, oid id.ID, filter ProjectFilter) ([]Project, error) {
+	cond, args := filter.condition()
+	rows, err := db.QueryContext(ctx, projectSelect+" WHERE p.org_id=?"+cond+" ORDER BY p.id", append([]interface{}{oid}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanProjects(rows)
+}
+
+// GetPublicProjects returns public projects whose name contains query, most
+// recently modified first.
+func GetPublicProjects(ctx context.Context, query string, filter ProjectFilter, limit, offset int) ([]Project, error) {
+	cond, args := filter.condition()
+	args = append([]interface{}{VisibilityPublic, likePattern(query)}, args...)
+	// Derived table, as MySQL does not support LIMIT in IN subqueries.
+	rows, err := db.QueryContext(ctx,
+		projectSelect+" JOIN (SELECT p.id FROM project p WHERE p.visibility=? AND p.name LIKE ?"+cond+" ORDER BY p.modified DESC, p.id LIMIT ? OFFSET ?) t ON t.id=p.id ORDER BY p.modified DESC, p.id",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanProjects(rows)
+}
+
+// GetSharedProjects returns IDs of projects both users are associated with.
+func GetSharedProjects(ctx context.Context, a, b id.ID) ([]id.ID, error) {
 	rows, err := db.QueryContext(ctx,
-		"SELECT p.id, p.name, p.description, p.created, p.modified, p.owner_id, c.user_id "+
-			"FROM project p LEFT JOIN contributor c ON p.id=c.project_id "+
-			"WHERE p.owner_id=? OR c.user_id=?",
-		uid, uid,
+		"SELECT p.id FROM project p WHERE "+projectAssociate+" AND "+projectAssociate+" ORDER BY p.id",
+		append(associateArgs(a), associateArgs(b)...)...,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	ids := make([]id.ID, 0)
+	for rows.Next() {
+		var pid id.ID
+		if err = rows.Scan(&pid); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		ids = append(ids, pid)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// scanProjects scans rows of projectSelect, which must be ordered by project.
+func scanProjects(rows *sql.Rows) ([]Project, error) {
 	projects := make([]Project, 0)
 	var p Project
 	scan := Project{
 		Contributors: make([]id.ID, 0),
+		Maintainers:  make([]id.ID, 0),
 	}
 
 	for rows.Next() {
-		if err = scan.scan(rows); err != nil {
+		if err := scan.scan(rows); err != nil {
 			_ = rows.Close()
 			return nil, err
 		}
 
 		if p.ID != "" && p.ID != scan.ID {
 			scan.Contributors = scan.Contributors[len(p.Contributors):]
+			scan.Maintainers = scan.Maintainers[len(p.Maintainers):]
 			projects = append(projects, p)
 		}
 		p = scan
@@ -148,11 +391,11 @@ func GetAllProjects(ctx context.Context, uid id.ID) ([]Project, error) {
 		projects = append(projects, p)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		_ = rows.Close()
 		return nil, err
 	}
-	if err = rows.Close(); err != nil {
+	if err := rows.Close(); err != nil {
 		return nil, err
 	}
 	return projects, nil
@@ -169,41 +412,38 @@ func InsertProject(ctx context.Context, p *Project) error {
 	}
 	defer tx.Rollback()
 
+	if err = insertProject(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertProject(ctx context.Context, tx *sql.Tx, p *Project) error {
 	// Project
-	_, err = tx.ExecContext(ctx,
-		"INSERT INTO project (id, name, description, created, modified, owner_id) VALUES (?,?,?,?,?,?)",
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO project (id, name, description, visibility, created, modified, owner_id, org_id, upstream_id, bpm, music_key, time_signature, genre, isrc, working_title) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
 		p.ID,
 		p.Name,
 		p.Description,
+		p.Visibility,
 		p.Created,
 		p.Modified,
 		p.Owner,
+		p.Org,
+		p.Upstream,
+		p.BPM,
+		p.Key,
+		p.TimeSignature,
+		p.Genre,
+		p.ISRC,
+		p.WorkingTitle,
 	)
 	if err != nil {
 		return err
 	}
 
 	// Contributors
-	if len(p.Contributors) > 0 {
-		var query strings.Builder
-		args := make([]interface{}, 0, 2*len(p.Contributors))
-		for i, cid := range p.Contributors {
-			if i == 0 {
-				query.WriteString("INSERT INTO contributor (project_id, user_id) VALUES")
-			} else {
-				query.WriteString(",")
-			}
-			query.WriteString(" (?,?)")
-			args = append(args, p.ID, cid)
-		}
-
-		_, err = tx.ExecContext(ctx, query.String(), args...)
-		if err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit()
+	return insertContributors(ctx, tx, p)
 }
 
 func UpdateProject(ctx context.Context, pid id.ID, modifyFn func(*Project) error) (*Project, error) {
@@ -213,11 +453,7 @@ func UpdateProject(ctx context.Context, pid id.ID, modifyFn func(*Project) error
 	}
 	defer tx.Rollback()
 
-	rows, err := tx.QueryContext(ctx,
-		"SELECT p.id, p.name, p.description, p.created, p.modified, p.owner_id, c.user_id "+
-			"FROM project p LEFT JOIN contributor c ON p.id=c.project_id WHERE p.id=?",
-		pid,
-	)
+	rows, err := tx.QueryContext(ctx, projectSelectID, pid)
 	if err != nil {
 		return nil, err
 	}
@@ -225,6 +461,9 @@ func UpdateProject(ctx context.Context, pid id.ID, modifyFn func(*Project) error
 	if err != nil {
 		return nil, err
 	}
+	if err = loadOrgRoles(ctx, tx, p); err != nil {
+		return nil, err
+	}
 	if err = modifyFn(p); err != nil {
 		return nil, err
 	}
@@ -233,42 +472,90 @@ func UpdateProject(ctx context.Context, pid id.ID, modifyFn func(*Project) error
 	}
 
 	_, err = tx.ExecContext(ctx,
-		"UPDATE project SET name=?, description=?, modified=?, owner_id=? WHERE id=?",
+		"UPDATE project SET name=?, description=?, visibility=?, modified=?, owner_id=?, org_id=?, bpm=?, music_key=?, time_signature=?, genre=?, isrc=?, working_title=? WHERE id=?",
 		p.Name,
 		p.Description,
+		p.Visibility,
 		p.Modified,
 		p.Owner,
+		p.Org,
+		p.BPM,
+		p.Key,
+		p.TimeSignature,
+		p.Genre,
+		p.ISRC,
+		p.WorkingTitle,
 		pid,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// Teams of other organizations lose access, if ownership has changed.
+	_, err = tx.ExecContext(ctx,
+		"DELETE tp FROM team_project tp JOIN team t ON t.id=tp.team_id WHERE tp.project_id=? AND t.org_id<>?",
+		pid, p.Org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = loadOrgRoles(ctx, tx, p); err != nil {
+		return nil, err
+	}
+
 	// Contributors
 	_, err = tx.ExecContext(ctx, "DELETE FROM contributor WHERE project_id=?", pid)
 	if err != nil {
 		return nil, err
 	}
-	if len(p.Contributors) > 0 {
-		var query strings.Builder
-		args := make([]interface{}, 0, 2*len(p.Contributors))
-		for i, cid := range p.Contributors {
-			if i == 0 {
-				query.WriteString("INSERT INTO contributor (project_id, user_id) VALUES")
-			} else {
-				query.WriteString(",")
-			}
-			query.WriteString(" (?,?)")
-			args = append(args, p.ID, cid)
-		}
+	if err = insertContributors(ctx, tx, p); err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+// insertContributors inserts project's contributors and maintainers, verifying
+// that each of them is an existing user.
+func insertContributors(ctx context.Context, tx *sql.Tx, p *Project) error {
+	n := len(p.Contributors) + len(p.Maintainers)
+	if n == 0 {
+		return nil
+	}
 
-		_, err = tx.ExecContext(ctx, query.String(), args...)
+	var query strings.Builder
+	args := make([]interface{}, 0, 3*n)
+	add := func(uid id.ID, role Role) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user WHERE id=?)", uid).Scan(&exists)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("project: %s: user %s does not exist", role, uid)
+		}
+
+		if len(args) == 0 {
+			query.WriteString("INSERT INTO contributor (project_id, user_id, role) VALUES")
+		} else {
+			query.WriteString(",")
+		}
+		query.WriteString(" (?,?,?)")
+		args = append(args, p.ID, uid, role)
+		return nil
+	}
+	for _, uid := range p.Contributors {
+		if err := add(uid, RoleContributor); err != nil {
+			return err
+		}
+	}
+	for _, uid := range p.Maintainers {
+		if err := add(uid, RoleMaintainer); err != nil {
+			return err
 		}
 	}
 
-	return p, tx.Commit()
+	_, err := tx.ExecContext(ctx, query.String(), args...)
+	return err
 }
 
 func DeleteProject(ctx context.Context, pid id.ID) error {
@@ -278,10 +565,24 @@ func DeleteProject(ctx context.Context, pid id.ID) error {
 	}
 	defer tx.Rollback()
 
+	if err = deleteProject(ctx, tx, pid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteProject(ctx context.Context, tx *sql.Tx, pid id.ID) error {
+	hashes, err := selectBlobs(ctx, tx, "project_id=?", pid)
+	if err != nil {
+		return err
+	}
 	_, err = tx.ExecContext(ctx, "DELETE FROM file WHERE project_id=?", pid)
 	if err != nil {
 		return err
 	}
+	if err = deleteUnusedBlobs(ctx, tx, hashes...); err != nil {
+		return err
+	}
 	_, err = tx.ExecContext(ctx, "DELETE FROM commit WHERE project_id=?", pid)
 	if err != nil {
 		return err
@@ -290,6 +591,26 @@ func DeleteProject(ctx context.Context, pid id.ID) error {
 	if err != nil {
 		return err
 	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM invitation WHERE project_id=?", pid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM share WHERE project_id=?", pid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM comment WHERE project_id=?", pid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM team_project WHERE project_id=?", pid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE project SET upstream_id='' WHERE upstream_id=?", pid)
+	if err != nil {
+		return err
+	}
 	res, err := tx.ExecContext(ctx, "DELETE FROM project WHERE id=?", pid)
 	if err != nil {
 		return err
@@ -302,5 +623,5 @@ func DeleteProject(ctx context.Context, pid id.ID) error {
 	if n == 0 {
 		return ErrNotFound
 	}
-	return tx.Commit()
+	return nil
 }
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	shareSelect       = "SELECT id, token_hash, passwd_hash, expires, max_downloads, views, downloads, created, project_id, commit_id, file_id, creator_id FROM share"
+	shareSelectID     = shareSelect + " WHERE project_id=? AND id=?"
+	shareSelectToken  = shareSelect + " WHERE token_hash=?"
+	shareSelectAllPID = shareSelect + " WHERE project_id=? ORDER BY created"
+
+	shareInsert = "INSERT INTO share (id, token_hash, passwd_hash, expires, max_downloads, views, downloads, created, project_id, commit_id, file_id, creator_id) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)"
+)
+
+var (
+	ErrShareExpired   = errors.New("share link has expired")
+	ErrShareExhausted = errors.New("share link has reached its download limit")
+)
+
+// Share is a link giving anyone read access to a project, a commit or a file,
+// depending on which IDs are set.
+type Share struct {
+	ID           id.ID      `json:"id"`
+	Token        string     `json:"token,omitempty"` // Only known on creation
+	Password     string     `json:"password,omitempty"`
+	HasPassword  bool       `json:"hasPassword"`
+	Expires      *time.Time `json:"expires"`      // Never, if nil
+	MaxDownloads int        `json:"maxDownloads"` // Unlimited, if 0
+	Views        int        `json:"views"`
+	Downloads    int        `json:"downloads"`
+	Created      time.Time  `json:"created"`
+
+	Project id.ID `json:"projectID"`
+	Commit  id.ID `json:"commitID,omitempty"` // Whole project, if empty
+	File    id.ID `json:"fileID,omitempty"`   // Whole commit, if empty
+	Creator id.ID `json:"creatorID"`
+
+	TokenHash  string `json:"-"` // See auth.HashToken
+	PasswdHash string `json:"-"` // PHC string format, empty if none
+}
+
+func (s *Share) scan(sc scanner) (*Share, error) {
+	var expires sql.NullTime
+	err := sc.Scan(
+		&s.ID,
+		&s.TokenHash,
+		&s.PasswdHash,
+		&expires,
+		&s.MaxDownloads,
+		&s.Views,
+		&s.Downloads,
+		&s.Created,
+		&s.Project,
+		&s.Commit,
+		&s.File,
+		&s.Creator,
+	)
+	if err != nil {
+		return s, err
+	}
+	s.Expires = nil
+	if expires.Valid {
+		s.Expires = &expires.Time
+	}
+	s.HasPassword = s.PasswdHash != ""
+	return s, nil
+}
+
+func (s *Share) validate() error {
+	if err := s.ID.Validate(); err != nil {
+		return fmt.Errorf("share: %w", err)
+	}
+	if s.TokenHash == "" {
+		return errors.New("share: token hash is empty")
+	}
+	if s.Expires != nil && !s.Expires.After(s.Created) {
+		return errors.New("share: expiry must be in the future")
+	}
+	if s.MaxDownloads < 0 {
+		return errors.New("share: max downloads must not be negative")
+	}
+
+	if err := s.Project.Validate(); err != nil {
+		return fmt.Errorf("share: project: %w", err)
+	}
+	if s.Commit == "" && s.File != "" {
+		return errors.New("share: file: commit is empty")
+	}
+	if s.Commit != "" {
+		if err := s.Commit.Validate(); err != nil {
+			return fmt.Errorf("share: commit: %w", err)
+		}
+	}
+	if s.File != "" {
+		if err := s.File.Validate(); err != nil {
+			return fmt.Errorf("share: file: %w", err)
+		}
+	}
+	if err := s.Creator.Validate(); err != nil {
+		return fmt.Errorf("share: creator: %w", err)
+	}
+	return nil
+}
+
+// Check returns an error if the share can no longer be used.
+func (s *Share) Check(now time.Time) error {
+	if s.Expires != nil && !now.Before(*s.Expires) {
+		return ErrShareExpired
+	}
+	if s.MaxDownloads > 0 && s.Downloads >= s.MaxDownloads {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+// Allows reports whether the share gives access to the commit, and to the
+// file, if fid is not empty.
+func (s *Share) Allows(cid, fid id.ID) bool {
+	if s.Commit != "" && s.Commit != cid {
+		return false
+	}
+	return fid == "" || s.File == "" || s.File == fid
+}
+
+func GetShare(ctx context.Context, pid, sid id.ID) (*Share, error) {
+	row := db.QueryRowContext(ctx, shareSelectID, pid, sid)
+	return new(Share).scan(row)
+}
+
+// GetShareByToken returns the share by its token's hash.
+func GetShareByToken(ctx context.Context, hash string) (*Share, error) {
+	row := db.QueryRowContext(ctx, shareSelectToken, hash)
+	return new(Share).scan(row)
+}
+
+// GetAllShares returns all project's shares, including expired ones.
+func GetAllShares(ctx context.Context, pid id.ID) ([]Share, error) {
+	rows, err := db.QueryContext(ctx, shareSelectAllPID, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, 0)
+	for rows.Next() {
+		s, err := new(Share).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		shares = append(shares, *s)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func InsertShare(ctx context.Context, s *Share) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, shareInsert,
+		s.ID,
+		s.TokenHash,
+		s.PasswdHash,
+		s.Expires,
+		s.MaxDownloads,
+		s.Views,
+		s.Downloads,
+		s.Created,
+		s.Project,
+		s.Commit,
+		s.File,
+		s.Creator,
+	)
+	return err
+}
+
+// CountShareView counts a view of the share.
+func CountShareView(ctx context.Context, sid id.ID) error {
+	_, err := db.ExecContext(ctx, "UPDATE share SET views=views+1 WHERE id=?", sid)
+	return err
+}
+
+// CountShareDownload counts a download of the share. ErrShareExhausted is
+// returned if the download limit has been reached in the meantime.
+func CountShareDownload(ctx context.Context, sid id.ID) error {
+	res, err := db.ExecContext(ctx,
+		"UPDATE share SET downloads=downloads+1 WHERE id=? AND (max_downloads=0 OR downloads<max_downloads)", sid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+func DeleteShare(ctx context.Context, pid, sid id.ID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM share WHERE project_id=? AND id=?", pid, sid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
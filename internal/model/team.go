@@ -0,0 +1,316 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	teamSelect       = "SELECT id, name, created, modified, org_id FROM team"
+	teamSelectID     = teamSelect + " WHERE org_id=? AND id=?"
+	teamSelectAllOID = teamSelect + " WHERE org_id=? ORDER BY name, id"
+)
+
+// Team is a group of organization's members given a role in some of
+// organization's projects.
+type Team struct {
+	ID       id.ID         `json:"id"`
+	Name     string        `json:"name"`
+	Created  time.Time     `json:"created"`
+	Modified time.Time     `json:"modified"`
+	Members  []id.ID       `json:"members"`
+	Projects []TeamProject `json:"projects"`
+
+	Org id.ID `json:"organizationID"`
+}
+
+// TeamProject is the role team's members have in a project.
+type TeamProject struct {
+	Project id.ID `json:"projectID"`
+	Role    Role  `json:"role"`
+}
+
+func (t *Team) scan(sc scanner) (*Team, error) {
+	return t, sc.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Created,
+		&t.Modified,
+		&t.Org,
+	)
+}
+
+func (t *Team) validate() error {
+	const maxName = 72
+
+	if err := t.ID.Validate(); err != nil {
+		return fmt.Errorf("team: %w", err)
+	}
+	if t.Name == "" {
+		return errors.New("team: name is empty")
+	}
+	if len(t.Name) > maxName {
+		return fmt.Errorf("team: name is too long, max %d", maxName)
+	}
+	if err := t.Org.Validate(); err != nil {
+		return fmt.Errorf("team: organization: %w", err)
+	}
+
+	seen := make(map[id.ID]bool, len(t.Members))
+	for _, m := range t.Members {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("team: member: %w", err)
+		}
+		if seen[m] {
+			return fmt.Errorf("team: member %s is listed twice", m)
+		}
+		seen[m] = true
+	}
+	seen = make(map[id.ID]bool, len(t.Projects))
+	for _, p := range t.Projects {
+		if err := p.Project.Validate(); err != nil {
+			return fmt.Errorf("team: project: %w", err)
+		}
+		if err := p.Role.Validate(); err != nil {
+			return fmt.Errorf("team: project: %w", err)
+		}
+		if seen[p.Project] {
+			return fmt.Errorf("team: project %s is listed twice", p.Project)
+		}
+		seen[p.Project] = true
+	}
+	return nil
+}
+
+func GetTeam(ctx context.Context, oid, tid id.ID) (*Team, error) {
+	t, err := new(Team).scan(db.QueryRowContext(ctx, teamSelectID, oid, tid))
+	if err != nil {
+		return nil, err
+	}
+	if err = selectTeamRelations(ctx, db, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func GetAllTeams(ctx context.Context, oid id.ID) ([]Team, error) {
+	rows, err := db.QueryContext(ctx, teamSelectAllOID, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make([]Team, 0)
+	for rows.Next() {
+		t, err := new(Team).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		teams = append(teams, *t)
+	}
+
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	for i := range teams {
+		if err = selectTeamRelations(ctx, db, &teams[i]); err != nil {
+			return nil, err
+		}
+	}
+	return teams, nil
+}
+
+// selectTeamRelations selects team's members and projects.
+func selectTeamRelations(ctx context.Context, q querier, t *Team) error {
+	rows, err := q.QueryContext(ctx, "SELECT user_id FROM team_member WHERE team_id=? ORDER BY user_id", t.ID)
+	if err != nil {
+		return err
+	}
+	t.Members = make([]id.ID, 0)
+	for rows.Next() {
+		var uid id.ID
+		if err = rows.Scan(&uid); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.Members = append(t.Members, uid)
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+
+	rows, err = q.QueryContext(ctx, "SELECT project_id, role FROM team_project WHERE team_id=? ORDER BY project_id", t.ID)
+	if err != nil {
+		return err
+	}
+	t.Projects = make([]TeamProject, 0)
+	for rows.Next() {
+		var p TeamProject
+		if err = rows.Scan(&p.Project, &p.Role); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.Projects = append(t.Projects, p)
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	return rows.Close()
+}
+
+func InsertTeam(ctx context.Context, t *Team) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO team (id, name, created, modified, org_id) VALUES (?,?,?,?,?)",
+		t.ID,
+		t.Name,
+		t.Created,
+		t.Modified,
+		t.Org,
+	)
+	if err != nil {
+		return err
+	}
+	if err = insertTeamRelations(ctx, tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func UpdateTeam(ctx context.Context, oid, tid id.ID, modifyFn func(*Team) error) (*Team, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := new(Team).scan(tx.QueryRowContext(ctx, teamSelectID+" FOR UPDATE", oid, tid))
+	if err != nil {
+		return nil, err
+	}
+	if err = selectTeamRelations(ctx, tx, t); err != nil {
+		return nil, err
+	}
+
+	if err = modifyFn(t); err != nil {
+		return nil, err
+	}
+	if err = t.validate(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE team SET name=?, modified=? WHERE org_id=? AND id=?",
+		t.Name,
+		t.Modified,
+		oid,
+		tid,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = deleteTeamRelations(ctx, tx, tid); err != nil {
+		return nil, err
+	}
+	if err = insertTeamRelations(ctx, tx, t); err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
+
+// insertTeamRelations inserts team's members and projects, which must be
+// member of and owned by team's organization respectively.
+func insertTeamRelations(ctx context.Context, tx *sql.Tx, t *Team) error {
+	for _, uid := range t.Members {
+		var member bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM org_member WHERE org_id=? AND user_id=?)", t.Org, uid,
+		).Scan(&member)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return fmt.Errorf("team: user %s is not a member of the organization", uid)
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO team_member (team_id, user_id) VALUES (?,?)", t.ID, uid)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range t.Projects {
+		var owned bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM project WHERE id=? AND org_id=?)", p.Project, t.Org,
+		).Scan(&owned)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			return fmt.Errorf("team: project %s is not owned by the organization", p.Project)
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO team_project (team_id, project_id, role) VALUES (?,?,?)", t.ID, p.Project, p.Role)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteTeamRelations(ctx context.Context, tx *sql.Tx, tid id.ID) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM team_member WHERE team_id=?", tid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM team_project WHERE team_id=?", tid)
+	return err
+}
+
+func DeleteTeam(ctx context.Context, oid, tid id.ID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM team WHERE org_id=? AND id=?", oid, tid)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if err = deleteTeamRelations(ctx, tx, tid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
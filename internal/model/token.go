@@ -0,0 +1,118 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// TokenPurpose is what a UserToken can be redeemed for.
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail TokenPurpose = "verify-email"
+	TokenResetPasswd TokenPurpose = "reset-passwd"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// UserToken is a single use token sent to the user. Only token's hash is
+// stored.
+type UserToken struct {
+	Hash    string
+	Purpose TokenPurpose
+	Created time.Time
+	Expires time.Time
+
+	User id.ID
+}
+
+func (t *UserToken) validate() error {
+	if t.Hash == "" {
+		return errors.New("token: hash is empty")
+	}
+	switch t.Purpose {
+	case TokenVerifyEmail, TokenResetPasswd:
+	default:
+		return fmt.Errorf("token: invalid purpose: %q", t.Purpose)
+	}
+	if !t.Expires.After(t.Created) {
+		return errors.New("token: expiry must be in the future")
+	}
+	if err := t.User.Validate(); err != nil {
+		return fmt.Errorf("token: user: %w", err)
+	}
+	return nil
+}
+
+// InsertUserToken inserts the token, replacing user's previous tokens of the
+// same purpose.
+func InsertUserToken(ctx context.Context, t *UserToken) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_token WHERE user_id=? AND purpose=?", t.User, t.Purpose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO user_token (hash, purpose, created, expires, user_id) VALUES (?,?,?,?,?)",
+		t.Hash,
+		t.Purpose,
+		t.Created,
+		t.Expires,
+		t.User,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RedeemUserToken updates the user token was issued to, as with UpdateUser,
+// and deletes the token in the same transaction. If modifyFn fails, token is
+// kept. Returns ErrInvalidToken if token does not exist or has expired.
+func RedeemUserToken(ctx context.Context, hash string, purpose TokenPurpose, modifyFn func(*User) error) (*User, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var uid id.ID
+	var expires time.Time
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, expires FROM user_token WHERE hash=? AND purpose=? FOR UPDATE",
+		hash, purpose,
+	).Scan(&uid, &expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if expires.Before(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	u, err := updateUser(ctx, tx, uid, modifyFn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_token WHERE hash=?", hash)
+	if err != nil {
+		return nil, err
+	}
+	return u, tx.Commit()
+}
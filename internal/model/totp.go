@@ -0,0 +1,184 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const (
+	totpSelect   = "SELECT user_id, secret, confirmed, last_step, created FROM user_totp"
+	totpSelectID = totpSelect + " WHERE user_id=?"
+)
+
+var (
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrInvalidRecovery = errors.New("invalid recovery code")
+)
+
+// TOTP is user's time-based one-time password second factor. It becomes
+// effective once Confirmed.
+type TOTP struct {
+	User      id.ID
+	Secret    string
+	Confirmed bool
+	LastStep  int64 // Last accepted time step, used to prevent code replays
+	Created   time.Time
+}
+
+func (t *TOTP) scan(sc scanner) (*TOTP, error) {
+	return t, sc.Scan(
+		&t.User,
+		&t.Secret,
+		&t.Confirmed,
+		&t.LastStep,
+		&t.Created,
+	)
+}
+
+func (t *TOTP) validate() error {
+	if err := t.User.Validate(); err != nil {
+		return fmt.Errorf("totp: user: %w", err)
+	}
+	if t.Secret == "" {
+		return errors.New("totp: secret is empty")
+	}
+	return nil
+}
+
+func GetTOTP(ctx context.Context, uid id.ID) (*TOTP, error) {
+	row := db.QueryRowContext(ctx, totpSelectID, uid)
+	return new(TOTP).scan(row)
+}
+
+// InsertTOTP starts an enrollment, replacing any unconfirmed one.
+// Returns ErrTOTPEnabled if user already has a confirmed TOTP.
+func InsertTOTP(ctx context.Context, t *TOTP) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id=? AND NOT confirmed", t.User)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO user_totp (user_id, secret, confirmed, last_step, created) VALUES (?,?,?,?,?)",
+		t.User,
+		t.Secret,
+		t.Confirmed,
+		t.LastStep,
+		t.Created,
+	)
+	if err != nil {
+		if isDuplicate(err) {
+			return ErrTOTPEnabled
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func UpdateTOTP(ctx context.Context, uid id.ID, modifyFn func(*TOTP) error) (*TOTP, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, totpSelectID+" FOR UPDATE", uid)
+	t, err := new(TOTP).scan(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = modifyFn(t); err != nil {
+		return nil, err
+	}
+	if err = t.validate(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_totp SET secret=?, confirmed=?, last_step=? WHERE user_id=?",
+		t.Secret,
+		t.Confirmed,
+		t.LastStep,
+		uid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
+
+// DeleteTOTP disables two-factor authentication, removing recovery codes too.
+func DeleteTOTP(ctx context.Context, uid id.ID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = deleteTOTP(ctx, tx, uid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteTOTP(ctx context.Context, tx *sql.Tx, uid id.ID) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id=?", uid)
+	return err
+}
+
+// SetRecoveryCodes replaces user's recovery codes. Only hashes are stored.
+func SetRecoveryCodes(ctx context.Context, uid id.ID, hashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_code (user_id, hash) VALUES (?,?)", uid, h)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode consumes user's recovery code.
+// Returns ErrInvalidRecovery if there is no such code.
+func UseRecoveryCode(ctx context.Context, uid id.ID, hash string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id=? AND hash=?", uid, hash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidRecovery
+	}
+	return nil
+}
@@ -6,44 +6,111 @@ import (
 	"errors"
 	"fmt"
 	"net/mail"
+	"net/url"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/sewiti/munit-backend/pkg/id"
 )
 
 const (
-	userSelect      = "SELECT id, display_name, email, passwd_hash, passwd_salt, created, modified FROM user"
+	userSelect      = "SELECT id, display_name, email, verified, admin, disabled, email_visible, discoverable, bio, tags, links, avatar, passwd_hash, passwd_salt, created, modified FROM user"
 	userSelectID    = userSelect + " WHERE id=?"
 	userSelectEmail = userSelect + " WHERE email=?"
 
-	userInsert = "INSERT INTO user (id, display_name, email, passwd_hash, passwd_salt, created, modified) VALUES (?,?,?,?,?,?,?)"
-	userUpdate = "UPDATE user SET display_name=?, email=?, passwd_hash=?, passwd_salt=?, modified=? WHERE id=?"
+	userInsert = "INSERT INTO user (id, display_name, email, verified, admin, disabled, email_visible, discoverable, bio, tags, links, avatar, passwd_hash, passwd_salt, created, modified) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	userUpdate = "UPDATE user SET display_name=?, email=?, verified=?, admin=?, disabled=?, email_visible=?, discoverable=?, bio=?, tags=?, links=?, avatar=?, passwd_hash=?, passwd_salt=?, modified=? WHERE id=?"
 )
 
 type User struct {
 	ID          id.ID     `json:"id"`
 	DisplayName string    `json:"displayName"`
 	Email       string    `json:"email"`
+	Verified    bool      `json:"verified"`
+	Admin       bool      `json:"admin"`
+	Disabled    bool      `json:"disabled"`
 	Password    string    `json:"password,omitempty"`
 	Created     time.Time `json:"created"`
 	Modified    time.Time `json:"modified"`
 
-	PasswdHash []byte `json:"-"`
-	Salt       []byte `json:"-"`
+	Profile Profile `json:"profile"`
+	Privacy Privacy `json:"privacy"`
+
+	PasswdHash string `json:"-"` // PHC string format
+	Salt       []byte `json:"-"` // Only set for legacy hashes
+}
+
+// Profile is what user shares about themselves with other musicians.
+type Profile struct {
+	Bio    string   `json:"bio"`
+	Tags   []string `json:"tags"` // Roles and instruments
+	Links  []string `json:"links"`
+	Avatar string   `json:"avatar,omitempty"` // Key of avatar's thumbnails, empty if none
 }
 
-func (u *User) scan(row *sql.Row) (*User, error) {
-	return u, row.Scan(
+// Privacy are user's settings of what others can see.
+type Privacy struct {
+	EmailVisible bool `json:"emailVisible"` // Shown to users sharing a project
+	Discoverable bool `json:"discoverable"` // Found by display name in user search by anyone
+}
+
+// PublicUser is user's profile as seen by other users.
+type PublicUser struct {
+	ID          id.ID   `json:"id"`
+	DisplayName string  `json:"displayName"`
+	Email       string  `json:"email,omitempty"`
+	Profile     Profile `json:"profile"`
+
+	SharedProjects []id.ID `json:"sharedProjects"`
+}
+
+// Public returns user's profile as seen by other users sharing projects with
+// them.
+func (u *User) Public(shared []id.ID) *PublicUser {
+	pu := &PublicUser{
+		ID:             u.ID,
+		DisplayName:    u.DisplayName,
+		Profile:        u.Profile,
+		SharedProjects: shared,
+	}
+	if u.Privacy.EmailVisible && len(shared) > 0 {
+		pu.Email = u.Email
+	}
+	return pu
+}
+
+func (u *User) scan(sc scanner) (*User, error) {
+	var tags, links []byte
+	err := sc.Scan(
 		&u.ID,
 		&u.DisplayName,
 		&u.Email,
+		&u.Verified,
+		&u.Admin,
+		&u.Disabled,
+		&u.Privacy.EmailVisible,
+		&u.Privacy.Discoverable,
+		&u.Profile.Bio,
+		&tags,
+		&links,
+		&u.Profile.Avatar,
 		&u.PasswdHash,
 		&u.Salt,
 		&u.Created,
 		&u.Modified,
 	)
+	if err != nil {
+		return u, err
+	}
+	if u.Profile.Tags, err = unmarshalStrings(tags); err != nil {
+		return u, fmt.Errorf("user: tags: %w", err)
+	}
+	if u.Profile.Links, err = unmarshalStrings(links); err != nil {
+		return u, fmt.Errorf("user: links: %w", err)
+	}
+	return u, nil
 }
 
 func (u *User) validate() error {
@@ -90,13 +157,14 @@ func (u *User) validatePasswd(allowEmptyPasswd bool) error {
 		return errors.New("user: email is invalid")
 	}
 
-	// Hash & Salt
+	if err := u.Profile.validate(); err != nil {
+		return err
+	}
+
+	// Hash
 	if len(u.PasswdHash) == 0 {
 		return fmt.Errorf("user: password hash is empty")
 	}
-	if len(u.Salt) == 0 {
-		return fmt.Errorf("user: salt is empty")
-	}
 
 	// Password
 	if allowEmptyPasswd && u.Password == "" {
@@ -132,15 +200,54 @@ func (u *User) validatePasswd(allowEmptyPasswd bool) error {
 	return nil
 }
 
+func (p *Profile) validate() error {
+	const (
+		maxBio   = 1000
+		maxTags  = 10
+		maxTag   = 32
+		maxLinks = 5
+		maxLink  = 256
+	)
+
+	if utf8.RuneCountInString(p.Bio) > maxBio {
+		return fmt.Errorf("user: profile: bio is too long, max %d", maxBio)
+	}
+
+	if len(p.Tags) > maxTags {
+		return fmt.Errorf("user: profile: too many tags, max %d", maxTags)
+	}
+	for _, t := range p.Tags {
+		if strings.TrimSpace(t) == "" {
+			return errors.New("user: profile: tag is empty")
+		}
+		if utf8.RuneCountInString(t) > maxTag {
+			return fmt.Errorf("user: profile: tag is too long, max %d", maxTag)
+		}
+	}
+
+	if len(p.Links) > maxLinks {
+		return fmt.Errorf("user: profile: too many links, max %d", maxLinks)
+	}
+	for _, l := range p.Links {
+		if len(l) > maxLink {
+			return fmt.Errorf("user: profile: link is too long, max %d", maxLink)
+		}
+		u, err := url.Parse(l)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("user: profile: link is invalid: %q", l)
+		}
+	}
+	return nil
+}
+
 func (u *User) Copy() *User {
 	newUser := new(User)
 	*newUser = *u
 
-	newUser.PasswdHash = make([]byte, len(u.PasswdHash))
-	copy(newUser.PasswdHash, u.PasswdHash)
-
 	newUser.Salt = make([]byte, len(u.Salt))
 	copy(newUser.Salt, u.Salt)
+	newUser.Profile.Tags = append([]string(nil), u.Profile.Tags...)
+	newUser.Profile.Links = append([]string(nil), u.Profile.Links...)
 	return newUser
 }
 
@@ -148,10 +255,23 @@ func InsertUser(ctx context.Context, u *User) error {
 	if err := u.validate(); err != nil {
 		return err
 	}
-	_, err := db.ExecContext(ctx, userInsert,
+	return insertUser(ctx, db, u)
+}
+
+func insertUser(ctx context.Context, ex execer, u *User) error {
+	_, err := ex.ExecContext(ctx, userInsert,
 		u.ID,
 		u.DisplayName,
 		u.Email,
+		u.Verified,
+		u.Admin,
+		u.Disabled,
+		u.Privacy.EmailVisible,
+		u.Privacy.Discoverable,
+		u.Profile.Bio,
+		marshalStrings(u.Profile.Tags),
+		marshalStrings(u.Profile.Links),
+		u.Profile.Avatar,
 		u.PasswdHash,
 		u.Salt,
 		u.Created,
@@ -176,6 +296,49 @@ func GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return new(User).scan(row)
 }
 
+// SearchDiscoverableUsers returns users the caller may discover: the one with
+// email equal to query, and those whose display name contains query and who
+// either share a project with the caller or are discoverable. Caller and
+// disabled users are excluded.
+func SearchDiscoverableUsers(ctx context.Context, caller id.ID, query string, limit int) ([]User, error) {
+	args := []interface{}{caller, query, likePattern(query)}
+	args = append(args, associateArgs(caller)...)
+	args = append(args, associateArgs(caller)...)
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx,
+		userSelect+" WHERE id<>? AND NOT disabled AND (email=? OR (display_name LIKE ? AND (discoverable OR id IN ("+
+			"SELECT p.owner_id FROM project p WHERE "+projectAssociate+" UNION "+
+			"SELECT c.user_id FROM contributor c JOIN project p ON p.id=c.project_id WHERE "+projectAssociate+
+			")))) ORDER BY display_name LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanUsers(rows)
+}
+
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	users := make([]User, 0)
+	for rows.Next() {
+		u, err := new(User).scan(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func UpdateUser(ctx context.Context, uid id.ID, modifyFn func(*User) error) (*User, error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -183,6 +346,15 @@ func UpdateUser(ctx context.Context, uid id.ID, modifyFn func(*User) error) (*Us
 	}
 	defer tx.Rollback()
 
+	u, err := updateUser(ctx, tx, uid, modifyFn)
+	if err != nil {
+		return nil, err
+	}
+	return u, tx.Commit()
+}
+
+// updateUser updates the user in transaction tx, see UpdateUser.
+func updateUser(ctx context.Context, tx *sql.Tx, uid id.ID, modifyFn func(*User) error) (*User, error) {
 	row := tx.QueryRowContext(ctx, userSelectID, uid)
 	u, err := new(User).scan(row)
 	if err != nil {
@@ -199,6 +371,15 @@ func UpdateUser(ctx context.Context, uid id.ID, modifyFn func(*User) error) (*Us
 	_, err = tx.ExecContext(ctx, userUpdate,
 		u.DisplayName,
 		u.Email,
+		u.Verified,
+		u.Admin,
+		u.Disabled,
+		u.Privacy.EmailVisible,
+		u.Privacy.Discoverable,
+		u.Profile.Bio,
+		marshalStrings(u.Profile.Tags),
+		marshalStrings(u.Profile.Links),
+		u.Profile.Avatar,
 		u.PasswdHash,
 		u.Salt,
 		u.Modified,
@@ -210,21 +391,98 @@ func UpdateUser(ctx context.Context, uid id.ID, modifyFn func(*User) error) (*Us
 		}
 		return nil, err
 	}
-	return u, tx.Commit()
+	return u, nil
 }
 
-func DeleteUser(ctx context.Context, uid id.ID) error {
+// DeleteUser deletes the user. If user owns any projects, ErrOwnsProjects is
+// returned, unless deleteProjects is set, in which case owned projects are
+// deleted as well. ErrLastOrgAdmin is returned if user is the only admin of an
+// organization.
+func DeleteUser(ctx context.Context, uid id.ID, deleteProjects bool) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM project WHERE owner_id=?", uid)
+	if err != nil {
+		return err
+	}
+	owned := make([]id.ID, 0)
+	for rows.Next() {
+		var pid id.ID
+		if err = rows.Scan(&pid); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		owned = append(owned, pid)
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+
+	if len(owned) > 0 && !deleteProjects {
+		return ErrOwnsProjects
+	}
+
+	var lastAdmin bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM org_member m WHERE m.user_id=? AND m.role=? AND NOT EXISTS "+
+			"(SELECT 1 FROM org_member o WHERE o.org_id=m.org_id AND o.role=? AND o.user_id<>m.user_id))",
+		uid, OrgRoleAdmin, OrgRoleAdmin,
+	).Scan(&lastAdmin)
+	if err != nil {
+		return err
+	}
+	if lastAdmin {
+		return ErrLastOrgAdmin
+	}
+	for _, pid := range owned {
+		if err = deleteProject(ctx, tx, pid); err != nil {
+			return err
+		}
+	}
+
 	_, err = tx.ExecContext(ctx, "DELETE FROM contributor WHERE user_id=?", uid)
 	if err != nil {
 		return err
 	}
-	// Projects.. let's not delete those?...
+	_, err = tx.ExecContext(ctx, "DELETE FROM invitation WHERE user_id=? OR inviter_id=?", uid, uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_invitation WHERE user_id=? OR inviter_id=?", uid, uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_token WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	if err = deleteTOTP(ctx, tx, uid); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_identity WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM avatar WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM team_member WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM org_member WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
 	res, err := tx.ExecContext(ctx, "DELETE FROM user WHERE id=?", uid)
 	if err != nil {
 		return err
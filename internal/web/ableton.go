@@ -0,0 +1,42 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/job"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/ableton"
+)
+
+// enqueueAbleton queues parsing of file's Ableton Live set, as large sets
+// take a while.
+func enqueueAbleton(f *model.File) {
+	if f.Ableton != nil || !model.IsAbletonSet(f) {
+		return
+	}
+	hash := f.Hash
+	job.Enqueue("ableton:"+hash, func(ctx context.Context) error {
+		return parseAbleton(ctx, hash)
+	})
+}
+
+// parseAbleton parses the blob as an Ableton Live set. Malformed sets are
+// left unparsed, as with audio.
+func parseAbleton(ctx context.Context, hash string) error {
+	data, err := model.GetBlob(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // deleted meanwhile
+		}
+		return err
+	}
+	s, err := ableton.Parse(data)
+	if err != nil {
+		log.WithError(err).WithField("blob", hash).Warn("unable to parse ableton live set")
+		return nil
+	}
+	return model.SetAbleton(ctx, hash, s)
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// insertAudit records an audit entry. Failures are only logged.
+func insertAudit(ctx context.Context, r *http.Request, action model.AuditAction, subject, detail string) {
+	err := model.InsertAudit(ctx, &model.AuditEntry{
+		Action:  action,
+		Subject: subject,
+		IP:      remoteIP(r),
+		Detail:  detail,
+	})
+	if err != nil {
+		log.WithError(err).WithField("action", action).Error("unable to insert audit entry")
+	}
+}
+
+func adminUserGetAll(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := getPage(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	u, err := model.SearchUsers(r.Context(), r.URL.Query().Get("query"), limit, offset)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, u)
+}
+
+func adminUserGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, userID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	u, err := model.GetUser(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, u)
+}
+
+// adminUserPatch disables/enables user's account or grants/revokes admin.
+func adminUserPatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, userID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var body struct {
+		Disabled *bool `json:"disabled"`
+		Admin    *bool `json:"admin"`
+	}
+	if err = decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if ids[0] == uid {
+		respondMsg(w, "cannot change own account", http.StatusBadRequest)
+		return
+	}
+
+	var orig model.User
+	u, err := model.UpdateUser(r.Context(), ids[0], func(u *model.User) error {
+		orig = *u
+		if body.Disabled != nil {
+			u.Disabled = *body.Disabled
+		}
+		if body.Admin != nil {
+			u.Admin = *body.Admin
+		}
+		u.Modified = time.Now().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	detail := fmt.Sprintf("by %s", uid)
+	switch {
+	case !orig.Disabled && u.Disabled:
+		insertAudit(r.Context(), r, model.AuditUserDisable, string(u.ID), detail)
+	case orig.Disabled && !u.Disabled:
+		insertAudit(r.Context(), r, model.AuditUserEnable, string(u.ID), detail)
+	}
+	switch {
+	case !orig.Admin && u.Admin:
+		insertAudit(r.Context(), r, model.AuditAdminGrant, string(u.ID), detail)
+	case orig.Admin && !u.Admin:
+		insertAudit(r.Context(), r, model.AuditAdminRevoke, string(u.ID), detail)
+	}
+	respondOK(w, u)
+}
+
+func adminProjectGetAll(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := getPage(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.SearchProjects(r.Context(), r.URL.Query().Get("query"), limit, offset)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
+func adminProjectGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.GetProject(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
+// adminProjectOwnerPost reassigns project's owner to any user. Previous owner
+// stays as a maintainer, if their account still exists.
+func adminProjectOwnerPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var body struct {
+		Owner id.ID `json:"ownerID"`
+	}
+	if err = decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = body.Owner.Validate(); err != nil {
+		respondErr(w, fmt.Errorf("owner: %w", err))
+		return
+	}
+	if _, err = model.GetUser(r.Context(), body.Owner); err != nil {
+		respondErr(w, fmt.Errorf("owner: %w", err))
+		return
+	}
+
+	var prevOwner string
+	p, err := model.UpdateProject(r.Context(), ids[0], func(p *model.Project) error {
+		if p.Owner == body.Owner {
+			return errors.New("user already owns the project")
+		}
+		prevOwner = string(p.Owner)
+		if p.Org != "" {
+			prevOwner = "organization " + string(p.Org)
+		}
+		p.Contributors = removeID(p.Contributors, body.Owner)
+		p.Maintainers = removeID(p.Maintainers, body.Owner)
+		if _, err := model.GetUser(r.Context(), p.Owner); err == nil {
+			p.Maintainers = append(p.Maintainers, p.Owner)
+		}
+		p.Owner = body.Owner
+		p.Org = ""
+		p.Modified = time.Now().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	insertAudit(r.Context(), r, model.AuditOwnerReassign, string(p.ID),
+		fmt.Sprintf("from %s to %s by %s", prevOwner, p.Owner, uid))
+	respondOK(w, p)
+}
+
+func adminStatsGet(w http.ResponseWriter, r *http.Request) {
+	s, err := model.GetStats(r.Context())
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, s)
+}
+
+func adminAuditGetAll(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := getPage(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	e, err := model.GetAuditLog(r.Context(), limit, offset)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, e)
+}
@@ -0,0 +1,119 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/job"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/audio"
+	"github.com/sewiti/munit-backend/pkg/loudness"
+	"github.com/sewiti/munit-backend/pkg/waveform"
+)
+
+// peaksResolution is samples per pixel of generated peaks. Coarser resolutions
+// are merged from them on request.
+const peaksResolution = 256
+
+// analyzable reports whether file's audio can be analyzed.
+func analyzable(f *model.File) bool {
+	return f.Audio != nil && audio.Decodable(f.Audio.Format, f.Audio.Codec)
+}
+
+// enqueueAnalysis queues analysis of file's audio, which generates its peaks
+// and measures its loudness.
+func enqueueAnalysis(f *model.File) {
+	if !analyzable(f) {
+		return
+	}
+	hash := f.Hash
+	job.Enqueue("analysis:"+hash, func(ctx context.Context) error {
+		return analyze(ctx, hash)
+	})
+}
+
+// enqueueMissingAnalyses queues analysis of files, which were not analyzed
+// yet, e.g. because queued jobs were lost on restart.
+func enqueueMissingAnalyses(files ...model.File) {
+	for i := range files {
+		if files[i].Loudness == nil {
+			enqueueAnalysis(&files[i])
+		}
+	}
+}
+
+// analyze generates peaks and measures loudness of the blob in a single
+// decoding pass. Decoding failures are stored as well, so that they are not
+// retried.
+func analyze(ctx context.Context, hash string) error {
+	if p, err := model.GetPeaks(ctx, hash); err == nil {
+		if p.Error != "" {
+			return nil // failed before
+		}
+		if done, err := model.HasLoudness(ctx, hash); err != nil || done {
+			return err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	data, err := model.GetBlob(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // deleted meanwhile
+		}
+		return err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	p := &model.Peaks{Hash: hash, Created: now}
+	peaks, level, err := decodeAnalysis(ctx, data)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.WithError(err).WithField("blob", hash).Warn("unable to analyze audio")
+		p.Error = err.Error()
+		return model.SetPeaks(ctx, p)
+	}
+
+	p.Data, err = peaks.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err = model.SetPeaks(ctx, p); err != nil {
+		return err
+	}
+	return model.SetLoudness(ctx, hash, &model.Loudness{
+		Integrated:   level.Integrated,
+		TruePeak:     level.TruePeak,
+		SamplePeak:   level.SamplePeak,
+		RMS:          level.RMS,
+		DynamicRange: level.LoudnessRange,
+	}, now)
+}
+
+func decodeAnalysis(ctx context.Context, data []byte) (*waveform.Peaks, *loudness.Result, error) {
+	info, err := audio.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := waveform.NewBuilder(info.SampleRate, info.Channels, peaksResolution)
+	m := loudness.NewMeter(info.SampleRate, info.Channels)
+	_, err = audio.Decode(data, func(samples []float64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := b.Write(samples); err != nil {
+			return err
+		}
+		return m.Write(samples)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	r := m.Result()
+	return b.Peaks(), &r, nil
+}
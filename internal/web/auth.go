@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -18,65 +19,160 @@ const (
 	userKey contextKey = 2
 )
 
+var errDisabled = fmt.Errorf("%w: account is disabled", errForbidden)
+
+// authMiddleware requires requests to be authenticated.
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		authParts := strings.SplitN(authHeader, " ", 2)
-		if len(authParts) != 2 {
+		uid, err := authenticate(r)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userKey, uid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// optionalAuthMiddleware authenticates requests with an Authorization header
+// and lets anonymous requests through. Handlers must check getUser.
+func optionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authMiddleware(next).ServeHTTP(w, r)
+	})
+}
+
+// userMiddleware rejects anonymous requests.
+// Must be used after optionalAuthMiddleware.
+func userMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := getUser(r); err != nil {
 			respondUnauthorized(w)
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the user authenticated by request's Authorization
+// header.
+func authenticate(r *http.Request) (id.ID, error) {
+	authHeader := r.Header.Get("Authorization")
+	authParts := strings.SplitN(authHeader, " ", 2)
+	if len(authParts) != 2 {
+		return "", errUnauthorized
+	}
+
+	var uid id.ID
+	switch authParts[0] {
+	case "Bearer":
+		subject, err := auth.VerifyJWT(authParts[1])
+		if err != nil {
+			log.WithError(err).Debug("unable to verify jwt")
+			return "", errUnauthorized
+		}
+		uid = id.ID(subject)
+	default:
+		return "", errUnauthorized
+	}
+
+	u, err := model.GetUser(r.Context(), uid)
+	if err != nil {
+		return "", errUnauthorized
+	}
+	if u.Disabled {
+		return "", errDisabled
+	}
+	return uid, nil
+}
 
-		var uid id.ID
-		switch authParts[0] {
-		case "Bearer":
-			subject, err := auth.VerifyJWT(authParts[1])
-			if err != nil {
-				log.WithError(err).Debug("unable to verify jwt")
+// projectMiddleware allows only project's associates to access it. Public and
+// unlisted projects can also be read by anyone, including anonymous users.
+// Requests not targeting a project require authentication.
+// Must be used after optionalAuthMiddleware.
+func projectMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := getUser(r)
+		anonymous := err != nil
+
+		ids, err := getIDs(r, projectID)
+		if err != nil || len(ids) != 1 {
+			if anonymous {
 				respondUnauthorized(w)
 				return
 			}
-			uid = id.ID(subject)
-		default:
-			respondUnauthorized(w)
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		_, err := model.GetUser(r.Context(), uid)
+		p, err := model.GetProject(r.Context(), ids[0])
 		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		switch {
+		case !anonymous && p.HasRole(uid, model.RoleContributor):
+		case r.Method == http.MethodGet && projectReadable(p, ""):
+		case anonymous:
 			respondUnauthorized(w)
 			return
+		default:
+			respondErr(w, errForbidden)
+			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		if ids, err := getIDs(r, projectID); err == nil && len(ids) == 1 {
-			err = verifyProjectAssociate(r.Context(), ids[0], uid)
-			if err != nil {
-				respondErr(w, err)
-				return
-			}
-		}
+// projectReadable reports whether user can read the project. Anonymous users
+// are given as an empty ID.
+func projectReadable(p *model.Project, uid id.ID) bool {
+	return p.Visibility != model.VisibilityPrivate || (uid != "" && p.HasRole(uid, model.RoleContributor))
+}
 
-		ctx := context.WithValue(r.Context(), userKey, uid)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// adminMiddleware allows only instance administrators.
+// Must be used after authMiddleware.
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := getUser(r)
+		if err != nil {
+			log.WithError(err).Error("unable to get user from context")
+			respondInternalError(w)
+			return
+		}
+		u, err := model.GetUser(r.Context(), uid)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		if !u.Admin {
+			respondErr(w, errForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
 func verifyProjectAssociate(ctx context.Context, project, user id.ID) error {
+	_, err := verifyProjectRole(ctx, project, user, model.RoleContributor)
+	return err
+}
+
+// verifyProjectRole returns the project if user's role in it is at least min.
+func verifyProjectRole(ctx context.Context, project, user id.ID, min model.Role) (*model.Project, error) {
 	p, err := model.GetProject(ctx, project)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if user == p.Owner {
-		return nil
-	}
-
-	for _, contrib := range p.Contributors {
-		if user == contrib {
-			return nil
-		}
+	if !p.HasRole(user, min) {
+		return nil, errForbidden
+		// return nil, model.ErrNotFound // Fake 404
 	}
-	return errForbidden
-	// return model.ErrNotFound // Fake 404
+	return p, nil
 }
 
 func getUser(r *http.Request) (id.ID, error) {
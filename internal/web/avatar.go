@@ -0,0 +1,123 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/thumb"
+)
+
+const (
+	avatarSize     = "size" // Avatar size path key
+	avatarLimit    = 5 * 1024 * 1024
+	avatarMaxSide  = 6000
+	avatarQuality  = 85
+	avatarCacheAge = 365 * 24 * 60 * 60 // Key changes on every upload
+)
+
+// avatarSizes are the thumbnail sizes made of every uploaded avatar.
+var avatarSizes = []int{64, 256}
+
+// profileAvatarPut replaces user's avatar with the PNG, JPEG or GIF image in
+// request's body.
+func profileAvatarPut(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, avatarLimit+1))
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if len(data) > avatarLimit {
+		respondMsg(w, fmt.Sprintf("avatar: too large, max %d bytes", avatarLimit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		respondErr(w, errUnsupportedMedia)
+		return
+	}
+
+	img, _, err := thumb.Decode(data, avatarMaxSide)
+	if err != nil {
+		respondErr(w, fmt.Errorf("avatar: %w", err))
+		return
+	}
+
+	key, err := auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make avatar key")
+		respondInternalError(w)
+		return
+	}
+	thumbs := make([]model.Avatar, 0, len(avatarSizes))
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, thumb.Square(img, size, color.White), &jpeg.Options{Quality: avatarQuality})
+		if err != nil {
+			log.WithError(err).Error("unable to encode avatar")
+			respondInternalError(w)
+			return
+		}
+		thumbs = append(thumbs, model.Avatar{User: uid, Key: key, Size: size, Data: buf.Bytes()})
+	}
+
+	u, err := model.SetAvatar(r.Context(), uid, thumbs)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, u)
+}
+
+func profileAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	u, err := model.DeleteAvatar(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, u)
+}
+
+// avatarGet serves an avatar thumbnail. Keys are unguessable and change on
+// every upload, so thumbnails are public and cached indefinitely.
+func avatarGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	size, err := strconv.Atoi(vars[avatarSize])
+	if err != nil {
+		respondErr(w, model.ErrNotFound)
+		return
+	}
+	a, err := model.GetAvatar(r.Context(), vars[tokenKey], size)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Data)))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", avatarCacheAge))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(a.Data)
+}
@@ -0,0 +1,294 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// commitCommentGetAll responds with comment threads on commit's files,
+// including those carried forward from earlier commits.
+func commitCommentGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if _, err = model.GetCommit(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	m, err := model.GetCommitComments(r.Context(), ids[0], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, m)
+}
+
+// fileCommentGetAll responds with comment threads on the file, including
+// those carried forward from earlier commits.
+func fileCommentGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	f, err := model.GetFileMeta(r.Context(), ids[0], ids[1], ids[2])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	m, err := model.GetFileComments(r.Context(), ids[0], ids[1], f)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, m)
+}
+
+// fileCommentPost comments on the file. Replies are made to the thread of
+// the parent comment, which may be carried forward from an earlier commit.
+func fileCommentPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var m model.Comment
+	if err = decodeJSON(r, &m); err != nil {
+		respondErr(w, err)
+		return
+	}
+	f, err := model.GetFileMeta(r.Context(), ids[0], ids[1], ids[2])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	m.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	m.Created = now
+	m.Modified = now
+	m.Resolved = false
+	m.ResolvedBy = ""
+	m.ResolvedAt = nil
+	m.Project = ids[0]
+	m.Commit = ids[1]
+	m.File = f.ID
+	m.Path = f.Path
+	m.Author = uid
+
+	if m.Parent != "" {
+		parent, err := model.GetComment(r.Context(), ids[0], m.Parent)
+		if err != nil {
+			respondErr(w, fmt.Errorf("parent: %w", err))
+			return
+		}
+		if parent.Parent != "" {
+			parent, err = model.GetComment(r.Context(), ids[0], parent.Parent)
+			if err != nil {
+				respondErr(w, fmt.Errorf("parent: %w", err))
+				return
+			}
+		}
+		if parent.Path != f.Path && parent.File != f.ID {
+			respondMsg(w, "parent comment is on another file", http.StatusBadRequest)
+			return
+		}
+		m.Parent = parent.ID
+		m.Commit = parent.Commit
+		m.File = parent.File
+		m.Path = parent.Path
+	} else if err = checkCommentTime(f, &m); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.InsertComment(r.Context(), &m); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, m, http.StatusCreated)
+}
+
+// checkCommentTime checks whether comment's time position is within the
+// file, if its duration is known.
+func checkCommentTime(f *model.File, m *model.Comment) error {
+	if f.Audio == nil {
+		return nil
+	}
+	end := m.Start
+	if m.End != nil {
+		end = *m.End
+	}
+	if end > f.Audio.Duration {
+		return errors.New("comment: time is past the end of the file")
+	}
+	return nil
+}
+
+// commentPatch edits comment's body or time position. Only its author can.
+func commentPatch(w http.ResponseWriter, r *http.Request) {
+	if err := assertJSON(r); err != nil {
+		respondErr(w, err)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, defaultBodyLimit))
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	ids, err := getIDs(r, projectID, commentID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	m, err := model.UpdateComment(r.Context(), ids[0], ids[1], func(m *model.Comment) error {
+		if m.Author != uid {
+			return errForbidden
+		}
+		var body struct {
+			Body  *string   `json:"body"`
+			Start *float64  `json:"start"`
+			End   **float64 `json:"end"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return err
+		}
+		if body.Body != nil {
+			m.Body = *body.Body
+		}
+		if body.Start != nil {
+			m.Start = *body.Start
+		}
+		if body.End != nil {
+			m.End = *body.End
+		}
+		m.Modified = time.Now().Truncate(time.Second)
+		if m.Parent != "" || (body.Start == nil && body.End == nil) {
+			return nil
+		}
+		f, err := model.GetFileMeta(r.Context(), m.Project, m.Commit, m.File)
+		if err != nil {
+			return err
+		}
+		return checkCommentTime(f, m)
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, m)
+}
+
+// commentResolvePost resolves comment's thread.
+func commentResolvePost(w http.ResponseWriter, r *http.Request) {
+	setCommentResolved(w, r, true)
+}
+
+// commentUnresolvePost reopens comment's resolved thread.
+func commentUnresolvePost(w http.ResponseWriter, r *http.Request) {
+	setCommentResolved(w, r, false)
+}
+
+func setCommentResolved(w http.ResponseWriter, r *http.Request, resolved bool) {
+	ids, err := getIDs(r, projectID, commentID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	m, err := model.UpdateComment(r.Context(), ids[0], ids[1], func(m *model.Comment) error {
+		if m.Parent != "" {
+			return errors.New("comment: replies cannot be resolved, resolve the thread")
+		}
+		if m.Resolved == resolved {
+			return nil
+		}
+		m.Resolved = resolved
+		m.ResolvedBy = ""
+		m.ResolvedAt = nil
+		if resolved {
+			now := time.Now().Truncate(time.Second)
+			m.ResolvedBy = uid
+			m.ResolvedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, m)
+}
+
+// commentDelete deletes the comment with its replies. Its author and
+// project's maintainers can.
+func commentDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commentID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	m, err := model.GetComment(r.Context(), ids[0], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if m.Author != uid {
+		if _, err = verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer); err != nil {
+			respondErr(w, err)
+			return
+		}
+	}
+
+	if err = model.DeleteComment(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
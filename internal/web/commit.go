@@ -2,6 +2,7 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -46,6 +47,56 @@ func commitGet(w http.ResponseWriter, r *http.Request) {
 	respondOK(w, c)
 }
 
+// commitCompareGet compares commit's files to those of the base commit,
+// including loudness deltas of audio files.
+func commitCompareGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, baseID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	c, err := model.CompareCommits(r.Context(), ids[0], ids[2], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	for _, change := range c.Files {
+		for _, f := range []*model.File{change.Base, change.Head} {
+			if f != nil && f.Loudness == nil {
+				enqueueAnalysis(f)
+			}
+		}
+	}
+	respondOK(w, c)
+}
+
+// commitCompareMIDIGet compares MIDI file at the path given by path query
+// parameter to that in the base commit, note by note.
+func commitCompareMIDIGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, baseID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		respondMsg(w, "path is required", http.StatusBadRequest)
+		return
+	}
+
+	c, err := model.CompareMIDI(r.Context(), ids[0], ids[2], ids[1], path)
+	if errors.Is(err, model.ErrNotMIDI) {
+		respondMsg(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, c)
+}
+
 func commitPost(w http.ResponseWriter, r *http.Request) {
 	ids, err := getIDs(r, projectID)
 	if err != nil {
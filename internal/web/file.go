@@ -2,9 +2,13 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
 	"time"
 
 	"github.com/apex/log"
@@ -29,6 +33,7 @@ func fileGetAll(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, err)
 		return
 	}
+	enqueueMissingAnalyses(f...)
 	respondOK(w, f)
 }
 
@@ -44,6 +49,7 @@ func fileGet(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, err)
 		return
 	}
+	enqueueMissingAnalyses(*f)
 	respondOK(w, f)
 }
 
@@ -76,6 +82,9 @@ func filePost(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, err)
 		return
 	}
+	enqueueAnalysis(&f)
+	enqueuePreview(&f)
+	enqueueAbleton(&f)
 	respond(w, f, http.StatusCreated)
 }
 
@@ -111,6 +120,9 @@ func filePatch(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, err)
 		return
 	}
+	enqueueAnalysis(f)
+	enqueuePreview(f)
+	enqueueAbleton(f)
 	respondOK(w, f)
 }
 
@@ -127,3 +139,39 @@ func fileDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	respond(w, nil, http.StatusNoContent)
 }
+
+// fileDownloadGet responds with raw file data. With markers=embed, WAV file's
+// markers are written into it, replacing its cue points.
+func fileDownloadGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	f, err := model.GetFile(r.Context(), ids[0], ids[1], ids[2])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	data := f.Data
+	if r.URL.Query().Get("markers") == "embed" {
+		data, err = model.EmbedMarkers(f)
+		if errors.Is(err, model.ErrNotWAV) {
+			respondMsg(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+	}
+
+	_, name := path.Split(f.Path)
+	w.Header().Set("Content-Type", shareContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(shareDisposition, map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,234 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/mail"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+const defaultInvitationExpiry = 7 * 24 * time.Hour // 7d
+
+func invitationGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	inv, err := model.GetAllInvitations(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, inv)
+}
+
+func invitationPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var inv model.Invitation
+	if err = decodeJSON(r, &inv); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if inv.Email == "" {
+		respondMsg(w, "email is empty", http.StatusBadRequest)
+		return
+	}
+	if inv.Role == "" {
+		inv.Role = model.RoleContributor
+	}
+
+	p, err := verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if inv.Role == model.RoleMaintainer && !p.HasRole(uid, model.RoleOwner) {
+		respondErr(w, errForbidden)
+		return
+	}
+	if retry, ok := searchLimiter.Allow(string(uid)); !ok {
+		respondTooManyRequests(w, retry)
+		return
+	}
+
+	invitee, err := model.GetUserByEmail(r.Context(), inv.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondMsg(w, "no user with such email", http.StatusBadRequest)
+			return
+		}
+		respondErr(w, err)
+		return
+	}
+	if _, ok := p.RoleOf(invitee.ID); ok {
+		respondMsg(w, "user is already associated with the project", http.StatusBadRequest)
+		return
+	}
+
+	inv.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	inv.Token, err = auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make token")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	inv.Created = now
+	if inv.Expires.IsZero() {
+		inv.Expires = now.Add(defaultInvitationExpiry)
+	}
+	inv.Project = p.ID
+	inv.Inviter = uid
+	inv.User = invitee.ID
+	inv.TokenHash = auth.HashToken(inv.Token)
+
+	if err = model.InsertInvitation(r.Context(), &inv); err != nil {
+		respondErr(w, err)
+		return
+	}
+	err = sendInvitation(r.Context(), invitee, uid, "project "+p.Name, tokenLink("/invitations", inv.Token), inv.Expires)
+	if err != nil {
+		log.WithError(err).WithField("invitation", inv.ID).Error("unable to send invitation email")
+	}
+	respond(w, inv, http.StatusCreated)
+}
+
+// sendInvitation mails the invitee a link to accept or decline the invitation,
+// as only its token's hash is stored.
+func sendInvitation(ctx context.Context, invitee *model.User, inviter id.ID, to, link string, expires time.Time) error {
+	u, err := model.GetUser(ctx, inviter)
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, &mail.Message{
+		To:      invitee.Email,
+		Subject: "You are invited to " + to,
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"%s invited you to %s. Open the link below to accept or decline:\n\n"+
+			"%s\n\n"+
+			"The invitation expires on %s.\n",
+			invitee.DisplayName, u.DisplayName, to, link, expires.UTC().Format("2006-01-02 15:04 MST")),
+	})
+}
+
+func invitationDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, invitationID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	p, err := verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	inv, err := model.GetInvitation(r.Context(), ids[0], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if inv.Role == model.RoleMaintainer && !p.HasRole(uid, model.RoleOwner) {
+		respondErr(w, errForbidden)
+		return
+	}
+
+	if err = model.DeleteInvitation(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+func profileInvitationGetAll(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	inv, err := model.GetPendingInvitations(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, inv)
+}
+
+func invitationAcceptPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	inv, err := model.AcceptInvitation(r.Context(), auth.HashToken(mux.Vars(r)[tokenKey]), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.GetProject(r.Context(), inv.Project)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
+func invitationDeclinePost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	err = model.DeclineInvitation(r.Context(), auth.HashToken(mux.Vars(r)[tokenKey]), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
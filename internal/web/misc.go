@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -29,6 +30,29 @@ func getIDs(r *http.Request, keys ...string) ([]id.ID, error) {
 	return ids, nil
 }
 
+// getPage parses limit and offset query parameters.
+func getPage(r *http.Request) (limit, offset int, err error) {
+	const (
+		defaultLimit = 50
+		maxLimit     = 200
+	)
+	q := r.URL.Query()
+	limit = defaultLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("limit: must be between 1 and %d", maxLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset: must be non-negative")
+		}
+	}
+	return limit, offset, nil
+}
+
 func assertJSON(r *http.Request) error {
 	const contentJSON = "application/json"
 	content := r.Header.Get("Content-Type")
@@ -54,3 +78,14 @@ func decodeJSONLimit(r *http.Request, v interface{}, limit int64) error {
 func decodeJSON(r *http.Request, v interface{}) error {
 	return decodeJSONLimit(r, v, defaultBodyLimit)
 }
+
+// removeID returns ids without rm. Order is preserved.
+func removeID(ids []id.ID, rm id.ID) []id.ID {
+	res := make([]id.ID, 0, len(ids))
+	for _, v := range ids {
+		if v != rm {
+			res = append(res, v)
+		}
+	}
+	return res
+}
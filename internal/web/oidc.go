@@ -0,0 +1,215 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+	"github.com/sewiti/munit-backend/pkg/oidc"
+)
+
+const (
+	oidcCookie       = "munit_oidc"
+	oidcCookieExpiry = 10 * time.Minute
+)
+
+// oidcProvider is nil if OpenID Connect login is not configured.
+var oidcProvider *oidc.Provider
+
+// oidcLoginGet redirects the user to the identity provider.
+func oidcLoginGet(w http.ResponseWriter, r *http.Request) {
+	state, err := auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make oidc state")
+		respondInternalError(w)
+		return
+	}
+	nonce, err := auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make oidc nonce")
+		respondInternalError(w)
+		return
+	}
+
+	redirect, err := oidcProvider.AuthCodeURL(r.Context(), state, nonce)
+	if err != nil {
+		log.WithError(err).Error("unable to make oidc auth url")
+		respondInternalError(w)
+		return
+	}
+
+	// Tokens are URL safe base64, so "." separates them unambiguously.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    state + "." + nonce,
+		Path:     "/oidc",
+		MaxAge:   int(oidcCookieExpiry / time.Second),
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcCallbackGet completes the login and redirects back to the frontend with
+// either a token, a two-factor challenge or an error in the URL fragment.
+func oidcCallbackGet(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/oidc", MaxAge: -1})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		oidcRedirect(w, r, url.Values{"error": {e}})
+		return
+	}
+
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		oidcRedirect(w, r, url.Values{"error": {"login expired"}})
+		return
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(q.Get("state"))) != 1 {
+		oidcRedirect(w, r, url.Values{"error": {"invalid state"}})
+		return
+	}
+
+	claims, err := oidcProvider.Exchange(r.Context(), q.Get("code"), parts[1])
+	if err != nil {
+		log.WithError(err).Warn("unable to exchange oidc code")
+		oidcRedirect(w, r, url.Values{"error": {"unable to verify identity"}})
+		return
+	}
+
+	u, err := oidcUser(r.Context(), claims)
+	if err != nil {
+		log.WithError(err).WithField("subject", claims.Subject).Warn("unable to resolve oidc user")
+		oidcRedirect(w, r, url.Values{"error": {err.Error()}})
+		return
+	}
+	if u.Disabled {
+		oidcRedirect(w, r, url.Values{"error": {"account is disabled"}})
+		return
+	}
+
+	// Second factor
+	t, err := model.GetTOTP(r.Context(), u.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithError(err).WithField("user", u.ID).Error("unable to get totp")
+		oidcRedirect(w, r, url.Values{"error": {"internal error"}})
+		return
+	}
+	if err == nil && t.Confirmed {
+		challenge, err := auth.MakeChallengeJWT(string(u.ID))
+		if err != nil {
+			log.WithError(err).WithField("user", u.ID).Error("unable to make challenge jwt")
+			oidcRedirect(w, r, url.Values{"error": {"internal error"}})
+			return
+		}
+		oidcRedirect(w, r, url.Values{"challenge": {challenge}})
+		return
+	}
+
+	token, err := auth.MakeJWT(string(u.ID))
+	if err != nil {
+		log.WithError(err).WithField("user", u.ID).Error("unable to make jwt")
+		oidcRedirect(w, r, url.Values{"error": {"internal error"}})
+		return
+	}
+	oidcRedirect(w, r, url.Values{"token": {token}})
+}
+
+// oidcRedirect redirects to the frontend. Values are put in the fragment, so
+// that tokens do not end up in server logs.
+func oidcRedirect(w http.ResponseWriter, r *http.Request, values url.Values) {
+	http.Redirect(w, r, appURL+"/login/oidc#"+values.Encode(), http.StatusFound)
+}
+
+// oidcUser returns the user linked to the external identity. If there is none,
+// links a user with the same verified email, or creates a new one.
+func oidcUser(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	issuer := oidcProvider.Issuer()
+	u, err := model.GetIdentityUser(ctx, issuer, claims.Subject)
+	if err == nil {
+		return u, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("identity provider did not share an email")
+	}
+	now := time.Now().Truncate(time.Second)
+	identity := &model.Identity{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Created: now,
+	}
+
+	u, err = model.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Linking by an unverified email would let anyone registered at the
+		// identity provider take over the account.
+		if !claims.EmailVerified {
+			return nil, errors.New("email is not verified by identity provider")
+		}
+		identity.User = u.ID
+		if err = model.InsertIdentity(ctx, identity); err != nil {
+			return nil, err
+		}
+		if !u.Verified {
+			return model.UpdateUser(ctx, u.ID, func(u *model.User) error {
+				u.Verified = true
+				u.Modified = now
+				return nil
+			})
+		}
+		return u, nil
+
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	u = &model.User{
+		DisplayName: displayName(claims.Name),
+		Email:       claims.Email,
+		Verified:    claims.EmailVerified,
+		PasswdHash:  auth.NoPasswd,
+		Created:     now,
+		Modified:    now,
+	}
+	u.ID, err = id.New()
+	if err != nil {
+		return nil, err
+	}
+	identity.User = u.ID
+	if err = model.InsertUserIdentity(ctx, u, identity); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// displayName truncates name to fit user's display name limit.
+func displayName(name string) string {
+	const maxDisplayName = 72
+	if len(name) <= maxDisplayName {
+		return name
+	}
+	// Do not cut a multi-byte rune in half
+	cut := maxDisplayName
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return name[:cut]
+}
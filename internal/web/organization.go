@@ -0,0 +1,427 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+// verifyOrgRole returns the organization if user is its member, and an admin,
+// if admin is set.
+func verifyOrgRole(ctx context.Context, org, user id.ID, admin bool) (*model.Organization, error) {
+	o, err := model.GetOrganization(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := o.RoleOf(user)
+	if !ok {
+		return nil, model.ErrNotFound // do not reveal organization's existence
+	}
+	if admin && role != model.OrgRoleAdmin {
+		return nil, errForbidden
+	}
+	return o, nil
+}
+
+func orgGetAll(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	o, err := model.GetUserOrganizations(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, o)
+}
+
+func orgGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	o, err := verifyOrgRole(r.Context(), ids[0], uid, false)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, o)
+}
+
+// orgPost creates an organization with the user as its only member, an admin.
+// Others join by invitation, see orgInvitationPost.
+func orgPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var o model.Organization
+	if err = decodeJSON(r, &o); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	o.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	o.Created = now
+	o.Modified = now
+	o.Members = []model.OrgMember{{User: uid, Role: model.OrgRoleAdmin}}
+
+	if err = model.InsertOrganization(r.Context(), &o); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, o, http.StatusCreated)
+}
+
+// orgPatch updates organization's details and members' roles, or removes
+// members. Only admins can do it. Members are added by invitation only, see
+// orgInvitationPost.
+func orgPatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = assertJSON(r); err != nil {
+		respondErr(w, err)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, defaultBodyLimit))
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	o, err := model.UpdateOrganization(r.Context(), ids[0], func(o *model.Organization) error {
+		role, ok := o.RoleOf(uid)
+		if !ok {
+			return model.ErrNotFound // do not reveal organization's existence
+		}
+		if role != model.OrgRoleAdmin {
+			return errForbidden
+		}
+
+		orig := *o
+		orig.Members = append([]model.OrgMember(nil), o.Members...) // unmarshal reuses the array
+		if err := json.Unmarshal(data, o); err != nil {
+			return err
+		}
+		o.ID = orig.ID
+		o.Created = orig.Created
+		o.Modified = time.Now().Truncate(time.Second)
+		if o.Members == nil {
+			o.Members = make([]model.OrgMember, 0)
+		}
+		for _, m := range o.Members {
+			if _, ok := orig.RoleOf(m.User); !ok {
+				return errors.New("organization: members can only be added by invitation")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, o)
+}
+
+// orgLeavePost removes the user from the organization and its teams.
+func orgLeavePost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	_, err = model.UpdateOrganization(r.Context(), ids[0], func(o *model.Organization) error {
+		members := make([]model.OrgMember, 0, len(o.Members))
+		admins := 0
+		for _, m := range o.Members {
+			if m.User != uid {
+				members = append(members, m)
+				if m.Role == model.OrgRoleAdmin {
+					admins++
+				}
+			}
+		}
+		if len(members) == len(o.Members) {
+			return model.ErrNotFound
+		}
+		if admins == 0 {
+			return model.ErrLastOrgAdmin
+		}
+		o.Members = members
+		o.Modified = time.Now().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+func orgDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.DeleteOrganization(r.Context(), ids[0]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+func orgProjectGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, false); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	filter, err := getProjectFilter(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.GetOrgProjects(r.Context(), ids[0], filter)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
+func teamGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, false); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	t, err := model.GetAllTeams(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, t)
+}
+
+func teamGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID, teamID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, false); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	t, err := model.GetTeam(r.Context(), ids[0], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, t)
+}
+
+func teamPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var t model.Team
+	if err = decodeJSON(r, &t); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	t.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	t.Created = now
+	t.Modified = now
+	t.Org = ids[0]
+	if t.Members == nil {
+		t.Members = make([]id.ID, 0)
+	}
+	if t.Projects == nil {
+		t.Projects = make([]model.TeamProject, 0)
+	}
+
+	if err = model.InsertTeam(r.Context(), &t); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, t, http.StatusCreated)
+}
+
+func teamPatch(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID, teamID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = assertJSON(r); err != nil {
+		respondErr(w, err)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, defaultBodyLimit))
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	t, err := model.UpdateTeam(r.Context(), ids[0], ids[1], func(t *model.Team) error {
+		orig := *t
+		if err := json.Unmarshal(data, t); err != nil {
+			return err
+		}
+		t.ID = orig.ID
+		t.Org = orig.Org
+		t.Created = orig.Created
+		t.Modified = time.Now().Truncate(time.Second)
+		if t.Members == nil {
+			t.Members = make([]id.ID, 0)
+		}
+		if t.Projects == nil {
+			t.Projects = make([]model.TeamProject, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, t)
+}
+
+func teamDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID, teamID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.DeleteTeam(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
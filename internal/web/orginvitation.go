@@ -0,0 +1,197 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+)
+
+func orgInvitationGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	inv, err := model.GetAllOrgInvitations(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, inv)
+}
+
+// orgInvitationPost invites a user to the organization. Only admins can do it.
+func orgInvitationPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var inv model.OrgInvitation
+	if err = decodeJSON(r, &inv); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if inv.Email == "" {
+		respondMsg(w, "email is empty", http.StatusBadRequest)
+		return
+	}
+	if inv.Role == "" {
+		inv.Role = model.OrgRoleMember
+	}
+
+	o, err := verifyOrgRole(r.Context(), ids[0], uid, true)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if retry, ok := searchLimiter.Allow(string(uid)); !ok {
+		respondTooManyRequests(w, retry)
+		return
+	}
+
+	invitee, err := model.GetUserByEmail(r.Context(), inv.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondMsg(w, "no user with such email", http.StatusBadRequest)
+			return
+		}
+		respondErr(w, err)
+		return
+	}
+	if _, ok := o.RoleOf(invitee.ID); ok {
+		respondMsg(w, "user is already a member of the organization", http.StatusBadRequest)
+		return
+	}
+
+	inv.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	inv.Token, err = auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make token")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	inv.Created = now
+	if inv.Expires.IsZero() {
+		inv.Expires = now.Add(defaultInvitationExpiry)
+	}
+	inv.Org = o.ID
+	inv.Inviter = uid
+	inv.User = invitee.ID
+	inv.TokenHash = auth.HashToken(inv.Token)
+
+	if err = model.InsertOrgInvitation(r.Context(), &inv); err != nil {
+		respondErr(w, err)
+		return
+	}
+	err = sendInvitation(r.Context(), invitee, uid, "organization "+o.Name, tokenLink("/org-invitations", inv.Token), inv.Expires)
+	if err != nil {
+		log.WithError(err).WithField("invitation", inv.ID).Error("unable to send invitation email")
+	}
+	respond(w, inv, http.StatusCreated)
+}
+
+func orgInvitationDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, orgID, invitationID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyOrgRole(r.Context(), ids[0], uid, true); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.DeleteOrgInvitation(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+func profileOrgInvitationGetAll(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	inv, err := model.GetPendingOrgInvitations(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, inv)
+}
+
+func orgInvitationAcceptPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	inv, err := model.AcceptOrgInvitation(r.Context(), auth.HashToken(mux.Vars(r)[tokenKey]), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	o, err := model.GetOrganization(r.Context(), inv.Org)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, o)
+}
+
+func orgInvitationDeclinePost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	err = model.DeclineOrgInvitation(r.Context(), auth.HashToken(mux.Vars(r)[tokenKey]), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
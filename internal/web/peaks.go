@@ -0,0 +1,89 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/waveform"
+)
+
+// filePeaksGet responds with file's waveform peaks in audiowaveform's format:
+// JSON, or binary if format=dat. Resolution (samples per pixel) must be a
+// multiple of peaksResolution. 202 is responded while peaks are generated.
+func filePeaksGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	resolution := peaksResolution
+	if v := q.Get("resolution"); v != "" {
+		resolution, err = strconv.Atoi(v)
+		if err != nil {
+			respondMsg(w, "invalid resolution", http.StatusBadRequest)
+			return
+		}
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "dat" {
+		respondMsg(w, "invalid format, must be json or dat", http.StatusBadRequest)
+		return
+	}
+
+	f, err := model.GetFile(r.Context(), ids[0], ids[1], ids[2])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if !analyzable(f) {
+		respondMsg(w, "file is not a decodable audio file", http.StatusUnprocessableEntity)
+		return
+	}
+
+	stored, err := model.GetPeaks(r.Context(), f.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not generated yet, or lost on restart before it was.
+		enqueueAnalysis(f)
+		w.Header().Set("Retry-After", "5")
+		respondMsg(w, "waveform is being generated", http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if stored.Error != "" {
+		respondMsg(w, "unable to generate waveform: "+stored.Error, http.StatusUnprocessableEntity)
+		return
+	}
+
+	var peaks waveform.Peaks
+	if err = peaks.UnmarshalBinary(stored.Data); err != nil {
+		log.WithError(err).WithField("blob", f.Hash).Error("unable to decode stored peaks")
+		respondInternalError(w)
+		return
+	}
+	p, err := peaks.Resample(resolution)
+	if err != nil {
+		respondMsg(w, "resolution must be a positive multiple of "+strconv.Itoa(peaksResolution), http.StatusBadRequest)
+		return
+	}
+
+	if format == "dat" {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+		return
+	}
+	respondOK(w, p)
+}
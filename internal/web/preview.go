@@ -0,0 +1,172 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/job"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/audio"
+	"github.com/sewiti/munit-backend/pkg/transcode"
+)
+
+const (
+	previewCacheAge    = 24 * 60 * 60 // Previews change only if their settings do
+	previewMaxChannels = 2
+)
+
+// Preview settings, see config.Preview.
+var (
+	previewFormat = "wav"
+	previewRate   = 22050
+)
+
+// enqueuePreview queues generation of a preview of file's audio.
+func enqueuePreview(f *model.File) {
+	if !analyzable(f) {
+		return
+	}
+	hash, format, rate := f.Hash, previewFormat, previewRate
+	job.Enqueue(fmt.Sprintf("preview:%s:%d:%s", format, rate, hash), func(ctx context.Context) error {
+		return generatePreview(ctx, hash, format, rate)
+	})
+}
+
+// generatePreview transcodes the blob into a preview in the format, at most at
+// the sample rate. Failures are stored as well, so that they are not retried.
+func generatePreview(ctx context.Context, hash, format string, rate int) error {
+	if done, err := model.HasPreview(ctx, hash, format, rate); err != nil || done {
+		return err
+	}
+	e, ok := transcode.Lookup(format)
+	if !ok {
+		return fmt.Errorf("preview: no encoder for format %s", format)
+	}
+	data, err := model.GetBlob(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // deleted meanwhile
+		}
+		return err
+	}
+
+	p := &model.Preview{
+		Hash:        hash,
+		Format:      format,
+		SampleRate:  rate,
+		ContentType: e.ContentType(),
+		Created:     time.Now().Truncate(time.Second),
+	}
+	p.Data, err = renderPreview(ctx, data, e, rate)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.WithError(err).WithField("blob", hash).Warn("unable to generate preview")
+		p.Error = err.Error()
+	}
+	return model.SetPreview(ctx, p)
+}
+
+// renderPreview decodes audio data, downmixes it to stereo, downsamples it to
+// maxRate and encodes it with e.
+func renderPreview(ctx context.Context, data []byte, e transcode.Encoder, maxRate int) ([]byte, error) {
+	info, err := audio.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	channels, rate := info.Channels, info.SampleRate
+	if channels > previewMaxChannels {
+		channels = previewMaxChannels
+	}
+	if rate > maxRate {
+		rate = maxRate
+	}
+
+	var buf bytes.Buffer
+	w, err := e.NewWriter(&buf, rate, channels)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		rs    *transcode.Resampler
+		mixed []float64
+	)
+	if rate != info.SampleRate {
+		rs, err = transcode.NewResampler(info.SampleRate, rate, channels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = audio.Decode(data, func(samples []float64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mixed = transcode.Downmix(mixed[:0], samples, info.Channels, channels)
+		if rs != nil {
+			return w.Write(rs.Write(mixed))
+		}
+		return w.Write(mixed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rs != nil {
+		if err = w.Write(rs.Flush()); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// filePreviewGet responds with a lightweight preview of file's audio for
+// auditioning. Range and conditional requests are supported, so that players
+// can seek and clients can cache it. 202 is responded while it's generated.
+func filePreviewGet(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	f, err := model.GetFileMeta(r.Context(), ids[0], ids[1], ids[2])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if !analyzable(f) {
+		respondMsg(w, "file is not a decodable audio file", http.StatusUnprocessableEntity)
+		return
+	}
+
+	p, err := model.GetPreview(r.Context(), f.Hash, previewFormat, previewRate)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not generated yet, or lost on restart before it was.
+		enqueuePreview(f)
+		w.Header().Set("Retry-After", "5")
+		respondMsg(w, "preview is being generated", http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if p.Error != "" {
+		respondMsg(w, "unable to generate preview: "+p.Error, http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", p.ContentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s-%d-%d"`, p.Hash, p.Format, p.SampleRate, p.Created.Unix()))
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", previewCacheAge))
+	http.ServeContent(w, r, "", p.Created, bytes.NewReader(p.Data))
+}
@@ -2,9 +2,12 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/apex/log"
@@ -20,7 +23,12 @@ func projectGetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := model.GetAllProjects(r.Context(), uid)
+	filter, err := getProjectFilter(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.GetAllProjects(r.Context(), uid, filter)
 	if err != nil {
 		respondErr(w, err)
 		return
@@ -43,6 +51,53 @@ func projectGet(w http.ResponseWriter, r *http.Request) {
 	respondOK(w, p)
 }
 
+// getProjectFilter parses project listing's filter query parameters: minBPM,
+// maxBPM, key, timeSignature and genre.
+func getProjectFilter(r *http.Request) (model.ProjectFilter, error) {
+	q := r.URL.Query()
+	f := model.ProjectFilter{
+		Key:           q.Get("key"),
+		TimeSignature: q.Get("timeSignature"),
+		Genre:         q.Get("genre"),
+	}
+	for _, p := range []struct {
+		name string
+		v    *float64
+	}{{"minBPM", &f.MinBPM}, {"maxBPM", &f.MaxBPM}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 {
+			return model.ProjectFilter{}, fmt.Errorf("%s: must be a positive number", p.name)
+		}
+		*p.v = v
+	}
+	return f, nil
+}
+
+// exploreProjectGetAll responds with the directory of public projects. It is
+// served without authentication.
+func exploreProjectGetAll(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := getPage(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	filter, err := getProjectFilter(r)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	p, err := model.GetPublicProjects(r.Context(), r.URL.Query().Get("query"), filter, limit, offset)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
 func projectPost(w http.ResponseWriter, r *http.Request) {
 	uid, err := getUser(r)
 	if err != nil {
@@ -63,10 +118,35 @@ func projectPost(w http.ResponseWriter, r *http.Request) {
 		respondInternalError(w)
 		return
 	}
+	if p.Org != "" {
+		o, err := model.GetOrganization(r.Context(), p.Org)
+		if err != nil {
+			respondErr(w, fmt.Errorf("organization: %w", err))
+			return
+		}
+		role, ok := o.RoleOf(uid)
+		if !ok {
+			respondErr(w, errForbidden)
+			return
+		}
+		// Admins own organization's projects, other members maintain
+		// projects they create.
+		if role != model.OrgRoleAdmin {
+			p.Contributors = removeID(p.Contributors, uid)
+			p.Maintainers = append(removeID(p.Maintainers, uid), uid)
+		}
+		p.Owner = ""
+	} else {
+		p.Owner = uid
+	}
+
 	now := time.Now().Truncate(time.Second)
-	p.Owner = uid
+	p.Upstream = "" // see projectForkPost
 	p.Created = now
 	p.Modified = now
+	if p.Visibility == "" {
+		p.Visibility = model.VisibilityPrivate
+	}
 
 	if err = model.InsertProject(r.Context(), &p); err != nil {
 		respondErr(w, err)
@@ -75,6 +155,70 @@ func projectPost(w http.ResponseWriter, r *http.Request) {
 	respond(w, p, http.StatusCreated)
 }
 
+// projectForkPost creates a private copy of a project the user can read,
+// owned by the user. Name defaults to upstream's name.
+func projectForkPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err = decodeJSON(r, &body); err != nil {
+			respondErr(w, err)
+			return
+		}
+	}
+
+	upstream, err := model.GetProject(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if !projectReadable(upstream, uid) {
+		respondErr(w, errForbidden)
+		return
+	}
+
+	fork := &model.Project{
+		Name:         upstream.Name,
+		Description:  upstream.Description,
+		Visibility:   model.VisibilityPrivate,
+		Music:        upstream.Music,
+		Owner:        uid,
+		Contributors: make([]id.ID, 0),
+		Maintainers:  make([]id.ID, 0),
+	}
+	if body.Name != "" {
+		fork.Name = body.Name
+	}
+	fork.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to generate id")
+		respondInternalError(w)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	fork.Created = now
+	fork.Modified = now
+
+	if err = model.ForkProject(r.Context(), upstream.ID, fork); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, fork, http.StatusCreated)
+}
+
 func projectPatch(w http.ResponseWriter, r *http.Request) {
 	if err := assertJSON(r); err != nil {
 		respondErr(w, err)
@@ -99,7 +243,7 @@ func projectPatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p, err := model.UpdateProject(r.Context(), ids[0], func(p *model.Project) error {
-		if p.Owner != uid {
+		if !p.HasRole(uid, model.RoleOwner) {
 			return errForbidden
 		}
 
@@ -110,9 +254,91 @@ func projectPatch(w http.ResponseWriter, r *http.Request) {
 		p.ID = orig.ID
 		p.Created = orig.Created
 		p.Modified = time.Now().Truncate(time.Second)
+		p.Owner = orig.Owner // see projectTransferPost
+		p.Org = orig.Org
+		p.Upstream = orig.Upstream
 		if p.Contributors == nil {
 			p.Contributors = make([]id.ID, 0)
 		}
+		if p.Maintainers == nil {
+			p.Maintainers = make([]id.ID, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, p)
+}
+
+// projectTransferPost transfers project's ownership to one of its contributors
+// or maintainers, or to an organization the user is an admin of. Previous
+// owning user stays as a maintainer.
+func projectTransferPost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var body struct {
+		Owner id.ID `json:"ownerID"`
+		Org   id.ID `json:"organizationID"`
+	}
+	if err = decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if body.Org != "" {
+		o, err := model.GetOrganization(r.Context(), body.Org)
+		if err != nil {
+			respondErr(w, fmt.Errorf("organization: %w", err))
+			return
+		}
+		if role, _ := o.RoleOf(uid); role != model.OrgRoleAdmin {
+			respondErr(w, errForbidden)
+			return
+		}
+	} else if err = body.Owner.Validate(); err != nil {
+		respondErr(w, fmt.Errorf("owner: %w", err))
+		return
+	}
+
+	p, err := model.UpdateProject(r.Context(), ids[0], func(p *model.Project) error {
+		if !p.HasRole(uid, model.RoleOwner) {
+			return errForbidden
+		}
+		if body.Org != "" {
+			if body.Org == p.Org {
+				return errors.New("organization already owns the project")
+			}
+		} else {
+			if body.Owner == p.Owner {
+				return errors.New("user already owns the project")
+			}
+			if _, ok := p.RoleOf(body.Owner); !ok {
+				return errors.New("new owner must be a contributor or a maintainer")
+			}
+			p.Contributors = removeID(p.Contributors, body.Owner)
+			p.Maintainers = removeID(p.Maintainers, body.Owner)
+		}
+
+		if p.Owner != "" {
+			p.Maintainers = append(p.Maintainers, p.Owner)
+		}
+		p.Owner = body.Owner
+		p.Org = body.Org
+		if p.Org != "" {
+			p.Owner = ""
+		}
+		p.Modified = time.Now().Truncate(time.Second)
 		return nil
 	})
 	if err != nil {
@@ -140,7 +366,7 @@ func projectDelete(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, err)
 		return
 	}
-	if p.Owner != uid {
+	if !p.HasRole(uid, model.RoleOwner) {
 		respondErr(w, errForbidden)
 		return
 	}
@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/go-sql-driver/mysql"
@@ -12,6 +15,7 @@ import (
 )
 
 var (
+	errUnauthorized     = errors.New("401 Unauthorized")
 	errForbidden        = errors.New("403 Forbidden")
 	errUnsupportedMedia = errors.New("415 Unsupported Media Type")
 	errInternalError    = errors.New("500 Internal Server Error")
@@ -47,11 +51,15 @@ func respondOK(w http.ResponseWriter, body interface{}) {
 }
 
 // respondErr responds based on error type.
-//	- errForbidden:          403
-//	- model.ErrNotFound:     404
-//	- sql.ErrNoRows:         404
-//	- errUnsupportedContent: 415
-//	- errInternalError:      500
+//	- errUnauthorized:         401
+//	- errForbidden:            403
+//	- model.ErrNotFound:       404
+//	- sql.ErrNoRows:           404
+//	- model.ErrOwnsProjects:   409
+//	- model.ErrLastOrgAdmin:   409
+//	- model.ErrOrgOwnsProject: 409
+//	- errUnsupportedContent:   415
+//	- errInternalError:        500
 func respondErr(w http.ResponseWriter, err error) {
 	code := http.StatusBadRequest
 	if sqlErr, ok := err.(*mysql.MySQLError); ok {
@@ -68,9 +76,17 @@ func respondErr(w http.ResponseWriter, err error) {
 	case errors.Is(err, model.ErrNotFound):
 		code = http.StatusNotFound
 
+	case errors.Is(err, errUnauthorized):
+		code = http.StatusUnauthorized
+
 	case errors.Is(err, errForbidden):
 		code = http.StatusForbidden
 
+	case errors.Is(err, model.ErrOwnsProjects),
+		errors.Is(err, model.ErrLastOrgAdmin),
+		errors.Is(err, model.ErrOrgOwnsProject):
+		code = http.StatusConflict
+
 	case errors.Is(err, errUnsupportedMedia):
 		code = http.StatusUnsupportedMediaType
 
@@ -92,3 +108,10 @@ func respondUnauthorized(w http.ResponseWriter) {
 func respondInternalError(w http.ResponseWriter) {
 	respondMsg(w, "500 Internal Server Error", http.StatusInternalServerError)
 }
+
+// respondTooManyRequests responds with 429 and Retry-After header.
+func respondTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(secs))
+	respondMsg(w, "429 Too Many Requests", http.StatusTooManyRequests)
+}
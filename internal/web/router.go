@@ -6,15 +6,24 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/sewiti/munit-backend/internal/config"
+	"github.com/sewiti/munit-backend/pkg/oidc"
 )
 
 const (
 	userID    = "userID"    // User ID path key
 	projectID = "projectID" // Project ID path key
 	commitID  = "commitID"  // Commit ID path key
+	baseID    = "baseID"    // Compared commit ID path key
 	fileID    = "fileID"    // File ID path key
 
-	idPattern = "[A-Za-z0-9]+"
+	invitationID = "invitationID" // Invitation ID path key
+	commentID    = "commentID"    // Comment ID path key
+	orgID        = "orgID"        // Organization ID path key
+	teamID       = "teamID"       // Team ID path key
+	tokenKey     = "token"        // Token path key
+
+	idPattern    = "[A-Za-z0-9]+"
+	tokenPattern = "[A-Za-z0-9_-]+"
 
 	defaultBodyLimit     = 1024 * 1024      // 1MiB
 	defaultFileBodyLimit = 1024 * 1024 * 50 // 50MiB
@@ -25,30 +34,144 @@ func NewRouter(cfg *config.Munit) http.Handler {
 		userVar    = "{" + userID + ":" + idPattern + "}"
 		projectVar = "{" + projectID + ":" + idPattern + "}"
 		commitVar  = "{" + commitID + ":" + idPattern + "}"
+		baseVar    = "{" + baseID + ":" + idPattern + "}"
 		fileVar    = "{" + fileID + ":" + idPattern + "}"
+
+		invitationVar = "{" + invitationID + ":" + idPattern + "}"
+		tokenVar      = "{" + tokenKey + ":" + tokenPattern + "}"
+		shareVar      = "{" + shareID + ":" + idPattern + "}"
+		commentVar    = "{" + commentID + ":" + idPattern + "}"
+		orgVar        = "{" + orgID + ":" + idPattern + "}"
+		teamVar       = "{" + teamID + ":" + idPattern + "}"
 	)
+	appURL = cfg.AppURL
+	previewFormat = cfg.Preview.Format
+	previewRate = cfg.Preview.SampleRate
 	r := mux.NewRouter()
 
 	// Auth
 	r.Methods("POST").Path("/register").HandlerFunc(registerPost)
 	r.Methods("POST").Path("/login").HandlerFunc(loginPost)
+	r.Methods("POST").Path("/login/2fa").HandlerFunc(loginTwoFactorPost)
+	r.Methods("POST").Path("/verify-email").HandlerFunc(verifyEmailPost)
+	r.Methods("POST").Path("/password-reset/request").HandlerFunc(passwdResetRequestPost)
+	r.Methods("POST").Path("/password-reset").HandlerFunc(passwdResetPost)
+
+	// OpenID Connect
+	if cfg.OIDC.Issuer != "" {
+		oidcProvider = oidc.New(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		r.Methods("GET").Path("/oidc/login").HandlerFunc(oidcLoginGet)
+		r.Methods("GET").Path("/oidc/callback").HandlerFunc(oidcCallbackGet)
+	}
+
+	// Avatars are public, see avatarGet
+	r.Methods("GET").Path("/avatars/" + tokenVar + "/{" + avatarSize + ":[0-9]+}").HandlerFunc(avatarGet)
+
+	// Public project directory
+	r.Methods("GET").Path("/explore/projects").HandlerFunc(exploreProjectGetAll)
+
+	// Share links are public, see getShare
+	share := r.PathPrefix("/shares/" + tokenVar).Subrouter()
+	share.Methods("GET").Path("").HandlerFunc(publicShareGet)
+	share.Methods("GET").Path("/commits/" + commitVar + "/files").HandlerFunc(publicShareFileGetAll)
+	share.Methods("GET").Path("/commits/" + commitVar + "/files/" + fileVar + "/download").HandlerFunc(publicShareFileDownload)
+
+	users := r.PathPrefix("/users").Subrouter()
+	users.Use(authMiddleware)
+	users.Methods("GET").Path("").HandlerFunc(userSearchGet)
 
 	// Profile
 	profile := r.PathPrefix("/profile").Subrouter()
 	profile.Use(authMiddleware)
-	profile.Methods("GET").Path("/" + userVar).HandlerFunc(profileGet)
 	profile.Methods("GET").Path("").HandlerFunc(profileSelfGet)
 	profile.Methods("PATCH").Path("").HandlerFunc(profilePatch)
 	profile.Methods("DELETE").Path("").HandlerFunc(profileDelete)
+	profile.Methods("GET").Path("/invitations").HandlerFunc(profileInvitationGetAll)
+	profile.Methods("GET").Path("/org-invitations").HandlerFunc(profileOrgInvitationGetAll)
+	profile.Methods("PUT").Path("/avatar").HandlerFunc(profileAvatarPut)
+	profile.Methods("DELETE").Path("/avatar").HandlerFunc(profileAvatarDelete)
+	profile.Methods("POST").Path("/verify-email").HandlerFunc(profileVerifyEmailPost)
+	profile.Methods("GET").Path("/2fa").HandlerFunc(twoFactorGet)
+	profile.Methods("POST").Path("/2fa").HandlerFunc(twoFactorPost)
+	profile.Methods("DELETE").Path("/2fa").HandlerFunc(twoFactorDelete)
+	profile.Methods("POST").Path("/2fa/confirm").HandlerFunc(twoFactorConfirmPost)
+	profile.Methods("POST").Path("/2fa/recovery-codes").HandlerFunc(twoFactorRecoveryPost)
+	profile.Methods("GET").Path("/" + userVar).HandlerFunc(profileGet) // last, not to shadow the above
+
+	// Invitation
+	invitation := r.PathPrefix("/invitations").Subrouter()
+	invitation.Use(authMiddleware)
+	if cfg.RequireVerified {
+		invitation.Use(verifiedMiddleware)
+	}
+	invitation.Methods("POST").Path("/" + tokenVar + "/accept").HandlerFunc(invitationAcceptPost)
+	invitation.Methods("POST").Path("/" + tokenVar + "/decline").HandlerFunc(invitationDeclinePost)
+	invitation.Methods("POST").Path("/organizations/" + tokenVar + "/accept").HandlerFunc(orgInvitationAcceptPost)
+	invitation.Methods("POST").Path("/organizations/" + tokenVar + "/decline").HandlerFunc(orgInvitationDeclinePost)
+
+	// Organization
+	org := r.PathPrefix("/organizations").Subrouter()
+	org.Use(authMiddleware)
+	if cfg.RequireVerified {
+		org.Use(verifiedMiddleware)
+	}
+	org.Methods("GET").Path("").HandlerFunc(orgGetAll)
+	org.Methods("POST").Path("").HandlerFunc(orgPost)
+	org.Methods("GET").Path("/" + orgVar).HandlerFunc(orgGet)
+	org.Methods("PATCH").Path("/" + orgVar).HandlerFunc(orgPatch)
+	org.Methods("DELETE").Path("/" + orgVar).HandlerFunc(orgDelete)
+	org.Methods("POST").Path("/" + orgVar + "/leave").HandlerFunc(orgLeavePost)
+	org.Methods("GET").Path("/" + orgVar + "/projects").HandlerFunc(orgProjectGetAll)
+	org.Methods("GET").Path("/" + orgVar + "/invitations").HandlerFunc(orgInvitationGetAll)
+	org.Methods("POST").Path("/" + orgVar + "/invitations").HandlerFunc(orgInvitationPost)
+	org.Methods("DELETE").Path("/" + orgVar + "/invitations/" + invitationVar).HandlerFunc(orgInvitationDelete)
+	org.Methods("GET").Path("/" + orgVar + "/teams").HandlerFunc(teamGetAll)
+	org.Methods("POST").Path("/" + orgVar + "/teams").HandlerFunc(teamPost)
+	org.Methods("GET").Path("/" + orgVar + "/teams/" + teamVar).HandlerFunc(teamGet)
+	org.Methods("PATCH").Path("/" + orgVar + "/teams/" + teamVar).HandlerFunc(teamPatch)
+	org.Methods("DELETE").Path("/" + orgVar + "/teams/" + teamVar).HandlerFunc(teamDelete)
+
+	// Project fork is allowed for anyone able to read the project, unlike
+	// other project writes, see projectMiddleware.
+	fork := r.Methods("POST").Path("/projects/" + projectVar + "/fork").Subrouter()
+	fork.Use(authMiddleware)
+	if cfg.RequireVerified {
+		fork.Use(verifiedMiddleware)
+	}
+	fork.Methods("POST").Path("").HandlerFunc(projectForkPost)
 
 	// Project
 	project := r.PathPrefix("/projects").Subrouter()
-	project.Use(authMiddleware)
+	project.Use(optionalAuthMiddleware)
+	if cfg.RequireVerified {
+		project.Use(verifiedMiddleware)
+	}
+	project.Use(projectMiddleware)
 	project.Methods("GET").Path("").HandlerFunc(projectGetAll)
 	project.Methods("POST").Path("").HandlerFunc(projectPost)
 	project.Methods("GET").Path("/" + projectVar).HandlerFunc(projectGet)
 	project.Methods("PATCH").Path("/" + projectVar).HandlerFunc(projectPatch)
 	project.Methods("DELETE").Path("/" + projectVar).HandlerFunc(projectDelete)
+	project.Methods("POST").Path("/" + projectVar + "/transfer").HandlerFunc(projectTransferPost)
+
+	// Project invitation
+	projectInvitation := project.PathPrefix("/" + projectVar + "/invitations").Subrouter()
+	projectInvitation.Use(userMiddleware)
+	projectInvitation.Methods("GET").Path("").HandlerFunc(invitationGetAll)
+	projectInvitation.Methods("POST").Path("").HandlerFunc(invitationPost)
+	projectInvitation.Methods("DELETE").Path("/" + invitationVar).HandlerFunc(invitationDelete)
+
+	// Project share
+	projectShare := project.PathPrefix("/" + projectVar + "/shares").Subrouter()
+	projectShare.Use(userMiddleware)
+	projectShare.Methods("GET").Path("").HandlerFunc(shareGetAll)
+	projectShare.Methods("POST").Path("").HandlerFunc(sharePost)
+	projectShare.Methods("DELETE").Path("/" + shareVar).HandlerFunc(shareDelete)
 
 	// Commit
 	commit := project.PathPrefix("/" + projectVar + "/commits").Subrouter()
@@ -57,6 +180,9 @@ func NewRouter(cfg *config.Munit) http.Handler {
 	commit.Methods("GET").Path("/" + commitVar).HandlerFunc(commitGet)
 	commit.Methods("PATCH").Path("/" + commitVar).HandlerFunc(commitPatch)
 	commit.Methods("DELETE").Path("/" + commitVar).HandlerFunc(commitDelete)
+	commit.Methods("GET").Path("/" + commitVar + "/compare/" + baseVar).HandlerFunc(commitCompareGet)
+	commit.Methods("GET").Path("/" + commitVar + "/compare/" + baseVar + "/midi").HandlerFunc(commitCompareMIDIGet)
+	commit.Methods("GET").Path("/" + commitVar + "/comments").HandlerFunc(commitCommentGetAll)
 
 	// File
 	file := commit.PathPrefix("/" + commitVar + "/files").Subrouter()
@@ -65,10 +191,40 @@ func NewRouter(cfg *config.Munit) http.Handler {
 	file.Methods("GET").Path("/" + fileVar).HandlerFunc(fileGet)
 	file.Methods("PATCH").Path("/" + fileVar).HandlerFunc(filePatch)
 	file.Methods("DELETE").Path("/" + fileVar).HandlerFunc(fileDelete)
+	file.Methods("GET").Path("/" + fileVar + "/peaks").HandlerFunc(filePeaksGet)
+	file.Methods("GET").Path("/" + fileVar + "/preview").HandlerFunc(filePreviewGet)
+	file.Methods("GET").Path("/" + fileVar + "/download").HandlerFunc(fileDownloadGet)
+	file.Methods("GET").Path("/" + fileVar + "/comments").HandlerFunc(fileCommentGetAll)
+	file.Methods("POST").Path("/" + fileVar + "/comments").HandlerFunc(fileCommentPost)
+
+	// Comment
+	comment := project.PathPrefix("/" + projectVar + "/comments").Subrouter()
+	comment.Methods("PATCH").Path("/" + commentVar).HandlerFunc(commentPatch)
+	comment.Methods("DELETE").Path("/" + commentVar).HandlerFunc(commentDelete)
+	comment.Methods("POST").Path("/" + commentVar + "/resolve").HandlerFunc(commentResolvePost)
+	comment.Methods("POST").Path("/" + commentVar + "/unresolve").HandlerFunc(commentUnresolvePost)
+
+	// Admin
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(authMiddleware)
+	admin.Use(adminMiddleware)
+	admin.Methods("GET").Path("/users").HandlerFunc(adminUserGetAll)
+	admin.Methods("GET").Path("/users/" + userVar).HandlerFunc(adminUserGet)
+	admin.Methods("PATCH").Path("/users/" + userVar).HandlerFunc(adminUserPatch)
+	admin.Methods("GET").Path("/projects").HandlerFunc(adminProjectGetAll)
+	admin.Methods("GET").Path("/projects/" + projectVar).HandlerFunc(adminProjectGet)
+	admin.Methods("POST").Path("/projects/" + projectVar + "/owner").HandlerFunc(adminProjectOwnerPost)
+	admin.Methods("GET").Path("/stats").HandlerFunc(adminStatsGet)
+	admin.Methods("GET").Path("/audit").HandlerFunc(adminAuditGetAll)
 
 	// Setup CORS
 	origins := handlers.AllowedOrigins([]string{cfg.AllowedOrigin})
-	headers := handlers.AllowedHeaders([]string{"Authorization", "Content-Type"})
+	headers := handlers.AllowedHeaders([]string{"Authorization", "Content-Type", sharePasswordHeader})
 	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE"})
-	return handlers.CORS(origins, headers, methods)(r)
+	exposed := handlers.ExposedHeaders([]string{"Retry-After"})
+	h := handlers.CORS(origins, headers, methods, exposed)(r)
+	if cfg.TrustProxy {
+		h = handlers.ProxyHeaders(h)
+	}
+	return h
 }
@@ -0,0 +1,310 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+	"github.com/sewiti/munit-backend/pkg/throttle"
+)
+
+const (
+	shareID             = "shareID"          // Share ID path key
+	sharePasswordHeader = "X-Share-Password" // Password of protected shares
+	shareDisposition    = "attachment"       // Downloads are saved, not shown
+	shareContentType    = "application/octet-stream"
+)
+
+// shareThrottle slows down guessing passwords of protected shares.
+var shareThrottle = throttle.New()
+
+func shareGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	s, err := model.GetAllShares(r.Context(), ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, s)
+}
+
+func sharePost(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var s model.Share
+	if err = decodeJSON(r, &s); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if _, err = verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	// Shared commit and file must belong to the project.
+	if s.Commit != "" {
+		if _, err = model.GetCommit(r.Context(), ids[0], s.Commit); err != nil {
+			respondErr(w, fmt.Errorf("commit: %w", err))
+			return
+		}
+	}
+	if s.Commit != "" && s.File != "" {
+		if _, err = model.GetFile(r.Context(), ids[0], s.Commit, s.File); err != nil {
+			respondErr(w, fmt.Errorf("file: %w", err))
+			return
+		}
+	}
+
+	s.ID, err = id.New()
+	if err != nil {
+		log.WithError(err).Error("unable to make id")
+		respondInternalError(w)
+		return
+	}
+	s.Token, err = auth.MakeToken()
+	if err != nil {
+		log.WithError(err).Error("unable to make token")
+		respondInternalError(w)
+		return
+	}
+	s.TokenHash = auth.HashToken(s.Token)
+	s.PasswdHash = ""
+	if s.Password != "" {
+		s.PasswdHash, err = auth.HashPasswd([]byte(s.Password))
+		if err != nil {
+			log.WithError(err).Error("unable to hash password")
+			respondInternalError(w)
+			return
+		}
+	}
+	s.Password = "" // never output it
+	s.HasPassword = s.PasswdHash != ""
+	s.Views = 0
+	s.Downloads = 0
+	s.Created = time.Now().Truncate(time.Second)
+	s.Project = ids[0]
+	s.Creator = uid
+
+	if err = model.InsertShare(r.Context(), &s); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, s, http.StatusCreated)
+}
+
+func shareDelete(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, projectID, shareID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if _, err = verifyProjectRole(r.Context(), ids[0], uid, model.RoleMaintainer); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.DeleteShare(r.Context(), ids[0], ids[1]); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+// sharedProject is what share links show of the project.
+type sharedProject struct {
+	ProjectID   id.ID          `json:"projectID"`
+	ProjectName string         `json:"projectName"`
+	Expires     *time.Time     `json:"expires"`
+	Downloads   int            `json:"downloads"`
+	Max         int            `json:"maxDownloads"`
+	Commits     []model.Commit `json:"commits"`
+}
+
+// publicShareGet responds with shared commits. It is served without
+// authentication, see getShare.
+func publicShareGet(w http.ResponseWriter, r *http.Request) {
+	s, ok := getShare(w, r)
+	if !ok {
+		return
+	}
+	p, err := model.GetProject(r.Context(), s.Project)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	var commits []model.Commit
+	if s.Commit == "" {
+		commits, err = model.GetAllCommits(r.Context(), s.Project)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+	} else {
+		c, err := model.GetCommit(r.Context(), s.Project, s.Commit)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		commits = []model.Commit{*c}
+	}
+
+	if err = model.CountShareView(r.Context(), s.ID); err != nil {
+		log.WithError(err).WithField("share", s.ID).Error("unable to count share view")
+	}
+	respondOK(w, sharedProject{
+		ProjectID:   p.ID,
+		ProjectName: p.Name,
+		Expires:     s.Expires,
+		Downloads:   s.Downloads,
+		Max:         s.MaxDownloads,
+		Commits:     commits,
+	})
+}
+
+// publicShareFileGetAll responds with shared files of a commit, without their
+// data. Data is downloaded with publicShareFileDownload.
+func publicShareFileGetAll(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, commitID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	s, ok := getShare(w, r)
+	if !ok {
+		return
+	}
+	if !s.Allows(ids[0], "") {
+		respondErr(w, model.ErrNotFound)
+		return
+	}
+
+	files, err := model.GetAllFilesMeta(r.Context(), s.Project, ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	shared := make([]model.File, 0, len(files))
+	for _, f := range files {
+		if s.Allows(ids[0], f.ID) {
+			shared = append(shared, f)
+		}
+	}
+	respondOK(w, shared)
+}
+
+// publicShareFileDownload responds with raw file data and counts a download.
+func publicShareFileDownload(w http.ResponseWriter, r *http.Request) {
+	ids, err := getIDs(r, commitID, fileID)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	s, ok := getShare(w, r)
+	if !ok {
+		return
+	}
+	if !s.Allows(ids[0], ids[1]) {
+		respondErr(w, model.ErrNotFound)
+		return
+	}
+
+	f, err := model.GetFile(r.Context(), s.Project, ids[0], ids[1])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = model.CountShareDownload(r.Context(), s.ID); err != nil {
+		if errors.Is(err, model.ErrShareExhausted) {
+			respondMsg(w, err.Error(), http.StatusGone)
+			return
+		}
+		respondErr(w, err)
+		return
+	}
+
+	_, name := path.Split(f.Path)
+	w.Header().Set("Content-Type", shareContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.Data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(shareDisposition, map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "private, no-store") // downloads must be counted
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(f.Data)
+}
+
+// getShare gets the share by path's token, checks its expiry, download limit
+// and password. If share cannot be used, responds with an error and returns
+// false.
+func getShare(w http.ResponseWriter, r *http.Request) (*model.Share, bool) {
+	token := mux.Vars(r)[tokenKey]
+	s, err := model.GetShareByToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		respondErr(w, err)
+		return nil, false
+	}
+	if err = s.Check(time.Now()); err != nil {
+		respondMsg(w, err.Error(), http.StatusGone)
+		return nil, false
+	}
+	if s.PasswdHash == "" {
+		return s, true
+	}
+
+	if retry, ok := shareThrottle.Allow(token); !ok {
+		respondTooManyRequests(w, retry)
+		return nil, false
+	}
+	password := r.Header.Get(sharePasswordHeader)
+	if password == "" {
+		shareThrottle.Release(token)
+		respondMsg(w, "share link is password protected", http.StatusUnauthorized)
+		return nil, false
+	}
+	if ok, _ := auth.VerifyPasswd(s.PasswdHash, []byte(password), nil); !ok {
+		shareThrottle.Fail(token)
+		respondMsg(w, "share link password is incorrect", http.StatusUnauthorized)
+		return nil, false
+	}
+	shareThrottle.Release(token)
+	return s, true
+}
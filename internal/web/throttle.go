@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/throttle"
+)
+
+// Failed login attempts are tracked both per account, to stop guessing a
+// single password, and per IP, to stop spraying many accounts.
+var (
+	accountThrottle = throttle.New()
+	ipThrottle      = func() *throttle.Throttle {
+		t := throttle.New()
+		t.Free = 20
+		t.LockoutAfter = 100
+		t.Lockout = time.Hour
+		return t
+	}()
+)
+
+// searchLimiter limits user searches and invitations per user, so that emails
+// cannot be enumerated.
+var searchLimiter = throttle.NewRateLimiter(30, time.Minute)
+
+// allowLogin reserves a login attempt for the account from request's IP. If
+// it may not be made now, responds with 429. The attempt must end with
+// loginFailed, loginSucceeded or loginReleased.
+func allowLogin(w http.ResponseWriter, r *http.Request, account string) bool {
+	retry, ok := accountThrottle.Allow(account)
+	if ok {
+		retry, ok = ipThrottle.Allow(remoteIP(r))
+		if !ok {
+			accountThrottle.Release(account)
+		}
+	}
+	if !ok {
+		respondTooManyRequests(w, retry)
+	}
+	return ok
+}
+
+// loginFailed records a failed login attempt and audits lockouts.
+func loginFailed(ctx context.Context, r *http.Request, account string) {
+	ip := remoteIP(r)
+	if _, lockout := accountThrottle.Fail(account); lockout {
+		auditLockout(ctx, r, account, accountThrottle)
+	}
+	if _, lockout := ipThrottle.Fail(ip); lockout {
+		auditLockout(ctx, r, account, ipThrottle)
+	}
+}
+
+// loginSucceeded forgets account's failed attempts.
+func loginSucceeded(r *http.Request, account string) {
+	accountThrottle.Reset(account)
+	ipThrottle.Release(remoteIP(r))
+}
+
+// loginReleased releases a login attempt which neither failed nor succeeded,
+// e.g. because of an internal error.
+func loginReleased(r *http.Request, account string) {
+	accountThrottle.Release(account)
+	ipThrottle.Release(remoteIP(r))
+}
+
+func auditLockout(ctx context.Context, r *http.Request, account string, t *throttle.Throttle) {
+	scope := "account"
+	if t == ipThrottle {
+		scope = "ip"
+	}
+	insertAudit(ctx, r, model.AuditLoginLockout, account,
+		fmt.Sprintf("%s locked out for %v after %d failed attempts", scope, t.Lockout, t.LockoutAfter))
+	log.WithFields(log.Fields{
+		"account": account,
+		"ip":      remoteIP(r),
+		"scope":   scope,
+	}).Warn("login lockout")
+}
+
+// remoteIP returns request's IP without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr // already without port, e.g. set by proxy headers
+	}
+	return host
+}
+
+// accountKey normalizes account identifier used for throttling.
+func accountKey(prefix, account string) string {
+	return prefix + ":" + strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,270 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/model"
+	"github.com/sewiti/munit-backend/pkg/id"
+	"github.com/sewiti/munit-backend/pkg/totp"
+)
+
+const (
+	totpIssuer        = "munit"
+	totpSkew          = 1 // Steps of allowed clock drift
+	recoveryCodeCount = 10
+)
+
+var errInvalidCode = errors.New("invalid code")
+
+// secondFactor is a request body carrying either a TOTP code or a recovery
+// code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// verifySecondFactor checks user's TOTP code, or consumes a recovery code.
+func verifySecondFactor(ctx context.Context, uid id.ID, f *secondFactor) error {
+	switch {
+	case f.Code != "":
+		_, err := model.UpdateTOTP(ctx, uid, func(t *model.TOTP) error {
+			if !t.Confirmed {
+				return errInvalidCode
+			}
+			step, ok := totp.Verify(t.Secret, f.Code, time.Now(), totpSkew)
+			if !ok || step <= t.LastStep {
+				return errInvalidCode
+			}
+			t.LastStep = step
+			return nil
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidCode
+		}
+		return err
+
+	case f.RecoveryCode != "":
+		code := strings.ToLower(strings.TrimSpace(f.RecoveryCode))
+		return model.UseRecoveryCode(ctx, uid, auth.HashToken(code))
+	}
+	return errors.New("code is empty")
+}
+
+// makeRecoveryCodes replaces user's recovery codes with new ones.
+func makeRecoveryCodes(ctx context.Context, uid id.ID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = auth.HashToken(code)
+	}
+	return codes, model.SetRecoveryCodes(ctx, uid, hashes)
+}
+
+func twoFactorGet(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+
+	var enabled bool
+	t, err := model.GetTOTP(r.Context(), uid)
+	switch {
+	case err == nil:
+		enabled = t.Confirmed
+	case !errors.Is(err, sql.ErrNoRows):
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, struct {
+		Enabled bool `json:"enabled"`
+	}{enabled})
+}
+
+// twoFactorPost starts TOTP enrollment. It has to be confirmed with a code
+// from the authenticator app to take effect.
+func twoFactorPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	u, err := model.GetUser(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		log.WithError(err).Error("unable to make totp secret")
+		respondInternalError(w)
+		return
+	}
+	err = model.InsertTOTP(r.Context(), &model.TOTP{
+		User:    uid,
+		Secret:  secret,
+		Created: time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{secret, totp.URI(totpIssuer, u.Email, secret)}, http.StatusCreated)
+}
+
+func twoFactorConfirmPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	var f secondFactor
+	if err = decodeJSON(r, &f); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	_, err = model.UpdateTOTP(r.Context(), uid, func(t *model.TOTP) error {
+		if t.Confirmed {
+			return model.ErrTOTPEnabled
+		}
+		step, ok := totp.Verify(t.Secret, f.Code, time.Now(), totpSkew)
+		if !ok {
+			return errInvalidCode
+		}
+		t.Confirmed = true
+		t.LastStep = step
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	codes, err := makeRecoveryCodes(r.Context(), uid)
+	if err != nil {
+		log.WithError(err).WithField("user", uid).Error("unable to make recovery codes")
+		respondInternalError(w)
+		return
+	}
+	respondOK(w, struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{codes})
+}
+
+func twoFactorRecoveryPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	var f secondFactor
+	if err = decodeJSON(r, &f); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = verifySecondFactor(r.Context(), uid, &f); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	codes, err := makeRecoveryCodes(r.Context(), uid)
+	if err != nil {
+		log.WithError(err).WithField("user", uid).Error("unable to make recovery codes")
+		respondInternalError(w)
+		return
+	}
+	respondOK(w, struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{codes})
+}
+
+func twoFactorDelete(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	var f secondFactor
+	if err = decodeJSON(r, &f); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if err = verifySecondFactor(r.Context(), uid, &f); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	if err = model.DeleteTOTP(r.Context(), uid); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
+
+// loginTwoFactorPost completes the login started by loginPost.
+func loginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Challenge string `json:"challenge"`
+		secondFactor
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	subject, err := auth.VerifyChallengeJWT(body.Challenge)
+	if err != nil {
+		log.WithError(err).Debug("unable to verify challenge jwt")
+		respondUnauthorized(w)
+		return
+	}
+	uid := id.ID(subject)
+
+	account := accountKey("2fa", subject)
+	if !allowLogin(w, r, account) {
+		return
+	}
+	if err = verifySecondFactor(r.Context(), uid, &body.secondFactor); err != nil {
+		if errors.Is(err, errInvalidCode) || errors.Is(err, model.ErrInvalidRecovery) {
+			loginFailed(r.Context(), r, account)
+			respondUnauthorized(w)
+			return
+		}
+		loginReleased(r, account)
+		respondErr(w, err)
+		return
+	}
+	loginSucceeded(r, account)
+
+	token, err := auth.MakeJWT(string(uid))
+	if err != nil {
+		log.WithError(err).WithField("user", uid).Error("unable to make jwt")
+		respondInternalError(w)
+		return
+	}
+	respondOK(w, struct {
+		Token string `json:"token"`
+	}{token})
+}
@@ -1,12 +1,17 @@
 package web
 
 import (
-	"crypto/rand"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/apex/log"
 	"github.com/sewiti/munit-backend/internal/auth"
@@ -28,21 +33,28 @@ func registerPost(w http.ResponseWriter, r *http.Request) {
 		respondInternalError(w)
 		return
 	}
-	u.Salt, err = auth.MakeSalt(rand.Reader)
+	u.PasswdHash, err = auth.HashPasswd([]byte(u.Password))
 	if err != nil {
-		log.WithError(err).Error("unable to make salt")
+		log.WithError(err).Error("unable to hash password")
 		respondInternalError(w)
 		return
 	}
-	u.PasswdHash = auth.HashPasswd([]byte(u.Password), u.Salt)
+	u.Salt = nil
 	now := time.Now().Truncate(time.Second)
 	u.Created = now
 	u.Modified = now
+	u.Verified = false
+	u.Admin = false
+	u.Disabled = false
+	u.Profile.Avatar = ""
 
 	if err = model.InsertUser(r.Context(), u); err != nil {
 		respondErr(w, err)
 		return
 	}
+	if err = sendUserToken(r.Context(), u, model.TokenVerifyEmail, verifyEmailExpiry); err != nil {
+		log.WithError(err).WithField("user", u.ID).Error("unable to send verification email")
+	}
 	u.Password = "" // never ouput it
 	respond(w, u, http.StatusCreated)
 }
@@ -63,16 +75,52 @@ func loginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	account := accountKey("email", u.Email)
+	if !allowLogin(w, r, account) {
+		return
+	}
+
 	dbUsr, err := model.GetUserByEmail(r.Context(), u.Email)
 	if err != nil {
+		loginFailed(r.Context(), r, account)
 		respondUnauthorized(w)
 		return
 	}
 
-	if !auth.VerifyPasswd(dbUsr.PasswdHash, []byte(u.Password), dbUsr.Salt) {
+	ok, rehash := auth.VerifyPasswd(dbUsr.PasswdHash, []byte(u.Password), dbUsr.Salt)
+	if !ok {
+		loginFailed(r.Context(), r, account)
 		respondUnauthorized(w)
 		return
 	}
+	loginSucceeded(r, account)
+	if dbUsr.Disabled {
+		respondErr(w, errDisabled)
+		return
+	}
+	if rehash {
+		upgradePasswdHash(r.Context(), dbUsr.ID, u.Password)
+	}
+
+	// Second factor
+	t, err := model.GetTOTP(r.Context(), dbUsr.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondErr(w, err)
+		return
+	}
+	if err == nil && t.Confirmed {
+		challenge, err := auth.MakeChallengeJWT(string(dbUsr.ID))
+		if err != nil {
+			log.WithError(err).WithField("user", dbUsr.ID).Error("unable to make challenge jwt")
+			respondInternalError(w)
+			return
+		}
+		respondOK(w, struct {
+			Challenge string `json:"challenge"`
+		}{challenge})
+		return
+	}
+
 	token, err := auth.MakeJWT(string(dbUsr.ID))
 	if err != nil {
 		log.WithError(err).WithField("user", dbUsr.ID).Error("unable to make jwt")
@@ -84,18 +132,106 @@ func loginPost(w http.ResponseWriter, r *http.Request) {
 	}{token})
 }
 
+// upgradePasswdHash rehashes user's password with current parameters.
+// Failures are only logged, as the login itself has succeeded.
+func upgradePasswdHash(ctx context.Context, uid id.ID, password string) {
+	hash, err := auth.HashPasswd([]byte(password))
+	if err != nil {
+		log.WithError(err).WithField("user", uid).Error("unable to rehash password")
+		return
+	}
+	_, err = model.UpdateUser(ctx, uid, func(u *model.User) error {
+		u.PasswdHash = hash
+		u.Salt = nil
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("user", uid).Error("unable to update password hash")
+		return
+	}
+	log.WithField("user", uid).Debug("password hash upgraded")
+}
+
+// profileGet responds with other user's public profile. Only users sharing a
+// project with the caller can be seen.
 func profileGet(w http.ResponseWriter, r *http.Request) {
 	ids, err := getIDs(r, userID)
 	if err != nil {
 		respondErr(w, err)
 		return
 	}
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if ids[0] == uid {
+		profileSelfGet(w, r)
+		return
+	}
+
+	shared, err := model.GetSharedProjects(r.Context(), uid, ids[0])
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if len(shared) == 0 {
+		respondErr(w, model.ErrNotFound) // do not reveal user's existence
+		return
+	}
 	u, err := model.GetUser(r.Context(), ids[0])
 	if err != nil {
 		respondErr(w, err)
 		return
 	}
-	respondOK(w, u)
+	respondOK(w, u.Public(shared))
+}
+
+const (
+	minSearchQuery = 3
+	maxSearchUsers = 20
+)
+
+// userSearchGet finds users to add as collaborators, by exact email or by
+// display name among discoverable users and users sharing a project.
+func userSearchGet(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	if retry, ok := searchLimiter.Allow(string(uid)); !ok {
+		respondTooManyRequests(w, retry)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+	if utf8.RuneCountInString(query) < minSearchQuery {
+		respondMsg(w, fmt.Sprintf("query: must be at least %d characters", minSearchQuery), http.StatusBadRequest)
+		return
+	}
+
+	users, err := model.SearchDiscoverableUsers(r.Context(), uid, query, maxSearchUsers)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	res := make([]*model.PublicUser, 0, len(users))
+	for i := range users {
+		shared, err := model.GetSharedProjects(r.Context(), uid, users[i].ID)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		pu := users[i].Public(shared)
+		if strings.EqualFold(users[i].Email, query) {
+			pu.Email = users[i].Email // caller already knows it
+		}
+		res = append(res, pu)
+	}
+	respondOK(w, res)
 }
 
 func profileSelfGet(w http.ResponseWriter, r *http.Request) {
@@ -131,6 +267,7 @@ func profilePatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var emailChanged bool
 	u, err := model.UpdateUser(r.Context(), uid, func(u *model.User) error {
 		orig := u.Copy()
 		if err := json.Unmarshal(data, u); err != nil {
@@ -139,17 +276,22 @@ func profilePatch(w http.ResponseWriter, r *http.Request) {
 		u.ID = orig.ID
 		u.Created = orig.Created
 		u.Modified = time.Now().Truncate(time.Second)
+		emailChanged = u.Email != orig.Email
+		u.Verified = orig.Verified && !emailChanged
+		u.Admin = orig.Admin
+		u.Disabled = orig.Disabled
+		u.Profile.Avatar = orig.Profile.Avatar // see profileAvatarPut
 
 		if u.Password == "" { // means we are not changing password
 			u.PasswdHash = orig.PasswdHash
 			u.Salt = orig.Salt
 		} else {
-			u.Salt, err = auth.MakeSalt(rand.Reader)
+			u.PasswdHash, err = auth.HashPasswd([]byte(u.Password))
 			if err != nil {
-				log.WithError(err).Error("unable to make salt")
+				log.WithError(err).Error("unable to hash password")
 				return errInternalError
 			}
-			u.PasswdHash = auth.HashPasswd([]byte(u.Password), u.Salt)
+			u.Salt = nil
 		}
 		return nil
 	})
@@ -158,6 +300,11 @@ func profilePatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	u.Password = "" // never ouput it
+	if emailChanged {
+		if err = sendUserToken(r.Context(), u, model.TokenVerifyEmail, verifyEmailExpiry); err != nil {
+			log.WithError(err).WithField("user", u.ID).Error("unable to send verification email")
+		}
+	}
 	respondOK(w, u)
 }
 
@@ -168,7 +315,10 @@ func profileDelete(w http.ResponseWriter, r *http.Request) {
 		respondInternalError(w)
 		return
 	}
-	if err = model.DeleteUser(r.Context(), uid); err != nil {
+	// Owned projects have to be transferred beforehand, unless explicitly
+	// requested to be deleted along with the account.
+	deleteProjects := r.URL.Query().Get("projects") == "delete"
+	if err = model.DeleteUser(r.Context(), uid, deleteProjects); err != nil {
 		respondErr(w, err)
 		return
 	}
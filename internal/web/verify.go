@@ -0,0 +1,201 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/sewiti/munit-backend/internal/auth"
+	"github.com/sewiti/munit-backend/internal/mail"
+	"github.com/sewiti/munit-backend/internal/model"
+)
+
+const (
+	verifyEmailExpiry = 48 * time.Hour
+	resetPasswdExpiry = time.Hour
+)
+
+// appURL is the frontend URL used in links sent to users.
+var appURL string
+
+var errUnverified = fmt.Errorf("%w: email is not verified", errForbidden)
+
+// verifiedMiddleware rejects users that have not verified their email.
+// Anonymous requests are let through, see optionalAuthMiddleware.
+// Must be used after authMiddleware or optionalAuthMiddleware.
+func verifiedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := getUser(r)
+		if err != nil {
+			next.ServeHTTP(w, r) // anonymous, see optionalAuthMiddleware
+			return
+		}
+		u, err := model.GetUser(r.Context(), uid)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		if !u.Verified {
+			respondErr(w, errUnverified)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sendUserToken issues a new token for the user and mails a link to it.
+func sendUserToken(ctx context.Context, u *model.User, purpose model.TokenPurpose, expiry time.Duration) error {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Truncate(time.Second)
+	err = model.InsertUserToken(ctx, &model.UserToken{
+		Hash:    auth.HashToken(token),
+		Purpose: purpose,
+		Created: now,
+		Expires: now.Add(expiry),
+		User:    u.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := &mail.Message{To: u.Email}
+	switch purpose {
+	case model.TokenVerifyEmail:
+		msg.Subject = "Verify your email"
+		msg.Body = fmt.Sprintf("Hi %s,\n\n"+
+			"Please verify your email by opening the link below:\n\n"+
+			"%s\n\n"+
+			"The link expires in %v.\n",
+			u.DisplayName, tokenLink("/verify-email", token), expiry)
+	case model.TokenResetPasswd:
+		msg.Subject = "Reset your password"
+		msg.Body = fmt.Sprintf("Hi %s,\n\n"+
+			"Someone requested a password reset for your account. "+
+			"If it was you, open the link below to choose a new password:\n\n"+
+			"%s\n\n"+
+			"The link expires in %v. If you did not request it, ignore this email.\n",
+			u.DisplayName, tokenLink("/reset-password", token), expiry)
+	}
+	return mail.Send(ctx, msg)
+}
+
+func tokenLink(path, token string) string {
+	return appURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func verifyEmailPost(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+
+	u, err := model.RedeemUserToken(r.Context(), auth.HashToken(body.Token), model.TokenVerifyEmail, func(u *model.User) error {
+		u.Verified = true
+		u.Modified = time.Now().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondOK(w, u)
+}
+
+func profileVerifyEmailPost(w http.ResponseWriter, r *http.Request) {
+	uid, err := getUser(r)
+	if err != nil {
+		log.WithError(err).Error("unable to get user from context")
+		respondInternalError(w)
+		return
+	}
+	u, err := model.GetUser(r.Context(), uid)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	if u.Verified {
+		respondMsg(w, "email is already verified", http.StatusBadRequest)
+		return
+	}
+
+	if err = sendUserToken(r.Context(), u, model.TokenVerifyEmail, verifyEmailExpiry); err != nil {
+		log.WithError(err).WithField("user", u.ID).Error("unable to send verification email")
+		respondInternalError(w)
+		return
+	}
+	respond(w, nil, http.StatusAccepted)
+}
+
+func passwdResetRequestPost(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if body.Email == "" {
+		respondMsg(w, "email is empty", http.StatusBadRequest)
+		return
+	}
+
+	// Respond the same way whether user exists or not, not to reveal
+	// registered emails.
+	u, err := model.GetUserByEmail(r.Context(), body.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.WithError(err).Error("unable to get user by email")
+		}
+		respond(w, nil, http.StatusAccepted)
+		return
+	}
+	if err = sendUserToken(r.Context(), u, model.TokenResetPasswd, resetPasswdExpiry); err != nil {
+		log.WithError(err).WithField("user", u.ID).Error("unable to send password reset email")
+	}
+	respond(w, nil, http.StatusAccepted)
+}
+
+func passwdResetPost(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		respondErr(w, err)
+		return
+	}
+	if body.Password == "" {
+		respondMsg(w, "password is empty", http.StatusBadRequest)
+		return
+	}
+
+	_, err := model.RedeemUserToken(r.Context(), auth.HashToken(body.Token), model.TokenResetPasswd, func(u *model.User) (err error) {
+		u.Password = body.Password
+		u.PasswdHash, err = auth.HashPasswd([]byte(u.Password))
+		if err != nil {
+			log.WithError(err).Error("unable to hash password")
+			return errInternalError
+		}
+		u.Salt = nil
+		// Receiving the email proves the ownership of it.
+		u.Verified = true
+		u.Modified = time.Now().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respond(w, nil, http.StatusNoContent)
+}
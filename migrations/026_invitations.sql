@@ -0,0 +1,22 @@
+-- Contributors get a role, existing ones stay contributors. Owners are not
+-- listed, see project.owner_id.
+ALTER TABLE contributor
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'contributor';
+
+-- Project invitations. Tokens are mailed to invitees, only their hashes are
+-- stored, see auth.HashToken. A user is invited to a project at most once.
+CREATE TABLE invitation (
+    id         CHAR(8)      NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    email      VARCHAR(255) NOT NULL,
+    role       VARCHAR(16)  NOT NULL,
+    created    DATETIME     NOT NULL,
+    expires    DATETIME     NOT NULL,
+    project_id CHAR(8)      NOT NULL,
+    inviter_id CHAR(8)      NOT NULL,
+    user_id    CHAR(8)      NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY invitation_token_hash (token_hash),
+    UNIQUE KEY invitation_project_user (project_id, user_id),
+    KEY invitation_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,17 @@
+-- Existing accounts are unverified, their users verify emails on request. With
+-- config.Munit.RequireVerified set they are restricted to their profile until
+-- then.
+ALTER TABLE user
+    ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE AFTER email;
+
+-- Single use tokens for email verification and password resets. Only their
+-- hashes are stored, see auth.HashToken.
+CREATE TABLE user_token (
+    hash    CHAR(64)    NOT NULL,
+    purpose VARCHAR(16) NOT NULL,
+    created DATETIME    NOT NULL,
+    expires DATETIME    NOT NULL,
+    user_id CHAR(8)     NOT NULL,
+    PRIMARY KEY (hash),
+    KEY user_token_user (user_id, purpose)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
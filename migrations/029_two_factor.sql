@@ -0,0 +1,17 @@
+-- TOTP second factors, at most one per user. Unconfirmed ones are pending
+-- enrollments. Secrets are base32 encoded.
+CREATE TABLE user_totp (
+    user_id   CHAR(8)     NOT NULL,
+    secret    VARCHAR(64) NOT NULL,
+    confirmed BOOLEAN     NOT NULL DEFAULT FALSE,
+    last_step BIGINT      NOT NULL DEFAULT 0,
+    created   DATETIME    NOT NULL,
+    PRIMARY KEY (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Single use recovery codes, only their hashes are stored, see auth.HashToken.
+CREATE TABLE recovery_code (
+    user_id CHAR(8)  NOT NULL,
+    hash    CHAR(64) NOT NULL,
+    PRIMARY KEY (user_id, hash)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,11 @@
+-- Security relevant events, e.g. login lockouts. IPs fit IPv6 addresses.
+CREATE TABLE audit_log (
+    id      CHAR(8)       NOT NULL,
+    action  VARCHAR(32)   NOT NULL,
+    subject VARCHAR(128)  NOT NULL,
+    ip      VARCHAR(45)   NOT NULL,
+    detail  VARCHAR(1024) NOT NULL,
+    created DATETIME      NOT NULL,
+    PRIMARY KEY (id),
+    KEY audit_log_created (created)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
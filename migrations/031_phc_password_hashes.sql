@@ -0,0 +1,14 @@
+-- Password hashes are stored in PHC string format, e.g.
+--   $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+-- which is longer than the raw 32 byte hashes stored before, and grows with
+-- Argon2 parameters. Raw legacy hashes keep working, binary columns preserve
+-- them as they are.
+--
+-- Salt is only kept for legacy hashes. It is cleared, set to NULL, once a
+-- legacy hash is upgraded on login, or a password is changed or reset.
+--
+-- Apply before deploying: otherwise the first login upgrading a legacy hash
+-- fails to store it.
+ALTER TABLE user
+    MODIFY passwd_hash VARBINARY(255) NOT NULL,
+    MODIFY passwd_salt VARBINARY(64) NULL;
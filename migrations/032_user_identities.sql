@@ -0,0 +1,10 @@
+-- External OpenID Connect identities linked to users. An identity is linked to
+-- a single user.
+CREATE TABLE user_identity (
+    issuer  VARCHAR(256) NOT NULL,
+    subject VARCHAR(256) NOT NULL,
+    created DATETIME     NOT NULL,
+    user_id CHAR(8)      NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    KEY user_identity_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
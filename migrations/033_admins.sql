@@ -0,0 +1,5 @@
+-- Instance administrators and disabled accounts. Grant admin to the first
+-- administrator with munit create-admin <email>.
+ALTER TABLE user
+    ADD COLUMN admin    BOOLEAN NOT NULL DEFAULT FALSE AFTER verified,
+    ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE AFTER admin;
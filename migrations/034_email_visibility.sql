@@ -0,0 +1,3 @@
+-- Emails are hidden from other users, unless their owners choose otherwise.
+ALTER TABLE user
+    ADD COLUMN email_visible BOOLEAN NOT NULL DEFAULT FALSE AFTER disabled;
@@ -0,0 +1,4 @@
+-- Users are found by display name only by those sharing a project with them,
+-- unless they choose to be discoverable by anyone.
+ALTER TABLE user
+    ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT FALSE AFTER email_visible;
@@ -0,0 +1,18 @@
+-- Profiles: bio, tags and links, the latter two as JSON lists. Avatar is the
+-- key of user's avatar thumbnails, empty if none.
+ALTER TABLE user
+    ADD COLUMN bio    VARCHAR(1000) NOT NULL DEFAULT '' AFTER discoverable,
+    ADD COLUMN tags   JSON          NULL AFTER bio,
+    ADD COLUMN links  JSON          NULL AFTER tags,
+    ADD COLUMN avatar VARCHAR(64)   NOT NULL DEFAULT '' AFTER links;
+
+-- Avatar thumbnails, JPEG encoded, one per size. Keys are URL safe random
+-- tokens and case-sensitive.
+CREATE TABLE avatar (
+    user_id    CHAR(8)     NOT NULL,
+    avatar_key VARCHAR(64) NOT NULL,
+    size       INT         NOT NULL,
+    data       MEDIUMBLOB  NOT NULL,
+    PRIMARY KEY (avatar_key, size),
+    KEY avatar_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
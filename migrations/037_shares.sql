@@ -0,0 +1,20 @@
+-- Share links. Tokens are bearer tokens, so only their hashes are stored, as
+-- with user tokens: hex encoded SHA-256 of the token, see auth.HashToken.
+-- Commit and file IDs are empty when a whole project or commit is shared.
+CREATE TABLE share (
+    id            CHAR(8)      NOT NULL,
+    token_hash    CHAR(64)     NOT NULL,
+    passwd_hash   VARCHAR(255) NOT NULL DEFAULT '',
+    expires       DATETIME     NULL,
+    max_downloads INT          NOT NULL DEFAULT 0,
+    views         INT          NOT NULL DEFAULT 0,
+    downloads     INT          NOT NULL DEFAULT 0,
+    created       DATETIME     NOT NULL,
+    project_id    CHAR(8)      NOT NULL,
+    commit_id     CHAR(8)      NOT NULL DEFAULT '',
+    file_id       CHAR(8)      NOT NULL DEFAULT '',
+    creator_id    CHAR(8)      NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY share_token_hash (token_hash),
+    KEY share_project (project_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,4 @@
+-- Existing projects stay private: private, unlisted or public.
+ALTER TABLE project
+    ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'private' AFTER description,
+    ADD KEY project_visibility (visibility, modified);
@@ -0,0 +1,19 @@
+-- File contents are stored once per content in `blob`, keyed by hex encoded
+-- SHA-256 of the data, see blobHash. Existing contents are moved there, files
+-- with the same data end up sharing a blob. Quoted, as BLOB is reserved.
+CREATE TABLE `blob` (
+    hash CHAR(64) NOT NULL,
+    data LONGBLOB NOT NULL,
+    PRIMARY KEY (hash)
+);
+ALTER TABLE file ADD COLUMN blob_hash CHAR(64) NULL AFTER path;
+UPDATE file SET blob_hash = SHA2(data, 256);
+INSERT IGNORE INTO `blob` (hash, data) SELECT blob_hash, data FROM file;
+ALTER TABLE file
+    MODIFY blob_hash CHAR(64) NOT NULL,
+    ADD KEY file_blob_hash (blob_hash),
+    DROP COLUMN data;
+
+-- Forks refer to the project they were forked from, empty if none or deleted.
+ALTER TABLE project
+    ADD COLUMN upstream_id CHAR(8) NOT NULL DEFAULT '' AFTER owner_id;
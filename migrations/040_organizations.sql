@@ -0,0 +1,68 @@
+-- Organizations owning projects on behalf of their members. Members are admins
+-- or members, admins have owner's rights on all of organization's projects.
+CREATE TABLE organization (
+    id          CHAR(8)       NOT NULL,
+    name        VARCHAR(72)   NOT NULL,
+    description VARCHAR(1024) NOT NULL DEFAULT '',
+    created     DATETIME      NOT NULL,
+    modified    DATETIME      NOT NULL,
+    PRIMARY KEY (id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE org_member (
+    org_id  CHAR(8)     NOT NULL,
+    user_id CHAR(8)     NOT NULL,
+    role    VARCHAR(16) NOT NULL,
+    PRIMARY KEY (org_id, user_id),
+    KEY org_member_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Teams of organization's members, given a role in some of its projects.
+CREATE TABLE team (
+    id       CHAR(8)     NOT NULL,
+    name     VARCHAR(72) NOT NULL,
+    created  DATETIME    NOT NULL,
+    modified DATETIME    NOT NULL,
+    org_id   CHAR(8)     NOT NULL,
+    PRIMARY KEY (id),
+    KEY team_org (org_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE team_member (
+    team_id CHAR(8) NOT NULL,
+    user_id CHAR(8) NOT NULL,
+    PRIMARY KEY (team_id, user_id),
+    KEY team_member_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE team_project (
+    team_id    CHAR(8)     NOT NULL,
+    project_id CHAR(8)     NOT NULL,
+    role       VARCHAR(16) NOT NULL,
+    PRIMARY KEY (team_id, project_id),
+    KEY team_project_project (project_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Organization invitations, as project invitations: only token hashes are
+-- stored, see auth.HashToken.
+CREATE TABLE org_invitation (
+    id         CHAR(8)      NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    email      VARCHAR(255) NOT NULL,
+    role       VARCHAR(16)  NOT NULL,
+    created    DATETIME     NOT NULL,
+    expires    DATETIME     NOT NULL,
+    org_id     CHAR(8)      NOT NULL,
+    inviter_id CHAR(8)      NOT NULL,
+    user_id    CHAR(8)      NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY org_invitation_token_hash (token_hash),
+    UNIQUE KEY org_invitation_org_user (org_id, user_id),
+    KEY org_invitation_user (user_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Projects are owned either by a user or by an organization, the other owner
+-- column is empty.
+ALTER TABLE project
+    ADD COLUMN org_id CHAR(8) NOT NULL DEFAULT '' AFTER owner_id,
+    ADD KEY project_org (org_id);
@@ -0,0 +1,9 @@
+-- Technical metadata of audio files, all NULL if a file is not audio. It is
+-- read from data on upload and update, existing files get it once updated.
+ALTER TABLE file
+    ADD COLUMN audio_format VARCHAR(8)  NULL,
+    ADD COLUMN audio_codec  VARCHAR(16) NULL,
+    ADD COLUMN sample_rate  INT         NULL,
+    ADD COLUMN bit_depth    INT         NULL,
+    ADD COLUMN channels     INT         NULL,
+    ADD COLUMN duration_ms  BIGINT      NULL;
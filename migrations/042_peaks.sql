@@ -0,0 +1,10 @@
+-- Waveform peaks of audio blobs, generated in background and shared by all
+-- files with the same contents. Failures are stored as well, with NULL data,
+-- so that they are not retried.
+CREATE TABLE peaks (
+    blob_hash CHAR(64)      NOT NULL,
+    data      MEDIUMBLOB    NULL,
+    error     TEXT          NULL,
+    created   DATETIME      NOT NULL,
+    PRIMARY KEY (blob_hash)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
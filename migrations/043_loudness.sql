@@ -0,0 +1,12 @@
+-- Loudness of audio blobs, measured in background along with peaks and shared
+-- by all files with the same contents.
+CREATE TABLE loudness (
+    blob_hash     CHAR(64) NOT NULL,
+    integrated    DOUBLE   NOT NULL,
+    true_peak     DOUBLE   NOT NULL,
+    sample_peak   DOUBLE   NOT NULL,
+    rms           DOUBLE   NOT NULL,
+    dynamic_range DOUBLE   NOT NULL,
+    created       DATETIME NOT NULL,
+    PRIMARY KEY (blob_hash)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
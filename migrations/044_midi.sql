@@ -0,0 +1,4 @@
+-- Summaries of MIDI files as JSON, NULL if a file is not MIDI. They are read
+-- from data on upload and update, existing files get them once updated.
+ALTER TABLE file
+    ADD COLUMN midi JSON NULL;
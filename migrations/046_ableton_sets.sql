@@ -0,0 +1,5 @@
+-- Parsed Ableton Live sets as JSON, NULL if a file is not a set or until it is
+-- parsed in background. Sets are parsed on upload and update, existing ones
+-- once updated.
+ALTER TABLE file
+    ADD COLUMN ableton JSON NULL;
@@ -0,0 +1,17 @@
+-- Musical metadata of projects, empty or 0 if unknown.
+ALTER TABLE project
+    ADD COLUMN bpm            DOUBLE      NOT NULL DEFAULT 0,
+    ADD COLUMN music_key      VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN time_signature VARCHAR(8)  NOT NULL DEFAULT '',
+    ADD COLUMN genre          VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN isrc           VARCHAR(12) NOT NULL DEFAULT '',
+    ADD COLUMN working_title  VARCHAR(72) NOT NULL DEFAULT '';
+
+-- Commits override project's metadata, NULL values are inherited.
+ALTER TABLE commit
+    ADD COLUMN bpm            DOUBLE      NULL,
+    ADD COLUMN music_key      VARCHAR(16) NULL,
+    ADD COLUMN time_signature VARCHAR(8)  NULL,
+    ADD COLUMN genre          VARCHAR(64) NULL,
+    ADD COLUMN isrc           VARCHAR(12) NULL,
+    ADD COLUMN working_title  VARCHAR(72) NULL;
@@ -0,0 +1,24 @@
+-- Time-stamped comments on files and their replies. Replies refer to their
+-- thread with parent_id, which is empty for threads. Path is file's path, by
+-- which comments are carried forward to later commits.
+CREATE TABLE comment (
+    id          CHAR(8)      NOT NULL,
+    body        TEXT         NOT NULL,
+    start_time  DOUBLE       NOT NULL DEFAULT 0,
+    end_time    DOUBLE       NULL,
+    parent_id   CHAR(8)      NOT NULL DEFAULT '',
+    resolved    BOOLEAN      NOT NULL DEFAULT FALSE,
+    resolved_by CHAR(8)      NOT NULL DEFAULT '',
+    resolved_at DATETIME     NULL,
+    created     DATETIME     NOT NULL,
+    modified    DATETIME     NOT NULL,
+    project_id  CHAR(8)      NOT NULL,
+    commit_id   CHAR(8)      NOT NULL,
+    file_id     CHAR(8)      NOT NULL,
+    path        VARCHAR(256) NOT NULL,
+    author_id   CHAR(8)      NOT NULL,
+    PRIMARY KEY (id),
+    KEY comment_file (project_id, commit_id, file_id),
+    KEY comment_path (project_id, path),
+    KEY comment_parent (parent_id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
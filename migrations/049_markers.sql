@@ -0,0 +1,4 @@
+-- Markers of WAV files as JSON, NULL if a file is not WAV. They are read from
+-- cue points on upload and update, existing files get them once updated.
+ALTER TABLE file
+    ADD COLUMN markers JSON NULL;
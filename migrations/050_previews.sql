@@ -0,0 +1,14 @@
+-- Previews of audio blobs, generated in background and shared by all files
+-- with the same contents. A blob has a preview per format and max sample rate,
+-- so that changing preview settings generates new ones. Failures are stored as
+-- well, with NULL data, so that they are not retried.
+CREATE TABLE preview (
+    blob_hash    CHAR(64)    NOT NULL,
+    format       VARCHAR(8)  NOT NULL,
+    sample_rate  INT         NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    data         LONGBLOB    NULL,
+    error        TEXT        NULL,
+    created      DATETIME    NOT NULL,
+    PRIMARY KEY (blob_hash, format, sample_rate)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
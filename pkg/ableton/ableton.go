@@ -0,0 +1,161 @@
+// Package ableton reads Ableton Live sets (.als), which are gzip compressed
+// XML documents.
+package ableton
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Limits of a set, so that crafted sets cannot exhaust memory. Parse fails
+// once one is exceeded.
+const (
+	maxSize    = 32 << 20 // Decompressed size
+	maxDepth   = 256      // Nesting of elements
+	maxTracks  = 1024
+	maxDevices = 4096 // Of all tracks, including nested ones
+	maxSamples = 4096
+)
+
+// Track types.
+const (
+	TrackAudio  = "audio"
+	TrackMIDI   = "midi"
+	TrackGroup  = "group"
+	TrackReturn = "return"
+	TrackMain   = "main"
+)
+
+var trackTypes = map[string]string{
+	"AudioTrack":  TrackAudio,
+	"MidiTrack":   TrackMIDI,
+	"GroupTrack":  TrackGroup,
+	"ReturnTrack": TrackReturn,
+	"MasterTrack": TrackMain, // MainTrack since Live 12
+	"MainTrack":   TrackMain,
+}
+
+// Plugin formats.
+var pluginFormats = map[string]string{
+	"VstPluginInfo":  "vst",
+	"Vst3PluginInfo": "vst3",
+	"AuPluginInfo":   "au",
+}
+
+// ErrNotSet is returned by Parse if data is not an Ableton Live set.
+var ErrNotSet = errors.New("ableton: not an ableton live set")
+
+// Set is a parsed Ableton Live set.
+type Set struct {
+	Creator       string        `json:"creator"` // e.g. "Ableton Live 11.3.4"
+	Tempo         float64       `json:"tempo"`   // BPM
+	TimeSignature TimeSignature `json:"timeSignature"`
+	Tracks        []Track       `json:"tracks"`  // Main track last
+	Samples       []Sample      `json:"samples"` // Distinct, in order of first reference
+}
+
+type TimeSignature struct {
+	Numerator   int `json:"numerator"`
+	Denominator int `json:"denominator"`
+}
+
+type Track struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"` // audio, midi, group, return or main
+	Devices []Device `json:"devices"`
+}
+
+type Device struct {
+	Kind    string   `json:"kind"`             // Device's class, e.g. "Reverb" or "PluginDevice"
+	Name    string   `json:"name"`             // Given name, plugin's name or kind
+	Plugin  string   `json:"plugin,omitempty"` // Plugin format: vst, vst3 or au
+	Devices []Device `json:"devices"`          // Devices of all rack's chains
+}
+
+// Sample is an audio file referenced by the set.
+type Sample struct {
+	Path         string   `json:"path"`                   // Relative to set's folder, empty if unknown
+	AbsolutePath string   `json:"absolutePath,omitempty"` // Where it was when set was saved, if known
+	Tracks       []string `json:"tracks"`                 // Names of tracks referencing it
+	Missing      bool     `json:"missing"`                // Set by FlagMissing
+}
+
+// IsSet reports whether data looks like an Ableton Live set: it must be gzip
+// compressed. Contents are not checked.
+func IsSet(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// Parse parses gzip compressed Ableton Live set.
+func Parse(data []byte) (*Set, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotSet
+	}
+	defer zr.Close()
+	return parseXML(&limitReader{r: zr, n: maxSize})
+}
+
+// FlagMissing flags samples, which are not found in a file tree. Sample paths
+// are resolved relative to dir, the set's folder. Samples with only absolute
+// path known are always missing.
+func (s *Set) FlagMissing(dir string, exists func(path string) bool) {
+	for i := range s.Samples {
+		sm := &s.Samples[i]
+		sm.Missing = sm.Path == "" || !exists(path.Join(dir, sm.Path))
+	}
+}
+
+// limitReader is io.LimitReader, which fails instead of returning EOF once
+// the limit is reached.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, fmt.Errorf("set exceeds %d MiB", maxSize>>20) // wrapped by parseXML
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// fileRef is a sample reference being read.
+type fileRef struct {
+	relative    string   // Live 11+
+	elements    []string // Live 10 and older
+	name        string   // Live 10 and older
+	absolute    string   // Live 11+
+	hasRelative bool
+}
+
+func (f *fileRef) sample() Sample {
+	var sm Sample
+	if f.relative != "" {
+		sm.Path = f.relative
+	} else if f.hasRelative && f.name != "" {
+		sm.Path = path.Join(append(f.elements, f.name)...)
+	}
+	sm.Path = strings.ReplaceAll(sm.Path, "\\", "/")
+	if sm.Path != "" {
+		sm.Path = path.Clean(sm.Path)
+	}
+	sm.AbsolutePath = f.absolute
+	return sm
+}
+
+func parseInt(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
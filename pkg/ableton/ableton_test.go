@@ -0,0 +1,237 @@
+package ableton
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gz(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// Abridged Live 11 set.
+const set11 = `<?xml version="1.0" encoding="UTF-8"?>
+<Ableton MajorVersion="5" MinorVersion="11.0_11300" Creator="Ableton Live 11.3.4">
+	<LiveSet>
+		<Tracks>
+			<AudioTrack Id="8">
+				<Name><EffectiveName Value="Drums"/><UserName Value="Drums"/></Name>
+				<DeviceChain>
+					<MainSequencer>
+						<ClipSlotList><ClipSlot><ClipSlot><Value><AudioClip>
+							<SampleRef>
+								<FileRef>
+									<RelativePathType Value="3"/>
+									<RelativePath Value="Samples/Imported/kick.wav"/>
+									<Path Value="/Users/me/Song Project/Samples/Imported/kick.wav"/>
+								</FileRef>
+							</SampleRef>
+							<TimeSignature><TimeSignatures><RemoteableTimeSignature>
+								<Numerator Value="7"/><Denominator Value="8"/>
+							</RemoteableTimeSignature></TimeSignatures></TimeSignature>
+						</AudioClip></Value></ClipSlot></ClipSlot></ClipSlotList>
+					</MainSequencer>
+					<DeviceChain>
+						<Devices>
+							<Eq8 Id="0"><UserName Value=""/></Eq8>
+							<AudioEffectGroupDevice Id="1">
+								<UserName Value="Crush Rack"/>
+								<Branches><AudioEffectBranch><DeviceChain><AudioToAudioDeviceChain>
+									<Devices>
+										<Redux2 Id="0"><UserName Value=""/></Redux2>
+										<PluginDevice Id="1">
+											<UserName Value=""/>
+											<PluginDesc><VstPluginInfo><PlugName Value="Decapitator"/></VstPluginInfo></PluginDesc>
+										</PluginDevice>
+									</Devices>
+								</AudioToAudioDeviceChain></DeviceChain></AudioEffectBranch></Branches>
+							</AudioEffectGroupDevice>
+						</Devices>
+					</DeviceChain>
+				</DeviceChain>
+			</AudioTrack>
+			<MidiTrack Id="9">
+				<Name><EffectiveName Value="2-MIDI"/><UserName Value=""/></Name>
+				<DeviceChain><DeviceChain><Devices>
+					<OriginalSimpler Id="0">
+						<UserName Value=""/>
+						<Player><MultiSampleMap><SampleParts><MultiSamplePart><SampleRef>
+							<FileRef>
+								<RelativePath Value="Samples/Imported/kick.wav"/>
+								<Path Value="/Users/me/Song Project/Samples/Imported/kick.wav"/>
+							</FileRef>
+						</SampleRef></MultiSamplePart></SampleParts></MultiSampleMap></Player>
+					</OriginalSimpler>
+					<PluginDevice Id="1">
+						<UserName Value=""/>
+						<PluginDesc><Vst3PluginInfo><Name Value="Serum"/></Vst3PluginInfo></PluginDesc>
+					</PluginDevice>
+				</Devices></DeviceChain></DeviceChain>
+			</MidiTrack>
+			<ReturnTrack Id="2">
+				<Name><EffectiveName Value="A-Reverb"/><UserName Value=""/></Name>
+				<DeviceChain><DeviceChain><Devices>
+					<Reverb Id="0"><UserName Value=""/></Reverb>
+				</Devices></DeviceChain></DeviceChain>
+			</ReturnTrack>
+		</Tracks>
+		<MasterTrack>
+			<Name><EffectiveName Value="Master"/><UserName Value=""/></Name>
+			<DeviceChain>
+				<Mixer>
+					<Tempo><LomId Value="0"/><Manual Value="128.5"/></Tempo>
+					<TimeSignature>
+						<Manual Value="201"/>
+						<TimeSignatures>
+							<RemoteableTimeSignature Id="0"><Numerator Value="6"/><Denominator Value="8"/><Time Value="0"/></RemoteableTimeSignature>
+							<RemoteableTimeSignature Id="1"><Numerator Value="4"/><Denominator Value="4"/><Time Value="16"/></RemoteableTimeSignature>
+						</TimeSignatures>
+					</TimeSignature>
+				</Mixer>
+				<DeviceChain><Devices><Limiter Id="0"><UserName Value=""/></Limiter></Devices></DeviceChain>
+			</DeviceChain>
+		</MasterTrack>
+		<PreHearTrack>
+			<DeviceChain><DeviceChain><Devices><Eq8/></Devices></DeviceChain></DeviceChain>
+		</PreHearTrack>
+	</LiveSet>
+</Ableton>`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(gz(t, set11))
+	require.NoError(t, err)
+	assert.Equal(t, "Ableton Live 11.3.4", s.Creator)
+	assert.Equal(t, 128.5, s.Tempo)
+	assert.Equal(t, TimeSignature{6, 8}, s.TimeSignature)
+
+	require.Len(t, s.Tracks, 4)
+	drums := s.Tracks[0]
+	assert.Equal(t, "Drums", drums.Name)
+	assert.Equal(t, TrackAudio, drums.Type)
+	assert.Equal(t, []Device{
+		{Kind: "Eq8", Name: "Eq8", Devices: []Device{}},
+		{Kind: "AudioEffectGroupDevice", Name: "Crush Rack", Devices: []Device{
+			{Kind: "Redux2", Name: "Redux2", Devices: []Device{}},
+			{Kind: "PluginDevice", Name: "Decapitator", Plugin: "vst", Devices: []Device{}},
+		}},
+	}, drums.Devices)
+
+	midi := s.Tracks[1]
+	assert.Equal(t, "2-MIDI", midi.Name)
+	assert.Equal(t, TrackMIDI, midi.Type)
+	require.Len(t, midi.Devices, 2)
+	assert.Equal(t, "Serum", midi.Devices[1].Name)
+	assert.Equal(t, "vst3", midi.Devices[1].Plugin)
+
+	assert.Equal(t, TrackReturn, s.Tracks[2].Type)
+	assert.Equal(t, Track{Name: "Master", Type: TrackMain, Devices: []Device{
+		{Kind: "Limiter", Name: "Limiter", Devices: []Device{}},
+	}}, s.Tracks[3])
+
+	assert.Equal(t, []Sample{{
+		Path:         "Samples/Imported/kick.wav",
+		AbsolutePath: "/Users/me/Song Project/Samples/Imported/kick.wav",
+		Tracks:       []string{"Drums", "2-MIDI"},
+	}}, s.Samples)
+}
+
+func TestParseLive10(t *testing.T) {
+	const set = `<Ableton Creator="Ableton Live 10.1.30">
+		<LiveSet>
+			<Tracks>
+				<AudioTrack>
+					<Name><EffectiveName Value="Vox"/></Name>
+					<DeviceChain><MainSequencer><Sample><ArrangerAutomation><Events><AudioClip>
+						<SampleRef><FileRef>
+							<HasRelativePath Value="true"/>
+							<RelativePath>
+								<RelativePathElement Dir="Samples"/>
+								<RelativePathElement Dir="Recorded"/>
+							</RelativePath>
+							<Name Value="0001 Vox.wav"/>
+							<SearchHint><PathHint><RelativePathElement Dir="Users"/></PathHint></SearchHint>
+						</FileRef></SampleRef>
+					</AudioClip><AudioClip>
+						<SampleRef><FileRef>
+							<HasRelativePath Value="false"/>
+							<Name Value="external.wav"/>
+						</FileRef></SampleRef>
+					</AudioClip></Events></ArrangerAutomation></Sample></MainSequencer></DeviceChain>
+				</AudioTrack>
+			</Tracks>
+			<MasterTrack><DeviceChain><Mixer>
+				<Tempo><Manual Value="90"/></Tempo>
+				<TimeSignature><Manual Value="200"/></TimeSignature>
+			</Mixer></DeviceChain></MasterTrack>
+		</LiveSet>
+	</Ableton>`
+
+	s, err := Parse(gz(t, set))
+	require.NoError(t, err)
+	assert.Equal(t, 90.0, s.Tempo)
+	assert.Equal(t, TimeSignature{3, 4}, s.TimeSignature)
+	assert.Equal(t, []Sample{{Path: "Samples/Recorded/0001 Vox.wav", Tracks: []string{"Vox"}}}, s.Samples)
+}
+
+func TestFlagMissing(t *testing.T) {
+	s := &Set{Samples: []Sample{
+		{Path: "Samples/a.wav"},
+		{Path: "Samples/b.wav"},
+		{Path: "../Shared/c.wav"},
+		{AbsolutePath: "C:\\d.wav"},
+	}}
+	tree := map[string]bool{"/Song/Samples/a.wav": true, "/Shared/c.wav": true}
+	s.FlagMissing("/Song", func(p string) bool { return tree[p] })
+	assert.False(t, s.Samples[0].Missing)
+	assert.True(t, s.Samples[1].Missing)
+	assert.False(t, s.Samples[2].Missing)
+	assert.True(t, s.Samples[3].Missing)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte("<Ableton/>"))
+	assert.ErrorIs(t, err, ErrNotSet)
+	_, err = Parse(gz(t, "<html></html>"))
+	assert.ErrorIs(t, err, ErrNotSet)
+	_, err = Parse(gz(t, ""))
+	assert.ErrorIs(t, err, ErrNotSet)
+	_, err = Parse(gz(t, "<Ableton><LiveSet>"))
+	assert.Error(t, err)
+}
+
+func TestParseLimits(t *testing.T) {
+	const head = `<Ableton><LiveSet><Tracks>`
+	const tail = `</Tracks></LiveSet></Ableton>`
+
+	_, err := Parse(gz(t, head+strings.Repeat(`<MidiTrack/>`, maxTracks+1)+tail))
+	assert.EqualError(t, err, fmt.Sprintf("ableton: too many tracks, max %d", maxTracks))
+
+	devices := `<AudioTrack><DeviceChain><Devices>` + strings.Repeat(`<Eq8/>`, maxDevices+1) + `</Devices></DeviceChain></AudioTrack>`
+	_, err = Parse(gz(t, head+devices+tail))
+	assert.EqualError(t, err, fmt.Sprintf("ableton: too many devices, max %d", maxDevices))
+
+	var samples strings.Builder
+	for i := 0; i <= maxSamples; i++ {
+		fmt.Fprintf(&samples, `<SampleRef><FileRef><RelativePath Value="Samples/%d.wav"/></FileRef></SampleRef>`, i)
+	}
+	_, err = Parse(gz(t, head+`<AudioTrack>`+samples.String()+`</AudioTrack>`+tail))
+	assert.EqualError(t, err, fmt.Sprintf("ableton: too many samples, max %d", maxSamples))
+
+	nested := strings.Repeat(`<a>`, maxDepth) + strings.Repeat(`</a>`, maxDepth)
+	_, err = Parse(gz(t, `<Ableton>`+nested+`</Ableton>`))
+	assert.EqualError(t, err, fmt.Sprintf("ableton: elements nested too deep, max %d", maxDepth))
+
+	_, err = Parse(gz(t, `<Ableton>`+strings.Repeat(" ", maxSize)+`</Ableton>`))
+	assert.EqualError(t, err, fmt.Sprintf("ableton: set exceeds %d MiB", maxSize>>20))
+}
@@ -0,0 +1,276 @@
+package ableton
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// parser reads set's XML as a stream of tokens, as sets of large projects are
+// hundreds of megabytes.
+type parser struct {
+	set   *Set
+	root  bool     // Whether root element was read
+	stack []string // Names of open elements
+
+	track      *Track // Open track
+	trackDepth int
+	main       *Track
+
+	devices  []deviceFrame // Open devices, innermost last
+	nDevices int           // Devices read so far
+
+	ref      *fileRef // Open sample reference
+	refDepth int
+	samples  map[string]int // Indices of samples by paths
+
+	tsSet    bool
+	tsManual int // Encoded time signature, if not listed
+}
+
+type deviceFrame struct {
+	Device
+	depth      int
+	userName   string
+	pluginName string
+}
+
+func parseXML(r io.Reader) (*Set, error) {
+	p := &parser{
+		set: &Set{
+			Tracks:  make([]Track, 0),
+			Samples: make([]Sample, 0),
+		},
+		samples: make(map[string]int),
+	}
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if len(p.stack) == 0 {
+				return nil, ErrNotSet
+			}
+			return nil, fmt.Errorf("ableton: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if err = p.start(tok); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if err = p.end(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !p.root {
+		return nil, ErrNotSet
+	}
+	if p.main != nil {
+		p.set.Tracks = append(p.set.Tracks, *p.main)
+	}
+	if !p.tsSet && p.tsManual > 0 {
+		// Encoded as numerator-1 + 99*log2(denominator).
+		p.set.TimeSignature = TimeSignature{
+			Numerator:   p.tsManual%99 + 1,
+			Denominator: 1 << (p.tsManual / 99 % 8),
+		}
+	}
+	return p.set, nil
+}
+
+// parent returns name of the element n levels above the innermost open one,
+// 0 being the innermost.
+func (p *parser) parent(n int) string {
+	if n >= len(p.stack) {
+		return ""
+	}
+	return p.stack[len(p.stack)-1-n]
+}
+
+// in reports whether innermost open elements are the given ones, outermost
+// first.
+func (p *parser) in(names ...string) bool {
+	for i, name := range names {
+		if p.parent(len(names)-1-i) != name {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) start(el xml.StartElement) error {
+	name := el.Name.Local
+	value := attr(el, "Value")
+
+	if len(p.stack) == 0 {
+		if name != "Ableton" {
+			return ErrNotSet
+		}
+		p.set.Creator = attr(el, "Creator")
+		p.root = true
+	}
+	if len(p.stack) >= maxDepth {
+		return fmt.Errorf("ableton: elements nested too deep, max %d", maxDepth)
+	}
+
+	switch {
+	case p.track == nil && trackTypes[name] != "" && (p.in("LiveSet", "Tracks") || p.in("LiveSet")):
+		if len(p.set.Tracks) >= maxTracks {
+			return fmt.Errorf("ableton: too many tracks, max %d", maxTracks)
+		}
+		p.track = &Track{Type: trackTypes[name], Devices: make([]Device, 0)}
+		p.trackDepth = len(p.stack) + 1
+
+	case p.track == nil:
+
+	case p.parent(0) == "Devices":
+		if p.nDevices >= maxDevices {
+			return fmt.Errorf("ableton: too many devices, max %d", maxDevices)
+		}
+		p.nDevices++
+		p.devices = append(p.devices, deviceFrame{
+			Device: Device{Kind: name, Devices: make([]Device, 0)},
+			depth:  len(p.stack) + 1,
+		})
+
+	case name == "FileRef" && p.parent(0) == "SampleRef":
+		p.ref = &fileRef{}
+		p.refDepth = len(p.stack) + 1
+
+	case p.ref != nil && len(p.stack) == p.refDepth:
+		switch name {
+		case "RelativePath":
+			p.ref.relative = value
+		case "HasRelativePath":
+			p.ref.hasRelative = value == "true"
+		case "Name":
+			p.ref.name = value
+		case "Path":
+			p.ref.absolute = value
+		}
+
+	case p.ref != nil && len(p.stack) == p.refDepth+1 && name == "RelativePathElement" && p.parent(0) == "RelativePath":
+		p.ref.elements = append(p.ref.elements, attr(el, "Dir"))
+
+	case len(p.stack) == p.trackDepth+1 && p.parent(0) == "Name":
+		switch name {
+		case "EffectiveName":
+			p.track.Name = value
+		case "UserName":
+			if p.track.Name == "" {
+				p.track.Name = value
+			}
+		}
+
+	case len(p.devices) > 0 && name == "UserName" && len(p.stack) == p.devices[len(p.devices)-1].depth:
+		p.devices[len(p.devices)-1].userName = value
+
+	case len(p.devices) > 0 && pluginFormats[p.parent(0)] != "" && (name == "PlugName" || name == "Name"):
+		dev := &p.devices[len(p.devices)-1]
+		if dev.pluginName == "" {
+			dev.pluginName = value
+			dev.Plugin = pluginFormats[p.parent(0)]
+		}
+
+	case p.track.Type == TrackMain && p.in("Mixer", "Tempo") && name == "Manual":
+		p.set.Tempo, _ = strconv.ParseFloat(value, 64)
+
+	case p.track.Type == TrackMain && p.in("Mixer", "TimeSignature") && name == "Manual":
+		p.tsManual = parseInt(value)
+
+	case p.track.Type == TrackMain && !p.tsSet && p.in("Mixer", "TimeSignature", "TimeSignatures", "RemoteableTimeSignature"):
+		switch name {
+		case "Numerator":
+			p.set.TimeSignature.Numerator = parseInt(value)
+		case "Denominator":
+			p.set.TimeSignature.Denominator = parseInt(value)
+		}
+	}
+
+	p.stack = append(p.stack, name)
+	return nil
+}
+
+func (p *parser) end() error {
+	depth := len(p.stack)
+	p.stack = p.stack[:depth-1]
+
+	switch {
+	case p.ref != nil && depth == p.refDepth:
+		if err := p.addSample(p.ref.sample()); err != nil {
+			return err
+		}
+		p.ref = nil
+
+	case len(p.devices) > 0 && depth == p.devices[len(p.devices)-1].depth:
+		f := p.devices[len(p.devices)-1]
+		p.devices = p.devices[:len(p.devices)-1]
+		dev := f.Device
+		switch {
+		case f.userName != "":
+			dev.Name = f.userName
+		case f.pluginName != "":
+			dev.Name = f.pluginName
+		default:
+			dev.Name = dev.Kind
+		}
+		if len(p.devices) > 0 {
+			parent := &p.devices[len(p.devices)-1]
+			parent.Devices = append(parent.Devices, dev)
+		} else {
+			p.track.Devices = append(p.track.Devices, dev)
+		}
+
+	case p.track != nil && depth == p.trackDepth:
+		if p.track.Type == TrackMain {
+			p.main = p.track
+		} else {
+			p.set.Tracks = append(p.set.Tracks, *p.track)
+		}
+		p.track = nil
+
+	case p.track != nil && p.track.Type == TrackMain && !p.tsSet && p.parent(0) == "TimeSignatures" && p.set.TimeSignature.Denominator > 0:
+		p.tsSet = true // closed the first RemoteableTimeSignature
+	}
+	return nil
+}
+
+func (p *parser) addSample(sm Sample) error {
+	if sm.Path == "" && sm.AbsolutePath == "" {
+		return nil
+	}
+	key := sm.Path + "\x00" + sm.AbsolutePath
+	i, ok := p.samples[key]
+	if !ok {
+		if len(p.set.Samples) >= maxSamples {
+			return fmt.Errorf("ableton: too many samples, max %d", maxSamples)
+		}
+		i = len(p.set.Samples)
+		p.samples[key] = i
+		sm.Tracks = make([]string, 0, 1)
+		p.set.Samples = append(p.set.Samples, sm)
+	}
+	tracks := &p.set.Samples[i].Tracks
+	for _, t := range *tracks {
+		if t == p.track.Name {
+			return nil
+		}
+	}
+	*tracks = append(*tracks, p.track.Name)
+	return nil
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+func aifcCodec(compression string) string {
+	switch compression {
+	case "NONE", "twos", "sowt":
+		return CodecPCM
+	case "fl32", "FL32", "fl64", "FL64":
+		return CodecFloat
+	case "alaw", "ALAW":
+		return CodecALaw
+	case "ulaw", "ULAW":
+		return CodecMuLaw
+	}
+	return strings.ToLower(strings.TrimSpace(compression))
+}
+
+// parseAIFF reads metadata and, if samples are PCM or float, their layout.
+func parseAIFF(data []byte) (*Info, *pcm, error) {
+	var (
+		aifc        = string(data[8:12]) == "AIFC"
+		info        *Info
+		compression string
+		samples     []byte
+	)
+
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := int(binary.BigEndian.Uint32(data[off+4:]))
+		body := data[off+8:]
+		if size >= 0 && size < len(body) {
+			body = body[:size]
+		}
+
+		switch id {
+		case "COMM":
+			var err error
+			info, compression, err = parseAIFFCommon(body, aifc)
+			if err != nil {
+				return nil, nil, err
+			}
+		case "SSND":
+			if len(body) >= 8 {
+				offset := int(binary.BigEndian.Uint32(body))
+				if offset >= 0 && 8+offset <= len(body) {
+					samples = body[8+offset:]
+				}
+			}
+		}
+
+		off += 8 + size + size&1
+		if off < 0 {
+			break
+		}
+	}
+
+	if info == nil {
+		return nil, nil, errors.New("audio: aiff: missing COMM chunk")
+	}
+	if info.Codec != CodecPCM && info.Codec != CodecFloat || samples == nil {
+		return info, nil, nil
+	}
+	p := &pcm{
+		data:  samples,
+		size:  (info.BitDepth + 7) / 8,
+		float: info.Codec == CodecFloat,
+		order: binary.BigEndian,
+	}
+	if compression == "sowt" {
+		p.order = binary.LittleEndian
+	}
+	if p.float && compression[2:] == "64" {
+		p.size = 8
+	}
+	return info, p, nil
+}
+
+// parseAIFFCommon parses COMM chunk, returning compression type as well, which
+// is "NONE" for AIFF.
+func parseAIFFCommon(body []byte, aifc bool) (*Info, string, error) {
+	if len(body) < 18 || aifc && len(body) < 22 {
+		return nil, "", errors.New("audio: aiff: COMM chunk is too short")
+	}
+
+	info := Info{
+		Format:     "aiff",
+		Codec:      CodecPCM,
+		Channels:   int(binary.BigEndian.Uint16(body)),
+		BitDepth:   int(binary.BigEndian.Uint16(body[6:])),
+		SampleRate: int(math.Round(extended(body[8:18]))),
+	}
+	if err := checkLayout("aiff", info.Channels, info.SampleRate); err != nil {
+		return nil, "", err
+	}
+	compression := "NONE"
+	if aifc {
+		compression = string(body[18:22])
+		info.Codec = aifcCodec(compression)
+	}
+	frames := uint64(binary.BigEndian.Uint32(body[2:]))
+	info.Duration = duration(frames, info.SampleRate)
+	return &info, compression, nil
+}
+
+// extended converts 80-bit IEEE 754 extended precision float, which AIFF uses
+// for sample rate.
+func extended(b []byte) float64 {
+	exp := int(binary.BigEndian.Uint16(b) & 0x7fff)
+	mant := binary.BigEndian.Uint64(b[2:])
+	if exp == 0 && mant == 0 {
+		return 0
+	}
+	v := math.Ldexp(float64(mant), exp-16383-63)
+	if b[0]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
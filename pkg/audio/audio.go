@@ -0,0 +1,112 @@
+// Package audio reads technical metadata from audio file headers, without
+// decoding any audio. WAV, AIFF, FLAC and MP3 (MPEG layer III) are supported.
+// Cue points of WAV files can be read and written as markers.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("audio: unknown format")
+
+// Limits of channel count and sample rate accepted from headers, well above
+// any real audio, so that bogus headers cannot make decoding allocate
+// excessively.
+const (
+	MaxChannels   = 32
+	MaxSampleRate = 768000
+)
+
+// Codecs reported in Info.
+const (
+	CodecPCM   = "pcm"
+	CodecFloat = "float"
+	CodecALaw  = "alaw"
+	CodecMuLaw = "mulaw"
+	CodecFLAC  = "flac"
+	CodecMP3   = "mp3"
+)
+
+// Info is audio stream's technical metadata.
+type Info struct {
+	Format     string // Container: wav, aiff, flac or mp3
+	Codec      string
+	SampleRate int
+	BitDepth   int // 0 for lossy codecs
+	Channels   int
+	Duration   time.Duration
+}
+
+// Parse detects the format of data and reads its metadata.
+// ErrUnknownFormat is returned if data is not in any of supported formats.
+func Parse(data []byte) (*Info, error) {
+	switch {
+	case isWAV(data):
+		info, _, err := parseWAV(data)
+		return info, err
+	case isAIFF(data):
+		info, _, err := parseAIFF(data)
+		return info, err
+	}
+
+	// FLAC and MP3 may be preceded by an ID3v2 tag.
+	off := skipID3v2(data)
+	if len(data) >= off+4 && bytes.Equal(data[off:off+4], []byte("fLaC")) {
+		return parseFLAC(data[off:])
+	}
+	return parseMP3(data, off)
+}
+
+// checkLayout rejects channel counts and sample rates out of limits.
+func checkLayout(format string, channels, rate int) error {
+	if channels < 1 || channels > MaxChannels {
+		return fmt.Errorf("audio: %s: invalid channel count: %d", format, channels)
+	}
+	if rate < 1 || rate > MaxSampleRate {
+		return fmt.Errorf("audio: %s: invalid sample rate: %d", format, rate)
+	}
+	return nil
+}
+
+func isWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+func isAIFF(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[:4], []byte("FORM")) &&
+		(bytes.Equal(data[8:12], []byte("AIFF")) || bytes.Equal(data[8:12], []byte("AIFC")))
+}
+
+// skipID3v2 returns the offset past the ID3v2 tag at the start of data, or 0
+// if there's none.
+func skipID3v2(data []byte) int {
+	if len(data) < 10 || !bytes.Equal(data[:3], []byte("ID3")) {
+		return 0
+	}
+	// Size is syncsafe: 7 bits per byte.
+	size := 0
+	for _, b := range data[6:10] {
+		if b&0x80 != 0 {
+			return 0
+		}
+		size = size<<7 | int(b)
+	}
+	size += 10
+	if data[5]&0x10 != 0 { // footer present
+		size += 10
+	}
+	if size > len(data) {
+		return len(data)
+	}
+	return size
+}
+
+func duration(frames uint64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(frames) / float64(sampleRate) * float64(time.Second))
+}
@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunk(order binary.ByteOrder, id string, body []byte) []byte {
+	b := make([]byte, 8, 8+len(body)+1)
+	copy(b, id)
+	order.PutUint32(b[4:], uint32(len(body)))
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func makeWAV(tag, channels uint16, rate uint32, bits uint16, dataLen int) []byte {
+	fmtBody := make([]byte, 16)
+	blockAlign := channels * bits / 8
+	binary.LittleEndian.PutUint16(fmtBody, tag)
+	binary.LittleEndian.PutUint16(fmtBody[2:], channels)
+	binary.LittleEndian.PutUint32(fmtBody[4:], rate)
+	binary.LittleEndian.PutUint32(fmtBody[8:], rate*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(fmtBody[12:], blockAlign)
+	binary.LittleEndian.PutUint16(fmtBody[14:], bits)
+
+	body := []byte("WAVE")
+	body = append(body, chunk(binary.LittleEndian, "fmt ", fmtBody)...)
+	body = append(body, chunk(binary.LittleEndian, "data", make([]byte, dataLen))...)
+	return chunk(binary.LittleEndian, "RIFF", body)
+}
+
+func TestParseWAV(t *testing.T) {
+	// 2 seconds of 24-bit stereo at 48 kHz.
+	info, err := Parse(makeWAV(wavePCM, 2, 48000, 24, 2*48000*6))
+	require.NoError(t, err)
+	assert.Equal(t, &Info{
+		Format:     "wav",
+		Codec:      CodecPCM,
+		SampleRate: 48000,
+		BitDepth:   24,
+		Channels:   2,
+		Duration:   2 * time.Second,
+	}, info)
+
+	info, err = Parse(makeWAV(waveFloat, 1, 44100, 32, 44100*4/2))
+	require.NoError(t, err)
+	assert.Equal(t, CodecFloat, info.Codec)
+	assert.Equal(t, 500*time.Millisecond, info.Duration)
+}
+
+func TestParseWAVTruncated(t *testing.T) {
+	data := makeWAV(wavePCM, 2, 48000, 16, 48000*4)
+	info, err := Parse(data[:len(data)-48000*2]) // half of the samples
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, info.Duration)
+
+	_, err = Parse(data[:20]) // no complete fmt chunk
+	assert.Error(t, err)
+}
+
+func TestParseAIFF(t *testing.T) {
+	comm := make([]byte, 18)
+	binary.BigEndian.PutUint16(comm, 2)            // channels
+	binary.BigEndian.PutUint32(comm[2:], 441000)   // sample frames
+	binary.BigEndian.PutUint16(comm[6:], 16)       // sample size
+	copy(comm[8:], []byte{0x40, 0x0e, 0xac, 0x44}) // 44100 as 80-bit extended
+
+	body := []byte("AIFF")
+	body = append(body, chunk(binary.BigEndian, "COMM", comm)...)
+	body = append(body, chunk(binary.BigEndian, "SSND", make([]byte, 8))...)
+
+	info, err := Parse(chunk(binary.BigEndian, "FORM", body))
+	require.NoError(t, err)
+	assert.Equal(t, &Info{
+		Format:     "aiff",
+		Codec:      CodecPCM,
+		SampleRate: 44100,
+		BitDepth:   16,
+		Channels:   2,
+		Duration:   10 * time.Second,
+	}, info)
+
+	body = []byte("AIFC")
+	body = append(body, chunk(binary.BigEndian, "COMM", append(comm, []byte("fl32")...))...)
+	info, err = Parse(chunk(binary.BigEndian, "FORM", body))
+	require.NoError(t, err)
+	assert.Equal(t, CodecFloat, info.Codec)
+}
+
+func TestParseLimits(t *testing.T) {
+	for _, data := range [][]byte{
+		makeWAV(wavePCM, 65535, 48000, 16, 64),
+		makeWAV(wavePCM, 0, 48000, 16, 64),
+		makeWAV(wavePCM, 2, 0, 16, 64),
+		makeWAV(wavePCM, 2, 4000000000, 16, 64),
+	} {
+		_, err := Parse(data)
+		assert.Error(t, err)
+		_, err = Decode(data, func([]float64) error { return nil })
+		assert.Error(t, err)
+	}
+
+	comm := make([]byte, 18)
+	binary.BigEndian.PutUint16(comm, MaxChannels+1)
+	copy(comm[8:], []byte{0x40, 0x0e, 0xac, 0x44}) // 44100 as 80-bit extended
+	body := []byte("AIFF")
+	body = append(body, chunk(binary.BigEndian, "COMM", comm)...)
+	_, err := Parse(chunk(binary.BigEndian, "FORM", body))
+	assert.Error(t, err)
+}
+
+func TestParseFLAC(t *testing.T) {
+	streamInfo := make([]byte, 34)
+	// 96 kHz, 2 channels, 24 bits, 96000*3 samples.
+	x := uint64(96000)<<44 | uint64(2-1)<<41 | uint64(24-1)<<36 | 96000*3
+	binary.BigEndian.PutUint64(streamInfo[10:], x)
+
+	data := append([]byte("fLaC\x80\x00\x00\x22"), streamInfo...)
+	id3 := []byte("ID3\x04\x00\x00\x00\x00\x00\x05abcde")
+
+	for _, d := range [][]byte{data, append(id3, data...)} {
+		info, err := Parse(d)
+		require.NoError(t, err)
+		assert.Equal(t, &Info{
+			Format:     "flac",
+			Codec:      CodecFLAC,
+			SampleRate: 96000,
+			BitDepth:   24,
+			Channels:   2,
+			Duration:   3 * time.Second,
+		}, info)
+	}
+}
+
+// mp3Frames makes n frames of MPEG 1 layer III at 128 kbit/s, 44.1 kHz.
+func mp3Frames(n int, mono bool) ([]byte, int) {
+	const frameLen = 144000 * 128 / 44100
+	header := []byte{0xff, 0xfb, 0x90, 0x00}
+	if mono {
+		header[3] = 0xc0
+	}
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		buf.Write(header)
+		buf.Write(make([]byte, frameLen-4))
+	}
+	return buf.Bytes(), frameLen
+}
+
+func TestParseMP3CBR(t *testing.T) {
+	data, frameLen := mp3Frames(100, false)
+	data = append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), data...)
+
+	info, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "mp3", info.Format)
+	assert.Equal(t, CodecMP3, info.Codec)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 0, info.BitDepth)
+	assert.Equal(t, 2, info.Channels)
+	want := time.Duration(float64(100*frameLen*8) / 128000 * float64(time.Second))
+	assert.Equal(t, want, info.Duration)
+}
+
+func TestParseMP3Xing(t *testing.T) {
+	data, _ := mp3Frames(10, true)
+	// Xing header claims 1000 frames after 17 bytes of mono side info.
+	xing := data[4+17:]
+	copy(xing, "Xing")
+	binary.BigEndian.PutUint32(xing[4:], 0x1)
+	binary.BigEndian.PutUint32(xing[8:], 1000)
+
+	info, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Channels)
+	assert.Equal(t, duration(1000*1152, 44100), info.Duration)
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, d := range [][]byte{
+		nil,
+		[]byte("plain text"),
+		{0xff, 0xfb, 0x90, 0x00, 0x01, 0x02}, // lone sync followed by garbage
+		bytes.Repeat([]byte{0xff}, 4096),
+	} {
+		_, err := Parse(d)
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,241 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var ErrNotWAV = errors.New("audio: not a wav file")
+
+// Marker is a cue point of a WAV file, optionally spanning a region.
+type Marker struct {
+	ID     uint32 // Cue point ID, unique in the file
+	Offset uint32 // Sample frame
+	Length uint32 // Sample frames, 0 if a point
+	Label  string
+	Note   string
+}
+
+const (
+	cueSize    = 24 // cue point in cue chunk
+	ltxtSize   = 20 // ltxt chunk before its text
+	adtlRegion = "rgn "
+	adtlType   = "adtl"
+)
+
+// wavChunk is a chunk of a WAV file. Body is cut to what's actually there.
+type wavChunk struct {
+	id   string
+	body []byte
+}
+
+// riffChunks splits data into chunks, starting at off.
+func riffChunks(data []byte, off int) []wavChunk {
+	var chunks []wavChunk
+	for off+8 <= len(data) {
+		size := uint64(binary.LittleEndian.Uint32(data[off+4:]))
+		body := data[off+8:]
+		if size < uint64(len(body)) {
+			body = body[:size]
+		}
+		chunks = append(chunks, wavChunk{id: string(data[off : off+4]), body: body})
+
+		off += 8 + int(size) + int(size&1)
+		if off < 0 { // overflow on 32-bit platforms
+			break
+		}
+	}
+	return chunks
+}
+
+func (c *wavChunk) isADTL() bool {
+	return c.id == "LIST" && len(c.body) >= 4 && string(c.body[:4]) == adtlType
+}
+
+// ReadMarkers reads cue points of a WAV file from its cue chunk, with their
+// labels, notes and region lengths from its LIST/adtl chunk. Markers are
+// ordered by offset, nil if there are none.
+func ReadMarkers(data []byte) ([]Marker, error) {
+	if !isWAV(data) {
+		return nil, ErrNotWAV
+	}
+
+	var (
+		markers []Marker
+		index   = make(map[uint32]int) // by ID
+	)
+	chunks := riffChunks(data, 12)
+	for _, c := range chunks {
+		if c.id != "cue " || len(c.body) < 4 {
+			continue
+		}
+		n := int(binary.LittleEndian.Uint32(c.body))
+		if n > (len(c.body)-4)/cueSize {
+			return nil, errors.New("audio: wav: cue chunk is too short")
+		}
+		for i := 0; i < n; i++ {
+			p := c.body[4+i*cueSize:]
+			m := Marker{
+				ID:     binary.LittleEndian.Uint32(p),
+				Offset: binary.LittleEndian.Uint32(p[20:]), // sample offset
+			}
+			if m.Offset == 0 {
+				// Some writers set only the play order position, which is
+				// the same for files with a single data chunk.
+				m.Offset = binary.LittleEndian.Uint32(p[4:])
+			}
+			if _, ok := index[m.ID]; ok {
+				continue
+			}
+			index[m.ID] = len(markers)
+			markers = append(markers, m)
+		}
+	}
+
+	for _, c := range chunks {
+		if !c.isADTL() {
+			continue
+		}
+		for _, s := range riffChunks(c.body, 4) {
+			if len(s.body) < 4 {
+				continue
+			}
+			i, ok := index[binary.LittleEndian.Uint32(s.body)]
+			if !ok {
+				continue
+			}
+			switch s.id {
+			case "labl":
+				markers[i].Label = cString(s.body[4:])
+			case "note":
+				markers[i].Note = cString(s.body[4:])
+			case "ltxt":
+				if len(s.body) < ltxtSize {
+					continue
+				}
+				markers[i].Length = binary.LittleEndian.Uint32(s.body[4:])
+				if markers[i].Label == "" {
+					markers[i].Label = cString(s.body[ltxtSize:])
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Offset < markers[j].Offset })
+	return markers, nil
+}
+
+// cString returns text up to the NUL terminator.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// WriteMarkers returns a copy of WAV file with its cue points replaced by
+// markers. Markers with zero IDs are assigned unused ones. Other chunks are
+// kept as they are.
+func WriteMarkers(data []byte, markers []Marker) ([]byte, error) {
+	if !isWAV(data) {
+		return nil, ErrNotWAV
+	}
+
+	markers = append([]Marker(nil), markers...)
+	used := make(map[uint32]bool, len(markers))
+	for _, m := range markers {
+		if m.ID != 0 {
+			if used[m.ID] {
+				return nil, errors.New("audio: wav: duplicate cue point id")
+			}
+			used[m.ID] = true
+		}
+	}
+	next := uint32(1)
+	for i := range markers {
+		if markers[i].ID != 0 {
+			continue
+		}
+		for used[next] {
+			next++
+		}
+		markers[i].ID = next
+		used[next] = true
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(markers)*64))
+	out.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range riffChunks(data, 12) {
+		if c.id == "cue " || c.isADTL() {
+			continue
+		}
+		writeChunk(out, c.id, c.body)
+	}
+	if len(markers) > 0 {
+		writeChunk(out, "cue ", cueChunk(markers))
+		writeChunk(out, "LIST", adtlChunk(markers))
+	}
+
+	b := out.Bytes()
+	if uint64(len(b))-8 > math.MaxUint32 {
+		return nil, errors.New("audio: wav: file is too large")
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b, nil
+}
+
+func cueChunk(markers []Marker) []byte {
+	b := make([]byte, 4+len(markers)*cueSize)
+	binary.LittleEndian.PutUint32(b, uint32(len(markers)))
+	for i, m := range markers {
+		p := b[4+i*cueSize:]
+		binary.LittleEndian.PutUint32(p, m.ID)
+		binary.LittleEndian.PutUint32(p[4:], m.Offset) // play order position
+		copy(p[8:], "data")
+		// Chunk and block starts are 0 for uncompressed data.
+		binary.LittleEndian.PutUint32(p[20:], m.Offset)
+	}
+	return b
+}
+
+func adtlChunk(markers []Marker) []byte {
+	var b bytes.Buffer
+	b.WriteString(adtlType)
+	text := func(id string, cue uint32, s string) {
+		body := make([]byte, 4, 4+len(s)+1)
+		binary.LittleEndian.PutUint32(body, cue)
+		body = append(body, s...)
+		writeChunk(&b, id, append(body, 0))
+	}
+	for _, m := range markers {
+		if m.Label != "" {
+			text("labl", m.ID, m.Label)
+		}
+		if m.Note != "" {
+			text("note", m.ID, m.Note)
+		}
+		if m.Length > 0 {
+			body := make([]byte, ltxtSize)
+			binary.LittleEndian.PutUint32(body, m.ID)
+			binary.LittleEndian.PutUint32(body[4:], m.Length)
+			copy(body[8:], adtlRegion)
+			// Country, language, dialect and code page are left unspecified.
+			writeChunk(&b, "ltxt", body)
+		}
+	}
+	return b.Bytes()
+}
+
+func writeChunk(b *bytes.Buffer, id string, body []byte) {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(body)))
+	b.WriteString(id)
+	b.Write(size[:])
+	b.Write(body)
+	if len(body)%2 == 1 {
+		b.WriteByte(0)
+	}
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMarkers(t *testing.T) {
+	cue := make([]byte, 4+2*cueSize)
+	binary.LittleEndian.PutUint32(cue, 2)
+	binary.LittleEndian.PutUint32(cue[4:], 7)        // id
+	binary.LittleEndian.PutUint32(cue[4+20:], 96000) // sample offset
+	binary.LittleEndian.PutUint32(cue[28:], 3)
+	binary.LittleEndian.PutUint32(cue[28+4:], 48000) // position only
+
+	labl := []byte{7, 0, 0, 0, 'V', 'e', 'r', 's', 'e', 0}
+	ltxt := make([]byte, ltxtSize)
+	binary.LittleEndian.PutUint32(ltxt, 3)
+	binary.LittleEndian.PutUint32(ltxt[4:], 24000)
+	copy(ltxt[8:], adtlRegion)
+	adtl := []byte(adtlType)
+	adtl = append(adtl, chunk(binary.LittleEndian, "labl", labl)...)
+	adtl = append(adtl, chunk(binary.LittleEndian, "ltxt", append(ltxt, "Intro\x00"...))...)
+
+	data := makeWAV(wavePCM, 2, 48000, 16, 4*48000*3)
+	data = append(data[:len(data):len(data)], chunk(binary.LittleEndian, "cue ", cue)...)
+	data = append(data, chunk(binary.LittleEndian, "LIST", adtl)...)
+
+	m, err := ReadMarkers(data)
+	require.NoError(t, err)
+	assert.Equal(t, []Marker{
+		{ID: 3, Offset: 48000, Length: 24000, Label: "Intro"},
+		{ID: 7, Offset: 96000, Label: "Verse"},
+	}, m)
+
+	m, err = ReadMarkers(makeWAV(wavePCM, 2, 48000, 16, 4))
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	_, err = ReadMarkers([]byte("fLaC"))
+	assert.ErrorIs(t, err, ErrNotWAV)
+}
+
+func TestWriteMarkers(t *testing.T) {
+	orig := makeWAV(wavePCM, 1, 44100, 16, 2*44100+2)
+	markers := []Marker{
+		{Offset: 0, Label: "Intro", Note: "count-in"},
+		{ID: 1, Offset: 22050, Length: 11025, Label: "Chorus"},
+	}
+	data, err := WriteMarkers(orig, markers)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+
+	info, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, 44100, info.SampleRate)
+
+	m, err := ReadMarkers(data)
+	require.NoError(t, err)
+	assert.Equal(t, []Marker{
+		{ID: 2, Offset: 0, Label: "Intro", Note: "count-in"},
+		{ID: 1, Offset: 22050, Length: 11025, Label: "Chorus"},
+	}, m)
+
+	// Rewriting replaces the markers.
+	data, err = WriteMarkers(data, markers[1:])
+	require.NoError(t, err)
+	m, err = ReadMarkers(data)
+	require.NoError(t, err)
+	assert.Len(t, m, 1)
+
+	data, err = WriteMarkers(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, orig, data)
+
+	_, err = WriteMarkers(orig, []Marker{{ID: 1}, {ID: 1}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNotDecodable is returned by Decode for formats or codecs which can't be
+// decoded, such as MP3.
+var ErrNotDecodable = errors.New("audio: not decodable")
+
+// decodeFrames is the number of frames passed to Decode's callback at once.
+const decodeFrames = 4096
+
+// Decodable reports whether Decode supports format and codec as reported in
+// Info.
+func Decodable(format, codec string) bool {
+	switch format {
+	case "wav", "aiff":
+		return codec == CodecPCM || codec == CodecFloat
+	case "flac":
+		return true
+	}
+	return false
+}
+
+// Decode decodes data, calling fn with consecutive blocks of samples, which
+// are interleaved by channel and scaled to [-1, 1]. Blocks are reused between
+// calls. Decoding stops if fn returns an error.
+func Decode(data []byte, fn func(samples []float64) error) (*Info, error) {
+	switch {
+	case isWAV(data):
+		info, p, err := parseWAV(data)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return info, ErrNotDecodable
+		}
+		return info, p.decode(info.Channels, fn)
+	case isAIFF(data):
+		info, p, err := parseAIFF(data)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return info, ErrNotDecodable
+		}
+		return info, p.decode(info.Channels, fn)
+	}
+
+	off := skipID3v2(data)
+	if len(data) >= off+4 && bytes.Equal(data[off:off+4], []byte("fLaC")) {
+		return decodeFLAC(data[off:], fn)
+	}
+	info, err := parseMP3(data, off)
+	if err != nil {
+		return nil, err
+	}
+	return info, ErrNotDecodable
+}
+
+// pcm is the layout of uncompressed samples.
+type pcm struct {
+	data     []byte
+	size     int // Bytes per sample
+	float    bool
+	unsigned bool
+	order    binary.ByteOrder
+}
+
+func (p *pcm) decode(channels int, fn func(samples []float64) error) error {
+	switch {
+	case channels <= 0:
+		return errors.New("audio: invalid channel count")
+	case p.float && p.size != 4 && p.size != 8:
+		return fmt.Errorf("audio: unsupported float sample size: %d", p.size)
+	case !p.float && (p.size < 1 || p.size > 4):
+		return fmt.Errorf("audio: unsupported sample size: %d", p.size)
+	}
+
+	frameSize := p.size * channels
+	data := p.data[:len(p.data)-len(p.data)%frameSize] // drop incomplete frame
+	buf := make([]float64, 0, decodeFrames*channels)
+	scale := math.Ldexp(1, 8*p.size-1)
+	word := make([]byte, 8)
+
+	for off := 0; off < len(data); off += p.size {
+		var v float64
+		b := data[off : off+p.size]
+		switch {
+		case p.float && p.size == 4:
+			v = float64(math.Float32frombits(p.order.Uint32(b)))
+		case p.float:
+			v = math.Float64frombits(p.order.Uint64(b))
+		default:
+			// Place sample in the high bytes of a 32-bit word, so that its
+			// sign is extended by the shift below.
+			for i := range word[:4] {
+				word[i] = 0
+			}
+			if p.order == binary.LittleEndian {
+				copy(word[4-p.size:4], b)
+				v = float64(int32(binary.LittleEndian.Uint32(word)) >> (32 - 8*p.size))
+			} else {
+				copy(word, b)
+				v = float64(int32(binary.BigEndian.Uint32(word)) >> (32 - 8*p.size))
+			}
+			if p.unsigned {
+				v = float64(uint8(b[0])) - scale
+			}
+			v /= scale
+		}
+
+		buf = append(buf, v)
+		if len(buf) == cap(buf) {
+			if err := fn(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	if len(buf) > 0 {
+		return fn(buf)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeAll(t *testing.T, data []byte) (*Info, []float64) {
+	var all []float64
+	info, err := Decode(data, func(samples []float64) error {
+		all = append(all, samples...)
+		return nil
+	})
+	require.NoError(t, err)
+	return info, all
+}
+
+func TestDecodeWAV(t *testing.T) {
+	data := makeWAV(wavePCM, 2, 44100, 16, 8)
+	samples := data[len(data)-8:]
+	for i, v := range []int16{0, -32768, 16384, 32767} {
+		binary.LittleEndian.PutUint16(samples[2*i:], uint16(v))
+	}
+	_, got := decodeAll(t, data)
+	assert.Equal(t, []float64{0, -1, 0.5, 32767.0 / 32768}, got)
+
+	data = makeWAV(wavePCM, 1, 44100, 24, 6)
+	copy(data[len(data)-6:], []byte{0x00, 0x00, 0xc0, 0xff, 0xff, 0x3f}) // -0.5, 0.5-
+	_, got = decodeAll(t, data)
+	assert.Equal(t, []float64{-0.5, float64(0x3fffff) / (1 << 23)}, got)
+
+	data = makeWAV(wavePCM, 1, 8000, 8, 3)
+	copy(data[len(data)-4:], []byte{0x00, 0x80, 0xc0}) // unsigned
+	_, got = decodeAll(t, data[:len(data)-1])          // strip chunk padding
+	assert.Equal(t, []float64{-1, 0, 0.5}, got)
+
+	data = makeWAV(waveFloat, 1, 48000, 32, 4)
+	binary.LittleEndian.PutUint32(data[len(data)-4:], math.Float32bits(-0.25))
+	_, got = decodeAll(t, data)
+	assert.Equal(t, []float64{-0.25}, got)
+}
+
+func TestDecodeAIFF(t *testing.T) {
+	comm := make([]byte, 18)
+	binary.BigEndian.PutUint16(comm, 1)
+	binary.BigEndian.PutUint32(comm[2:], 2)
+	binary.BigEndian.PutUint16(comm[6:], 16)
+	copy(comm[8:], []byte{0x40, 0x0e, 0xac, 0x44})
+
+	ssnd := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xc0, 0x00, 0x40, 0x00} // -0.5, 0.5
+	body := []byte("AIFF")
+	body = append(body, chunk(binary.BigEndian, "COMM", comm)...)
+	body = append(body, chunk(binary.BigEndian, "SSND", ssnd)...)
+
+	_, got := decodeAll(t, chunk(binary.BigEndian, "FORM", body))
+	assert.Equal(t, []float64{-0.5, 0.5}, got)
+}
+
+func TestDecodeNotDecodable(t *testing.T) {
+	data, _ := mp3Frames(4, false)
+	_, err := Decode(data, func([]float64) error { return nil })
+	assert.ErrorIs(t, err, ErrNotDecodable)
+
+	_, err = Decode(makeWAV(waveALaw, 1, 8000, 8, 8), func([]float64) error { return nil })
+	assert.ErrorIs(t, err, ErrNotDecodable)
+
+	assert.True(t, Decodable("flac", CodecFLAC))
+	assert.True(t, Decodable("wav", CodecPCM))
+	assert.False(t, Decodable("wav", CodecALaw))
+	assert.False(t, Decodable("mp3", CodecMP3))
+}
+
+// bitWriter is a minimal FLAC encoder's bit writer.
+type bitWriter struct {
+	buf []byte
+	n   uint // Bits used in the last byte
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.n == 0 || w.n == 8 {
+			w.buf = append(w.buf, 0)
+			w.n = 0
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << (7 - w.n)
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *bitWriter) align() {
+	w.n = 8
+}
+
+// rice writes residual with partition order 0 and parameter k.
+func (w *bitWriter) rice(residual []int64, k uint) {
+	w.write(0, 2) // 4-bit parameters
+	w.write(0, 4) // partition order
+	w.write(uint64(k), 4)
+	for _, r := range residual {
+		v := uint64(r<<1) ^ uint64(r>>63)
+		for q := v >> k; q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(v, k)
+	}
+}
+
+func (w *bitWriter) frameHeader(blockSize int, assignment uint64) {
+	w.write(0x3ffe, 14)
+	w.write(0, 2)
+	w.write(7, 4) // block size in 16 bits
+	w.write(0, 4) // sample rate from STREAMINFO
+	w.write(assignment, 4)
+	w.write(4, 3) // 16 bits
+	w.write(0, 1)
+	w.write(0, 8) // frame number
+	w.write(uint64(blockSize-1), 16)
+	w.write(0, 8) // CRC-8, not verified
+}
+
+func (w *bitWriter) fixed(s []int64, order int, bps uint) {
+	w.write(0, 1)
+	w.write(uint64(8+order), 6)
+	w.write(0, 1)
+	for _, v := range s[:order] {
+		w.writeSigned(v, bps)
+	}
+	residual := make([]int64, 0, len(s))
+	for i := order; i < len(s); i++ {
+		pred := int64(0)
+		switch order {
+		case 1:
+			pred = s[i-1]
+		case 2:
+			pred = 2*s[i-1] - s[i-2]
+		}
+		residual = append(residual, s[i]-pred)
+	}
+	w.rice(residual, 3)
+}
+
+func (w *bitWriter) lpc(s []int64, coefs []int64, precision, shift uint, bps uint) {
+	w.write(0, 1)
+	w.write(uint64(31+len(coefs)), 6)
+	w.write(0, 1)
+	for _, v := range s[:len(coefs)] {
+		w.writeSigned(v, bps)
+	}
+	w.write(uint64(precision-1), 4)
+	w.writeSigned(int64(shift), 5)
+	for _, c := range coefs {
+		w.writeSigned(c, precision)
+	}
+	residual := make([]int64, 0, len(s))
+	for i := len(coefs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * s[i-1-j]
+		}
+		residual = append(residual, s[i]-sum>>shift)
+	}
+	w.rice(residual, 4)
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	left := []int64{0, 100, 250, 300, 200, -50, -400, -1000, -32768, 32767, 5, 6}
+	right := []int64{10, 90, 200, 310, 190, -60, -300, -900, -30000, 30000, 4, 4}
+	n := len(left)
+
+	streamInfo := make([]byte, 34)
+	x := uint64(44100)<<44 | uint64(2-1)<<41 | uint64(16-1)<<36 | uint64(2*n)
+	binary.BigEndian.PutUint64(streamInfo[10:], x)
+
+	w := &bitWriter{buf: append([]byte("fLaC\x00\x00\x00\x22"), streamInfo...)}
+	w.buf = append(w.buf, 0x81, 0, 0, 4, 0, 0, 0, 0) // last block: padding
+	w.n = 8
+
+	// Frame 1: mid/side, fixed predictors
+	mid := make([]int64, n)
+	side := make([]int64, n)
+	for i := range left {
+		mid[i] = (left[i] + right[i]) >> 1
+		side[i] = left[i] - right[i]
+	}
+	w.frameHeader(n, flacMidSide)
+	w.fixed(mid, 2, 16)
+	w.fixed(side, 1, 17)
+	w.align()
+	w.write(0, 16)
+
+	// Frame 2: independent, constant and LPC subframes
+	w.frameHeader(n, 1)
+	w.write(0, 1)
+	w.write(0, 6) // constant
+	w.write(0, 1)
+	w.writeSigned(-7, 16)
+	w.lpc(left, []int64{3, -1}, 4, 1, 16)
+	w.align()
+	w.write(0, 16)
+
+	info, got := decodeAll(t, w.buf)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 2, info.Channels)
+
+	want := make([]float64, 0, 4*n)
+	for i := range left {
+		want = append(want, float64(left[i])/32768, float64(right[i])/32768)
+	}
+	for i := range left {
+		want = append(want, -7.0/32768, float64(left[i])/32768)
+	}
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,35 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// parseFLAC reads STREAMINFO, which is always the first metadata block.
+// data starts with the "fLaC" marker.
+func parseFLAC(data []byte) (*Info, error) {
+	const streamInfoLen = 34
+
+	if len(data) < 8+streamInfoLen {
+		return nil, errors.New("audio: flac: too short")
+	}
+	if data[4]&0x7f != 0 {
+		return nil, errors.New("audio: flac: first metadata block is not STREAMINFO")
+	}
+
+	// 20 bits sample rate, 3 bits channels-1, 5 bits bits per sample-1,
+	// 36 bits total samples.
+	x := binary.BigEndian.Uint64(data[8+10:])
+	info := Info{
+		Format:     "flac",
+		Codec:      CodecFLAC,
+		SampleRate: int(x >> 44),
+		Channels:   int(x>>41&0x7) + 1,
+		BitDepth:   int(x>>36&0x1f) + 1,
+	}
+	if err := checkLayout("flac", info.Channels, info.SampleRate); err != nil {
+		return nil, err
+	}
+	info.Duration = duration(x&(1<<36-1), info.SampleRate) // 0 if unknown
+	return &info, nil
+}
@@ -0,0 +1,403 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// FLAC channel assignments for stereo decorrelation.
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+// decodeFLAC decodes FLAC stream. data starts with the "fLaC" marker.
+// Frame CRCs are not verified.
+func decodeFLAC(data []byte, fn func(samples []float64) error) (*Info, error) {
+	info, err := parseFLAC(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip metadata blocks
+	off := 4
+	for {
+		if off+4 > len(data) {
+			return nil, errors.New("audio: flac: truncated metadata")
+		}
+		last := data[off]&0x80 != 0
+		off += 4 + (int(data[off+1])<<16 | int(data[off+2])<<8 | int(data[off+3]))
+		if last {
+			break
+		}
+	}
+	if off > len(data) {
+		return nil, errors.New("audio: flac: truncated metadata")
+	}
+
+	r := &bitReader{data: data[off:]}
+	var (
+		channels [][]int64
+		buf      []float64
+	)
+	for frame := 0; r.remaining() > 0; frame++ {
+		h, err := r.flacFrameHeader(info.BitDepth)
+		if err != nil {
+			if frame > 0 {
+				break // trailing data, e.g. ID3v1 tag
+			}
+			return nil, err
+		}
+
+		for len(channels) < h.channels {
+			channels = append(channels, nil)
+		}
+		for ch := 0; ch < h.channels; ch++ {
+			if cap(channels[ch]) < h.blockSize {
+				channels[ch] = make([]int64, h.blockSize)
+			}
+			channels[ch] = channels[ch][:h.blockSize]
+			if err = r.flacSubframe(channels[ch], h.subframeBits(ch)); err != nil {
+				return nil, fmt.Errorf("audio: flac: frame %d: %w", frame, err)
+			}
+		}
+		r.align()
+		r.read(16) // CRC-16
+		if r.err != nil {
+			return nil, fmt.Errorf("audio: flac: frame %d: %w", frame, r.err)
+		}
+		decorrelate(h.assignment, channels)
+
+		scale := math.Ldexp(1, h.bits-1)
+		buf = buf[:0]
+		for i := 0; i < h.blockSize; i++ {
+			for ch := 0; ch < h.channels; ch++ {
+				buf = append(buf, float64(channels[ch][i])/scale)
+			}
+		}
+		if err = fn(buf); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+type flacFrameHeader struct {
+	blockSize  int
+	bits       int
+	channels   int
+	assignment int
+}
+
+// subframeBits returns sample size of channel's subframe, side channels have
+// an extra bit.
+func (h *flacFrameHeader) subframeBits(ch int) int {
+	switch {
+	case h.assignment == flacLeftSide && ch == 1,
+		h.assignment == flacSideRight && ch == 0,
+		h.assignment == flacMidSide && ch == 1:
+		return h.bits + 1
+	}
+	return h.bits
+}
+
+func (r *bitReader) flacFrameHeader(streamBits int) (*flacFrameHeader, error) {
+	if r.read(14) != 0x3ffe {
+		return nil, errors.New("audio: flac: lost frame sync")
+	}
+	r.read(2) // reserved, blocking strategy
+	blockCode := r.read(4)
+	rateCode := r.read(4)
+	assignment := int(r.read(4))
+	bitsCode := r.read(3)
+	r.read(1) // reserved
+
+	// Frame or sample number, UTF-8 like coded.
+	first := r.read(8)
+	for n := bits.LeadingZeros8(^uint8(first)); n > 1; n-- {
+		r.read(8)
+	}
+
+	h := &flacFrameHeader{assignment: assignment}
+	switch {
+	case blockCode == 0:
+		return nil, errors.New("audio: flac: reserved block size")
+	case blockCode == 1:
+		h.blockSize = 192
+	case blockCode <= 5:
+		h.blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		h.blockSize = int(r.read(8)) + 1
+	case blockCode == 7:
+		h.blockSize = int(r.read(16)) + 1
+	default:
+		h.blockSize = 256 << (blockCode - 8)
+	}
+	switch rateCode {
+	case 12:
+		r.read(8)
+	case 13, 14:
+		r.read(16)
+	case 15:
+		return nil, errors.New("audio: flac: invalid sample rate")
+	}
+	switch bitsCode {
+	case 0:
+		h.bits = streamBits
+	case 1:
+		h.bits = 8
+	case 2:
+		h.bits = 12
+	case 4:
+		h.bits = 16
+	case 5:
+		h.bits = 20
+	case 6:
+		h.bits = 24
+	case 7:
+		h.bits = 32
+	default:
+		return nil, errors.New("audio: flac: reserved sample size")
+	}
+	switch {
+	case assignment < flacLeftSide:
+		h.channels = assignment + 1
+	case assignment <= flacMidSide:
+		h.channels = 2
+	default:
+		return nil, errors.New("audio: flac: reserved channel assignment")
+	}
+	r.read(8) // CRC-8
+	return h, r.err
+}
+
+func (r *bitReader) flacSubframe(out []int64, sampleBits int) error {
+	if r.read(1) != 0 {
+		return errors.New("invalid subframe padding")
+	}
+	typ := int(r.read(6))
+	wasted := 0
+	if r.read(1) == 1 {
+		wasted = r.unary() + 1
+	}
+	sampleBits -= wasted
+	if sampleBits <= 0 {
+		return errors.New("invalid wasted bits")
+	}
+
+	switch {
+	case typ == 0: // constant
+		v := r.readSigned(sampleBits)
+		for i := range out {
+			out[i] = v
+		}
+	case typ == 1: // verbatim
+		for i := range out {
+			out[i] = r.readSigned(sampleBits)
+		}
+	case typ >= 8 && typ <= 12: // fixed
+		order := typ - 8
+		if order > len(out) {
+			return errors.New("predictor order exceeds block size")
+		}
+		for i := 0; i < order; i++ {
+			out[i] = r.readSigned(sampleBits)
+		}
+		if err := r.flacResidual(out, order); err != nil {
+			return err
+		}
+		predictFixed(out, order)
+	case typ >= 32: // LPC
+		order := typ - 31
+		if order > len(out) {
+			return errors.New("predictor order exceeds block size")
+		}
+		for i := 0; i < order; i++ {
+			out[i] = r.readSigned(sampleBits)
+		}
+		precision := int(r.read(4)) + 1
+		if precision == 16 {
+			return errors.New("invalid coefficient precision")
+		}
+		shift := r.readSigned(5)
+		if shift < 0 {
+			return errors.New("negative coefficient shift")
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = r.readSigned(precision)
+		}
+		if err := r.flacResidual(out, order); err != nil {
+			return err
+		}
+		predictLPC(out, coefs, uint(shift))
+	default:
+		return fmt.Errorf("reserved subframe type %d", typ)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= uint(wasted)
+		}
+	}
+	return r.err
+}
+
+// flacResidual reads Rice coded residual into out[order:].
+func (r *bitReader) flacResidual(out []int64, order int) error {
+	var paramBits, escape uint
+	switch r.read(2) {
+	case 0:
+		paramBits, escape = 4, 15
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return errors.New("reserved residual coding method")
+	}
+
+	partOrder := uint(r.read(4))
+	partSize := len(out) >> partOrder
+	if partSize<<partOrder != len(out) || partSize < order {
+		return errors.New("invalid partition order")
+	}
+
+	i := order
+	for p := 0; p < 1<<partOrder; p++ {
+		end := (p + 1) * partSize
+		k := uint(r.read(paramBits))
+		if k == escape {
+			n := int(r.read(5))
+			for ; i < end; i++ {
+				out[i] = r.readSigned(n)
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			v := uint64(r.unary())<<k | r.read(k)
+			out[i] = int64(v>>1) ^ -int64(v&1)
+			if r.err != nil {
+				return r.err
+			}
+		}
+	}
+	return r.err
+}
+
+func predictFixed(s []int64, order int) {
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 1:
+			s[i] += s[i-1]
+		case 2:
+			s[i] += 2*s[i-1] - s[i-2]
+		case 3:
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+}
+
+func predictLPC(s []int64, coefs []int64, shift uint) {
+	for i := len(coefs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * s[i-1-j]
+		}
+		s[i] += sum >> shift
+	}
+}
+
+func decorrelate(assignment int, ch [][]int64) {
+	switch assignment {
+	case flacLeftSide:
+		for i, side := range ch[1] {
+			ch[1][i] = ch[0][i] - side
+		}
+	case flacSideRight:
+		for i, side := range ch[0] {
+			ch[0][i] = side + ch[1][i]
+		}
+	case flacMidSide:
+		for i, side := range ch[1] {
+			mid := ch[0][i]<<1 | side&1
+			ch[0][i] = (mid + side) >> 1
+			ch[1][i] = (mid - side) >> 1
+		}
+	}
+}
+
+// bitReader reads big-endian bit fields. Reading past the end sets err and
+// yields zeros.
+type bitReader struct {
+	data []byte
+	pos  int    // Next byte to load
+	acc  uint64 // Loaded, but unread bits in the low n bits
+	n    uint
+	err  error
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data) - r.pos + int(r.n/8)
+}
+
+// read reads n <= 56 bits.
+func (r *bitReader) read(n uint) uint64 {
+	for r.n < n {
+		if r.pos >= len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		r.acc = r.acc<<8 | uint64(r.data[r.pos])
+		r.pos++
+		r.n += 8
+	}
+	r.n -= n
+	v := r.acc >> r.n
+	r.acc &= 1<<r.n - 1
+	return v
+}
+
+func (r *bitReader) readSigned(n int) int64 {
+	if n == 0 {
+		return 0
+	}
+	v := r.read(uint(n))
+	return int64(v<<(64-uint(n))) >> (64 - uint(n))
+}
+
+// unary counts zero bits up to the next set bit, which is consumed.
+func (r *bitReader) unary() int {
+	count := 0
+	for {
+		if r.n == 0 {
+			if r.pos >= len(r.data) {
+				r.err = io.ErrUnexpectedEOF
+				return count
+			}
+			r.acc = uint64(r.data[r.pos])
+			r.pos++
+			r.n = 8
+		}
+		if r.acc == 0 {
+			count += int(r.n)
+			r.n = 0
+			continue
+		}
+		zeros := uint(bits.LeadingZeros64(r.acc)) - (64 - r.n)
+		count += int(zeros)
+		r.n -= zeros + 1
+		r.acc &= 1<<r.n - 1
+		return count
+	}
+}
+
+// align skips to the next byte boundary.
+func (r *bitReader) align() {
+	r.n -= r.n % 8
+	r.acc &= 1<<r.n - 1
+}
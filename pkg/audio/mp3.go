@@ -0,0 +1,159 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// mp3ScanLimit is how far past the ID3 tag frame sync is looked for.
+const mp3ScanLimit = 64 * 1024
+
+var (
+	// Layer III bitrates in kbit/s by bitrate index.
+	mp3Bitrates1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3Bitrates2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+)
+
+type mp3Header struct {
+	mpeg1      bool
+	version    uint32
+	bitrate    int // kbit/s
+	sampleRate int
+	mono       bool
+	frameLen   int
+}
+
+func (h *mp3Header) samplesPerFrame() int {
+	if h.mpeg1 {
+		return 1152
+	}
+	return 576
+}
+
+// sideInfoLen is length of Layer III side information, which follows the
+// header (assuming no CRC), and which Xing header follows.
+func (h *mp3Header) sideInfoLen() int {
+	switch {
+	case h.mpeg1 && h.mono:
+		return 17
+	case h.mpeg1:
+		return 32
+	case h.mono:
+		return 9
+	}
+	return 17
+}
+
+// parseMP3Header parses Layer III frame header. Returns false if b does not
+// start with one.
+func parseMP3Header(b []byte) (mp3Header, bool) {
+	if len(b) < 4 {
+		return mp3Header{}, false
+	}
+	x := binary.BigEndian.Uint32(b)
+	if x>>21 != 0x7ff {
+		return mp3Header{}, false
+	}
+
+	h := mp3Header{version: x >> 19 & 0x3}
+	layer := x >> 17 & 0x3
+	bitrateIdx := x >> 12 & 0xf
+	rateIdx := x >> 10 & 0x3
+	if h.version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mp3Header{}, false // reserved, not layer III or free format
+	}
+
+	h.mpeg1 = h.version == 3
+	h.sampleRate = mp3SampleRates[h.version][rateIdx]
+	h.mono = x>>6&0x3 == 3
+	padding := int(x >> 9 & 0x1)
+	if h.mpeg1 {
+		h.bitrate = mp3Bitrates1[bitrateIdx]
+		h.frameLen = 144000*h.bitrate/h.sampleRate + padding
+	} else {
+		h.bitrate = mp3Bitrates2[bitrateIdx]
+		h.frameLen = 72000*h.bitrate/h.sampleRate + padding
+	}
+	return h, true
+}
+
+// parseMP3 finds the first frame at or after off. Duration is taken from Xing
+// or VBRI header if present, otherwise constant bitrate is assumed.
+func parseMP3(data []byte, off int) (*Info, error) {
+	end := off + mp3ScanLimit
+	if end > len(data) {
+		end = len(data)
+	}
+
+	for ; off < end; off++ {
+		h, ok := parseMP3Header(data[off:])
+		if !ok || off+h.frameLen > len(data) {
+			continue
+		}
+		// Guard against false sync: the next frame, if any, must match.
+		if next := off + h.frameLen; next+4 <= len(data) {
+			n, ok := parseMP3Header(data[next:])
+			if !ok || n.version != h.version || n.sampleRate != h.sampleRate {
+				continue
+			}
+		}
+		return mp3Info(data, off, h), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func mp3Info(data []byte, off int, h mp3Header) *Info {
+	info := &Info{
+		Format:     "mp3",
+		Codec:      CodecMP3,
+		SampleRate: h.sampleRate,
+		Channels:   2,
+	}
+	if h.mono {
+		info.Channels = 1
+	}
+
+	if frames, ok := mp3VBRFrames(data[off:], h); ok {
+		info.Duration = duration(uint64(frames)*uint64(h.samplesPerFrame()), h.sampleRate)
+		return info
+	}
+
+	size := len(data) - off
+	if size >= 128 && bytes.Equal(data[len(data)-128:len(data)-125], []byte("TAG")) {
+		size -= 128 // ID3v1
+	}
+	info.Duration = time.Duration(float64(size) * 8 / float64(h.bitrate*1000) * float64(time.Second))
+	return info
+}
+
+// mp3VBRFrames returns frame count from Xing (or Info) or VBRI header in the
+// first frame.
+func mp3VBRFrames(frame []byte, h mp3Header) (uint32, bool) {
+	if x := frame[min(len(frame), 4+h.sideInfoLen()):]; len(x) >= 12 &&
+		(bytes.Equal(x[:4], []byte("Xing")) || bytes.Equal(x[:4], []byte("Info"))) {
+		flags := binary.BigEndian.Uint32(x[4:])
+		if flags&0x1 != 0 {
+			return binary.BigEndian.Uint32(x[8:]), true
+		}
+		return 0, false
+	}
+	if v := frame[min(len(frame), 4+32):]; len(v) >= 18 && bytes.Equal(v[:4], []byte("VBRI")) {
+		return binary.BigEndian.Uint32(v[14:]), true
+	}
+	return 0, false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WAVE format tags.
+const (
+	wavePCM        = 0x0001
+	waveFloat      = 0x0003
+	waveALaw       = 0x0006
+	waveMuLaw      = 0x0007
+	waveExtensible = 0xfffe
+)
+
+func waveCodec(tag uint16) string {
+	switch tag {
+	case wavePCM:
+		return CodecPCM
+	case waveFloat:
+		return CodecFloat
+	case waveALaw:
+		return CodecALaw
+	case waveMuLaw:
+		return CodecMuLaw
+	}
+	return fmt.Sprintf("wav/0x%04x", tag)
+}
+
+// parseWAV reads metadata and, if samples are PCM or float, their layout.
+func parseWAV(data []byte) (*Info, *pcm, error) {
+	var (
+		info       = Info{Format: "wav"}
+		byteRate   uint32
+		blockAlign int
+		haveFmt    bool
+		samples    []byte
+		haveData   bool
+		frames     uint64 // from fact chunk, 0 if absent
+	)
+
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := uint64(binary.LittleEndian.Uint32(data[off+4:]))
+		body := data[off+8:]
+		if size < uint64(len(body)) {
+			body = body[:size]
+		}
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, nil, errors.New("audio: wav: fmt chunk is too short")
+			}
+			tag := binary.LittleEndian.Uint16(body)
+			if tag == waveExtensible && len(body) >= 26 {
+				tag = binary.LittleEndian.Uint16(body[24:]) // first bytes of SubFormat GUID
+			}
+			info.Codec = waveCodec(tag)
+			info.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			byteRate = binary.LittleEndian.Uint32(body[8:])
+			blockAlign = int(binary.LittleEndian.Uint16(body[12:]))
+			info.BitDepth = int(binary.LittleEndian.Uint16(body[14:]))
+			if err := checkLayout("wav", info.Channels, info.SampleRate); err != nil {
+				return nil, nil, err
+			}
+			haveFmt = true
+		case "fact":
+			if len(body) >= 4 {
+				frames = uint64(binary.LittleEndian.Uint32(body))
+			}
+		case "data":
+			// Size may be bogus in streamed or truncated files, trust only
+			// what's actually there.
+			samples = body
+			haveData = true
+		}
+
+		off += 8 + int(size) + int(size&1)
+		if off < 0 { // overflow on 32-bit platforms
+			break
+		}
+	}
+
+	if !haveFmt {
+		return nil, nil, errors.New("audio: wav: missing fmt chunk")
+	}
+	if !haveData {
+		return nil, nil, errors.New("audio: wav: missing data chunk")
+	}
+	switch {
+	case frames > 0:
+		info.Duration = duration(frames, info.SampleRate)
+	case byteRate > 0:
+		info.Duration = time.Duration(float64(len(samples)) / float64(byteRate) * float64(time.Second))
+	}
+
+	if info.Codec != CodecPCM && info.Codec != CodecFloat || blockAlign%info.Channels != 0 {
+		return &info, nil, nil
+	}
+	return &info, &pcm{
+		data:     samples,
+		size:     blockAlign / info.Channels,
+		float:    info.Codec == CodecFloat,
+		unsigned: blockAlign/info.Channels == 1, // 8-bit WAV is unsigned
+		order:    binary.LittleEndian,
+	}, nil
+}
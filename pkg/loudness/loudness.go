@@ -0,0 +1,258 @@
+// Package loudness measures loudness and levels of audio: integrated loudness
+// (ITU-R BS.1770, EBU R128), loudness range (EBU Tech 3342), true peak, sample
+// peak and RMS level.
+package loudness
+
+import (
+	"math"
+	"sort"
+)
+
+// MinLevel is the lowest level reported, e.g. for silence.
+const MinLevel = -120.0
+
+const (
+	absoluteGate  = -70.0 // LUFS
+	relativeGate  = -10.0 // LU, for integrated loudness
+	rangeGate     = -20.0 // LU, for loudness range
+	blockSubs     = 4     // 400 ms momentary block in 100 ms sub-blocks
+	shortTermSubs = 30    // 3 s short-term block in 100 ms sub-blocks
+)
+
+// Result of a measurement.
+type Result struct {
+	Integrated    float64 // LUFS
+	LoudnessRange float64 // LU
+	TruePeak      float64 // dBTP
+	SamplePeak    float64 // dBFS
+	RMS           float64 // dBFS, over all channels
+}
+
+// Meter measures samples written to it.
+type Meter struct {
+	channels int
+	weights  []float64
+	shelf    biquad
+	highPass biquad
+	state    [][4]float64 // Per channel filter state
+
+	subLen    int       // Frames per sub-block
+	subFrames int       // Frames in current sub-block
+	subEnergy float64   // Weighted sum of squares in current sub-block
+	subs      []float64 // Mean weighted energy of each complete sub-block
+
+	peak       float64
+	truePeak   *truePeakMeter
+	sumSquares float64
+	samples    int
+}
+
+// NewMeter returns a Meter of audio with given sample rate and channels.
+// Channels of 5.1 audio are expected in L, R, C, LFE, Ls, Rs order.
+func NewMeter(sampleRate, channels int) *Meter {
+	m := &Meter{
+		channels: channels,
+		weights:  make([]float64, channels),
+		state:    make([][4]float64, channels),
+		subLen:   (sampleRate + 5) / 10,
+		truePeak: newTruePeakMeter(sampleRate, channels),
+	}
+	m.shelf, m.highPass = kWeighting(float64(sampleRate))
+	for i := range m.weights {
+		m.weights[i] = 1
+	}
+	if channels == 6 {
+		m.weights[3] = 0    // LFE
+		m.weights[4] = 1.41 // surrounds
+		m.weights[5] = 1.41
+	}
+	return m
+}
+
+// Write adds samples interleaved by channel and scaled to [-1, 1]. Samples of
+// an incomplete frame are ignored.
+func (m *Meter) Write(samples []float64) error {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			x := samples[i+ch]
+			if a := math.Abs(x); a > m.peak {
+				m.peak = a
+			}
+			m.sumSquares += x * x
+
+			s := &m.state[ch]
+			y := m.shelf.process(x, s[0:2])
+			y = m.highPass.process(y, s[2:4])
+			m.subEnergy += m.weights[ch] * y * y
+		}
+		m.truePeak.write(samples[i : i+m.channels])
+		m.samples += m.channels
+
+		m.subFrames++
+		if m.subFrames == m.subLen {
+			m.subs = append(m.subs, m.subEnergy/float64(m.subLen))
+			m.subFrames = 0
+			m.subEnergy = 0
+		}
+	}
+	return nil
+}
+
+// Result returns measurement of samples written so far.
+func (m *Meter) Result() Result {
+	r := Result{
+		Integrated:    gatedLoudness(m.blocks(blockSubs), relativeGate),
+		LoudnessRange: loudnessRange(m.blocks(shortTermSubs)),
+		TruePeak:      decibels(math.Max(m.truePeak.peak, m.peak)),
+		SamplePeak:    decibels(m.peak),
+		RMS:           MinLevel,
+	}
+	if m.samples > 0 {
+		r.RMS = clamp(10 * math.Log10(m.sumSquares/float64(m.samples)))
+	}
+	return r
+}
+
+// blocks returns mean energies of overlapping blocks of n sub-blocks, each
+// following the previous by one sub-block.
+func (m *Meter) blocks(n int) []float64 {
+	if len(m.subs) < n {
+		return nil
+	}
+	blocks := make([]float64, 0, len(m.subs)-n+1)
+	sum := 0.0
+	for i, e := range m.subs {
+		sum += e
+		if i >= n {
+			sum -= m.subs[i-n]
+		}
+		if i >= n-1 {
+			blocks = append(blocks, math.Max(sum, 0)/float64(n))
+		}
+	}
+	return blocks
+}
+
+// gatedLoudness returns loudness of blocks above the absolute gate and the
+// relative gate below their loudness.
+func gatedLoudness(blocks []float64, gate float64) float64 {
+	gated := gateBlocks(blocks, gate)
+	if len(gated) == 0 {
+		return MinLevel
+	}
+	return clamp(loudness(mean(gated)))
+}
+
+func gateBlocks(blocks []float64, gate float64) []float64 {
+	abs := make([]float64, 0, len(blocks))
+	for _, e := range blocks {
+		if loudness(e) > absoluteGate {
+			abs = append(abs, e)
+		}
+	}
+	if len(abs) == 0 {
+		return nil
+	}
+	threshold := loudness(mean(abs)) + gate
+	gated := abs[:0]
+	for _, e := range abs {
+		if loudness(e) > threshold {
+			gated = append(gated, e)
+		}
+	}
+	return gated
+}
+
+// loudnessRange returns the spread between 10th and 95th percentile of gated
+// short-term loudness.
+func loudnessRange(blocks []float64) float64 {
+	gated := gateBlocks(blocks, rangeGate)
+	if len(gated) == 0 {
+		return 0
+	}
+	levels := make([]float64, len(gated))
+	for i, e := range gated {
+		levels[i] = loudness(e)
+	}
+	sort.Float64s(levels)
+	percentile := func(p float64) float64 {
+		return levels[int(math.Round(p*float64(len(levels)-1)))]
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+func loudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func decibels(amplitude float64) float64 {
+	return clamp(20 * math.Log10(amplitude))
+}
+
+func clamp(level float64) float64 {
+	if math.IsNaN(level) || level < MinLevel {
+		return MinLevel
+	}
+	return level
+}
+
+func mean(v []float64) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// biquad is a second order IIR filter, with a0 normalized to 1.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// process filters x in transposed direct form II with state s.
+func (f *biquad) process(x float64, s []float64) float64 {
+	y := f.b0*x + s[0]
+	s[0] = f.b1*x - f.a1*y + s[1]
+	s[1] = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns BS.1770 K-weighting pre-filter (high shelf) and RLB
+// filter (high pass) for the sample rate.
+func kWeighting(rate float64) (biquad, biquad) {
+	var shelf, highPass biquad
+	{
+		const (
+			f0   = 1681.974450955533
+			gain = 3.999843853973347
+			q    = 0.7071752369554196
+		)
+		k := math.Tan(math.Pi * f0 / rate)
+		vh := math.Pow(10, gain/20)
+		vb := math.Pow(vh, 0.4996667741545416)
+		a0 := 1 + k/q + k*k
+		shelf = biquad{
+			b0: (vh + vb*k/q + k*k) / a0,
+			b1: 2 * (k*k - vh) / a0,
+			b2: (vh - vb*k/q + k*k) / a0,
+			a1: 2 * (k*k - 1) / a0,
+			a2: (1 - k/q + k*k) / a0,
+		}
+	}
+	{
+		const (
+			f0 = 38.13547087602444
+			q  = 0.5003270373238773
+		)
+		k := math.Tan(math.Pi * f0 / rate)
+		a0 := 1 + k/q + k*k
+		highPass = biquad{
+			b0: 1,
+			b1: -2,
+			b2: 1,
+			a1: 2 * (k*k - 1) / a0,
+			a2: (1 - k/q + k*k) / a0,
+		}
+	}
+	return shelf, highPass
+}
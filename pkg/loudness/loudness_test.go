@@ -0,0 +1,75 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sine returns interleaved stereo sine of given amplitude in dBFS.
+func sine(rate int, freq, level, phase float64, seconds float64) []float64 {
+	amp := math.Pow(10, level/20)
+	n := int(float64(rate) * seconds)
+	s := make([]float64, 0, 2*n)
+	for i := 0; i < n; i++ {
+		v := amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+phase)
+		s = append(s, v, v)
+	}
+	return s
+}
+
+func TestIntegrated(t *testing.T) {
+	// EBU Tech 3341 case 1: stereo 1 kHz sine at -23 dBFS reads -23 LUFS.
+	for _, rate := range []int{44100, 48000} {
+		m := NewMeter(rate, 2)
+		require.NoError(t, m.Write(sine(rate, 997, -23, 0, 20)))
+		r := m.Result()
+		assert.InDelta(t, -23, r.Integrated, 0.1)
+		assert.InDelta(t, 0, r.LoudnessRange, 0.1)
+		assert.InDelta(t, -23, r.SamplePeak, 0.1)
+		assert.InDelta(t, -23, r.TruePeak, 0.1)
+		assert.InDelta(t, -26.01, r.RMS, 0.05)
+	}
+}
+
+func TestIntegratedGating(t *testing.T) {
+	// EBU Tech 3341 case 3: 10 s at -36, 60 s at -23, 10 s at -36 dBFS reads
+	// -23 LUFS, quiet parts being gated out.
+	m := NewMeter(48000, 2)
+	require.NoError(t, m.Write(sine(48000, 1000, -36, 0, 10)))
+	require.NoError(t, m.Write(sine(48000, 1000, -23, 0, 60)))
+	require.NoError(t, m.Write(sine(48000, 1000, -36, 0, 10)))
+	assert.InDelta(t, -23, m.Result().Integrated, 0.1)
+}
+
+func TestLoudnessRange(t *testing.T) {
+	// EBU Tech 3342 case 1: 20 s at -20 and 20 s at -30 dBFS reads 10 LU.
+	m := NewMeter(48000, 2)
+	require.NoError(t, m.Write(sine(48000, 1000, -20, 0, 20)))
+	require.NoError(t, m.Write(sine(48000, 1000, -30, 0, 20)))
+	assert.InDelta(t, 10, m.Result().LoudnessRange, 0.2)
+}
+
+func TestTruePeak(t *testing.T) {
+	// Sine at quarter of sample rate with 45° phase: samples are at 0.707 of
+	// its amplitude, missing the peak by 3 dB.
+	m := NewMeter(48000, 2)
+	require.NoError(t, m.Write(sine(48000, 12000, -6, math.Pi/4, 1)))
+	r := m.Result()
+	assert.InDelta(t, -9.01, r.SamplePeak, 0.05)
+	assert.InDelta(t, -6, r.TruePeak, 0.3)
+}
+
+func TestSilence(t *testing.T) {
+	m := NewMeter(44100, 1)
+	require.NoError(t, m.Write(make([]float64, 44100)))
+	assert.Equal(t, Result{
+		Integrated:    MinLevel,
+		LoudnessRange: 0,
+		TruePeak:      MinLevel,
+		SamplePeak:    MinLevel,
+		RMS:           MinLevel,
+	}, m.Result())
+}
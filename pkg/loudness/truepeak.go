@@ -0,0 +1,82 @@
+package loudness
+
+import "math"
+
+// tapsPerPhase of the interpolation filter, as in BS.1770 Annex 2.
+const tapsPerPhase = 12
+
+// truePeakMeter measures peak of signal oversampled to at least 192 kHz.
+type truePeakMeter struct {
+	factor  int
+	phases  [][]float64 // Interpolation filter coefficients by phase
+	history [][]float64 // Per channel ring of recent samples
+	pos     int
+	peak    float64
+}
+
+func newTruePeakMeter(sampleRate, channels int) *truePeakMeter {
+	m := &truePeakMeter{factor: 1}
+	switch {
+	case sampleRate < 96000:
+		m.factor = 4
+	case sampleRate < 192000:
+		m.factor = 2
+	}
+	if m.factor == 1 {
+		return m
+	}
+
+	// Windowed sinc low pass at the original Nyquist frequency, split into
+	// phases. Each phase is normalized to unity gain.
+	n := m.factor * tapsPerPhase
+	center := float64(n-1) / 2
+	m.phases = make([][]float64, m.factor)
+	for p := range m.phases {
+		m.phases[p] = make([]float64, tapsPerPhase)
+		sum := 0.0
+		for j := range m.phases[p] {
+			k := float64(j*m.factor + p)
+			t := (k - center) / float64(m.factor)
+			h := sinc(t) * (0.5 - 0.5*math.Cos(2*math.Pi*(k+0.5)/float64(n)))
+			m.phases[p][j] = h
+			sum += h
+		}
+		for j := range m.phases[p] {
+			m.phases[p][j] /= sum
+		}
+	}
+	m.history = make([][]float64, channels)
+	for ch := range m.history {
+		m.history[ch] = make([]float64, tapsPerPhase)
+	}
+	return m
+}
+
+// write adds a frame.
+func (m *truePeakMeter) write(frame []float64) {
+	if m.factor == 1 {
+		return // sample peak suffices
+	}
+	for ch, x := range frame {
+		h := m.history[ch]
+		h[m.pos] = x
+		for _, coefs := range m.phases {
+			y := 0.0
+			// coefs[j] applies to the sample j frames ago.
+			for j, c := range coefs {
+				y += c * h[(m.pos-j+tapsPerPhase)%tapsPerPhase]
+			}
+			if a := math.Abs(y); a > m.peak {
+				m.peak = a
+			}
+		}
+	}
+	m.pos = (m.pos + 1) % tapsPerPhase
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,527 @@
+package midi
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Status of a track in a diff.
+const (
+	StatusAdded     = "added"
+	StatusRemoved   = "removed"
+	StatusModified  = "modified"
+	StatusUnchanged = "unchanged"
+)
+
+// Diff is a musical difference of two sequences, suited for piano roll views.
+// Ticks are in head's time division, base's ticks are rescaled to it.
+type Diff struct {
+	TicksPerQuarter int                 `json:"ticksPerQuarter"` // 0 if time division is SMPTE based
+	TicksPerSecond  int                 `json:"ticksPerSecond,omitempty"`
+	Length          int                 `json:"length"` // Ticks, the longer of both
+	Tracks          []TrackDiff         `json:"tracks"`
+	Tempos          []TempoDiff         `json:"tempos"`
+	TimeSignatures  []TimeSignatureDiff `json:"timeSignatures"`
+}
+
+// TrackDiff is a difference of tracks. Tracks are matched by name, then by
+// index.
+type TrackDiff struct {
+	Name      string        `json:"name"` // Head's, or base's if removed
+	Status    string        `json:"status"`
+	Base      int           `json:"base"` // Track index in base, -1 if added
+	Head      int           `json:"head"` // Track index in head, -1 if removed
+	Unchanged []DiffNote    `json:"unchanged"`
+	Added     []DiffNote    `json:"added"`
+	Removed   []DiffNote    `json:"removed"`
+	Moved     []NoteMove    `json:"moved"`
+	Programs  []ProgramDiff `json:"programs"`
+}
+
+// DiffNote is a note with its timing in seconds.
+type DiffNote struct {
+	Note
+	Time float64 `json:"time"` // Seconds
+	End  float64 `json:"end"`  // Seconds
+}
+
+// NoteMove is a note moved in time, transposed or otherwise edited, e.g. its
+// velocity changed.
+type NoteMove struct {
+	From DiffNote `json:"from"`
+	To   DiffNote `json:"to"`
+}
+
+type ProgramDiff struct {
+	Tick    int      `json:"tick"`
+	Channel int      `json:"channel"`
+	From    *Program `json:"from"` // nil if added
+	To      *Program `json:"to"`   // nil if removed
+}
+
+type Program struct {
+	Number int    `json:"number"` // 0-127
+	Name   string `json:"name"`   // General MIDI name
+}
+
+type TempoDiff struct {
+	Tick int      `json:"tick"`
+	Time float64  `json:"time"` // Seconds, in head, or base if removed
+	From *float64 `json:"from"` // BPM, nil if added
+	To   *float64 `json:"to"`   // BPM, nil if removed
+}
+
+type TimeSignatureDiff struct {
+	Tick int     `json:"tick"`
+	From *string `json:"from"` // e.g. "3/4", nil if added
+	To   *string `json:"to"`   // nil if removed
+}
+
+// Compare compares head sequence to base. Either may be nil, meaning an empty
+// sequence, e.g. if the file was added.
+//
+// Notes, which are identical in both, are unchanged. Remaining notes are
+// paired as moved if they are of the same key and channel and are at most a
+// bar of 4/4 (or 2 seconds) apart, or if they were transposed keeping their
+// timing. Notes left unpaired are added or removed.
+func Compare(base, head *Sequence) *Diff {
+	switch {
+	case base == nil && head == nil:
+		base, head = &Sequence{TicksPerQuarter: 480}, &Sequence{TicksPerQuarter: 480}
+	case base == nil:
+		base = &Sequence{TicksPerQuarter: head.TicksPerQuarter, TicksPerSecond: head.TicksPerSecond}
+	case head == nil:
+		head = &Sequence{TicksPerQuarter: base.TicksPerQuarter, TicksPerSecond: base.TicksPerSecond}
+	}
+	if base.TicksPerQuarter > 0 && head.TicksPerQuarter > 0 && base.TicksPerQuarter != head.TicksPerQuarter {
+		base = base.rescale(head.TicksPerQuarter)
+	}
+	bm, hm := base.TempoMap(), head.TempoMap()
+
+	d := &Diff{
+		TicksPerQuarter: head.TicksPerQuarter,
+		TicksPerSecond:  head.TicksPerSecond,
+		Length:          head.Length,
+		Tracks:          make([]TrackDiff, 0),
+		Tempos:          compareTempos(base, head, bm, hm),
+		TimeSignatures:  compareTimeSignatures(base, head),
+	}
+	if base.Length > d.Length {
+		d.Length = base.Length
+	}
+	window := 4 * head.TicksPerQuarter
+	if window == 0 {
+		window = 2 * head.TicksPerSecond
+	}
+
+	for _, m := range matchTracks(base.Tracks, head.Tracks) {
+		td := TrackDiff{
+			Base:      m[0],
+			Head:      m[1],
+			Unchanged: make([]DiffNote, 0),
+			Added:     make([]DiffNote, 0),
+			Removed:   make([]DiffNote, 0),
+			Moved:     make([]NoteMove, 0),
+		}
+		var b, h Track
+		if m[0] >= 0 {
+			b = base.Tracks[m[0]]
+			td.Name = b.Name
+		}
+		if m[1] >= 0 {
+			h = head.Tracks[m[1]]
+			td.Name = h.Name
+		}
+		compareNotes(&td, bm, hm, b.Notes, h.Notes, window)
+		td.Programs = comparePrograms(b.Programs, h.Programs)
+
+		switch {
+		case m[0] < 0:
+			td.Status = StatusAdded
+		case m[1] < 0:
+			td.Status = StatusRemoved
+		case b.Name != h.Name || len(td.Added) > 0 || len(td.Removed) > 0 || len(td.Moved) > 0 || len(td.Programs) > 0:
+			td.Status = StatusModified
+		default:
+			td.Status = StatusUnchanged
+		}
+		d.Tracks = append(d.Tracks, td)
+	}
+	return d
+}
+
+// rescale returns a copy of the sequence with ticks converted to another
+// number of ticks per quarter note.
+func (s *Sequence) rescale(tpq int) *Sequence {
+	conv := func(tick int) int {
+		return (tick*tpq + s.TicksPerQuarter/2) / s.TicksPerQuarter
+	}
+	r := &Sequence{
+		Format:          s.Format,
+		TicksPerQuarter: tpq,
+		Tracks:          make([]Track, len(s.Tracks)),
+		Tempos:          make([]Tempo, len(s.Tempos)),
+		TimeSignatures:  make([]TimeSignature, len(s.TimeSignatures)),
+		KeySignatures:   make([]KeySignature, len(s.KeySignatures)),
+		Length:          conv(s.Length),
+	}
+	for i, t := range s.Tracks {
+		rt := Track{
+			Name:       t.Name,
+			Instrument: t.Instrument,
+			Notes:      make([]Note, len(t.Notes)),
+			Programs:   make([]ProgramChange, len(t.Programs)),
+			Length:     conv(t.Length),
+		}
+		for j, n := range t.Notes {
+			end := conv(n.Tick + n.Duration)
+			n.Tick = conv(n.Tick)
+			n.Duration = end - n.Tick
+			rt.Notes[j] = n
+		}
+		for j, p := range t.Programs {
+			p.Tick = conv(p.Tick)
+			rt.Programs[j] = p
+		}
+		r.Tracks[i] = rt
+	}
+	for i, t := range s.Tempos {
+		t.Tick = conv(t.Tick)
+		r.Tempos[i] = t
+	}
+	for i, t := range s.TimeSignatures {
+		t.Tick = conv(t.Tick)
+		r.TimeSignatures[i] = t
+	}
+	for i, k := range s.KeySignatures {
+		k.Tick = conv(k.Tick)
+		r.KeySignatures[i] = k
+	}
+	return r
+}
+
+// matchTracks pairs indices of base and head tracks. Unmatched tracks are
+// paired with -1. Pairs are in head's order, followed by removed tracks.
+func matchTracks(base, head []Track) [][2]int {
+	headMatch := make([]int, len(head))
+	baseUsed := make([]bool, len(base))
+	for j := range headMatch {
+		headMatch[j] = -1
+	}
+	for j, h := range head {
+		if h.Name == "" {
+			continue
+		}
+		for i, b := range base {
+			if !baseUsed[i] && b.Name == h.Name {
+				headMatch[j], baseUsed[i] = i, true
+				break
+			}
+		}
+	}
+	for j := range head {
+		if headMatch[j] < 0 && j < len(base) && !baseUsed[j] {
+			headMatch[j], baseUsed[j] = j, true
+		}
+	}
+
+	pairs := make([][2]int, 0, len(head))
+	for j, i := range headMatch {
+		pairs = append(pairs, [2]int{i, j})
+	}
+	for i, used := range baseUsed {
+		if !used {
+			pairs = append(pairs, [2]int{i, -1})
+		}
+	}
+	return pairs
+}
+
+func compareNotes(td *TrackDiff, base, head *TempoMap, b, h []Note, window int) {
+	note := func(tm *TempoMap, n Note) DiffNote {
+		return DiffNote{
+			Note: n,
+			Time: tm.Duration(n.Tick).Seconds(),
+			End:  tm.Duration(n.Tick + n.Duration).Seconds(),
+		}
+	}
+
+	inHead := make(map[Note]int, len(h))
+	for _, n := range h {
+		inHead[n]++
+	}
+	matched := make(map[Note]int)
+	var removed, added []Note
+	for _, n := range b {
+		if inHead[n] > 0 {
+			inHead[n]--
+			matched[n]++
+			td.Unchanged = append(td.Unchanged, note(head, n))
+		} else {
+			removed = append(removed, n)
+		}
+	}
+	for _, n := range h {
+		if matched[n] > 0 {
+			matched[n]--
+		} else {
+			added = append(added, n)
+		}
+	}
+
+	ix := newNoteIndex(added)
+	for _, r := range removed {
+		best := ix.nearest(r, window)
+		if best < 0 {
+			best = ix.transposed(r)
+		}
+		if best < 0 {
+			td.Removed = append(td.Removed, note(base, r))
+			continue
+		}
+		ix.use(best)
+		td.Moved = append(td.Moved, NoteMove{From: note(base, r), To: note(head, added[best])})
+	}
+	for i, a := range added {
+		if !ix.used[i] {
+			td.Added = append(td.Added, note(head, a))
+		}
+	}
+}
+
+// noteIndex finds unused notes to pair removed notes with, without scanning
+// all of them for each removed note.
+type noteIndex struct {
+	notes []Note
+	used  []bool
+	byKey map[[2]int]*tickIndex // by channel and key
+	pos   []int                 // Of each note in its tickIndex
+
+	byTick map[[3]int][]int // by channel, tick and duration, in notes' order
+}
+
+// tickIndex is notes of a channel and key, ordered by tick. Unused neighbours
+// are found via next and prev, which link positions of used notes onwards,
+// with path compression. prev is offset by one, so that 0 means none.
+type tickIndex struct {
+	notes      []int
+	next, prev []int
+}
+
+func newNoteIndex(notes []Note) *noteIndex {
+	ix := &noteIndex{
+		notes:  notes,
+		used:   make([]bool, len(notes)),
+		byKey:  make(map[[2]int]*tickIndex),
+		pos:    make([]int, len(notes)),
+		byTick: make(map[[3]int][]int),
+	}
+	for i, n := range notes {
+		k := [2]int{n.Channel, n.Key}
+		t := ix.byKey[k]
+		if t == nil {
+			t = new(tickIndex)
+			ix.byKey[k] = t
+		}
+		t.notes = append(t.notes, i)
+		tk := [3]int{n.Channel, n.Tick, n.Duration}
+		ix.byTick[tk] = append(ix.byTick[tk], i)
+	}
+	for _, t := range ix.byKey {
+		sort.SliceStable(t.notes, func(i, j int) bool { return notes[t.notes[i]].Tick < notes[t.notes[j]].Tick })
+		t.next = make([]int, len(t.notes)+1)
+		t.prev = make([]int, len(t.notes)+1)
+		for p, i := range t.notes {
+			ix.pos[i] = p
+		}
+		for p := range t.next {
+			t.next[p] = p
+			t.prev[p] = p
+		}
+	}
+	return ix
+}
+
+// nearest returns the unused note of the same channel and key closest to r,
+// at most window ticks away, preferring the earlier one. Returns -1 if there's
+// none.
+func (ix *noteIndex) nearest(r Note, window int) int {
+	t := ix.byKey[[2]int{r.Channel, r.Key}]
+	if t == nil {
+		return -1
+	}
+	p := sort.Search(len(t.notes), func(i int) bool { return ix.notes[t.notes[i]].Tick >= r.Tick })
+	best := -1
+	if q := find(t.prev, p) - 1; q >= 0 {
+		if i := t.notes[q]; abs(ix.notes[i].Tick-r.Tick) <= window {
+			best = i
+		}
+	}
+	if q := find(t.next, p); q < len(t.notes) {
+		i := t.notes[q]
+		if dist := abs(ix.notes[i].Tick - r.Tick); dist <= window && (best < 0 || dist < abs(ix.notes[best].Tick-r.Tick)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// transposed returns the first unused note of the same channel, tick and
+// duration as r, or -1 if there's none.
+func (ix *noteIndex) transposed(r Note) int {
+	tk := [3]int{r.Channel, r.Tick, r.Duration}
+	notes := ix.byTick[tk]
+	for len(notes) > 0 && ix.used[notes[0]] {
+		notes = notes[1:]
+	}
+	ix.byTick[tk] = notes
+	if len(notes) == 0 {
+		return -1
+	}
+	return notes[0]
+}
+
+func (ix *noteIndex) use(i int) {
+	ix.used[i] = true
+	n := ix.notes[i]
+	t := ix.byKey[[2]int{n.Channel, n.Key}]
+	p := ix.pos[i]
+	t.next[p] = p + 1
+	t.prev[p+1] = p
+}
+
+// find follows links from p to the position linking to itself.
+func find(links []int, p int) int {
+	for links[p] != p {
+		links[p] = links[links[p]]
+		p = links[p]
+	}
+	return p
+}
+
+// comparePrograms compares program changes by their tick and channel.
+func comparePrograms(base, head []ProgramChange) []ProgramDiff {
+	type key struct{ tick, channel int }
+	programs := func(pcs []ProgramChange) map[key]*Program {
+		m := make(map[key]*Program, len(pcs))
+		for _, pc := range pcs {
+			m[key{pc.Tick, pc.Channel}] = &Program{Number: pc.Program, Name: ProgramName(pc.Channel, pc.Program)}
+		}
+		return m
+	}
+	b, h := programs(base), programs(head)
+
+	diffs := make([]ProgramDiff, 0)
+	for k, from := range b {
+		if to := h[k]; to == nil || to.Number != from.Number {
+			diffs = append(diffs, ProgramDiff{Tick: k.tick, Channel: k.channel, From: from, To: to})
+		}
+	}
+	for k, to := range h {
+		if b[k] == nil {
+			diffs = append(diffs, ProgramDiff{Tick: k.tick, Channel: k.channel, To: to})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		return a.Tick < b.Tick || a.Tick == b.Tick && a.Channel < b.Channel
+	})
+	return diffs
+}
+
+// compareTempos compares tempo maps. Sequences without a tempo at tick 0 start
+// at the default tempo. bm and hm are tempo maps of base and head.
+func compareTempos(base, head *Sequence, bm, hm *TempoMap) []TempoDiff {
+	tempos := func(s *Sequence) map[int]int {
+		m := map[int]int{0: DefaultTempo}
+		for _, t := range s.Tempos {
+			m[t.Tick] = t.MicrosPerQuarter
+		}
+		return m
+	}
+	b, h := tempos(base), tempos(head)
+	set := make(map[int]bool)
+	for tick := range b {
+		set[tick] = true
+	}
+	for tick := range h {
+		set[tick] = true
+	}
+
+	diffs := make([]TempoDiff, 0)
+	for _, tick := range sortedTicks(set) {
+		from, inBase := b[tick]
+		to, inHead := h[tick]
+		if inBase && inHead && from == to {
+			continue
+		}
+		d := TempoDiff{Tick: tick}
+		if inBase {
+			bpm := Tempo{MicrosPerQuarter: from}.BPM()
+			d.From = &bpm
+			d.Time = bm.Duration(tick).Seconds()
+		}
+		if inHead {
+			bpm := Tempo{MicrosPerQuarter: to}.BPM()
+			d.To = &bpm
+			d.Time = hm.Duration(tick).Seconds()
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// compareTimeSignatures compares time signatures. Sequences without a time
+// signature at tick 0 start in 4/4.
+func compareTimeSignatures(base, head *Sequence) []TimeSignatureDiff {
+	signatures := func(s *Sequence) map[int]string {
+		m := map[int]string{0: "4/4"}
+		for _, t := range s.TimeSignatures {
+			m[t.Tick] = strconv.Itoa(t.Numerator) + "/" + strconv.Itoa(t.Denominator)
+		}
+		return m
+	}
+	b, h := signatures(base), signatures(head)
+	set := make(map[int]bool)
+	for tick := range b {
+		set[tick] = true
+	}
+	for tick := range h {
+		set[tick] = true
+	}
+
+	diffs := make([]TimeSignatureDiff, 0)
+	for _, tick := range sortedTicks(set) {
+		from, inBase := b[tick]
+		to, inHead := h[tick]
+		if inBase && inHead && from == to {
+			continue
+		}
+		d := TimeSignatureDiff{Tick: tick}
+		if inBase {
+			d.From = &from
+		}
+		if inHead {
+			d.To = &to
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// sortedTicks returns ticks of the set in ascending order.
+func sortedTicks(set map[int]bool) []int {
+	ticks := make([]int, 0, len(set))
+	for tick := range set {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+	return ticks
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
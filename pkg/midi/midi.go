@@ -0,0 +1,380 @@
+// Package midi parses Standard MIDI Files of format 0 and 1 (and 2, whose
+// tracks are read as independent sequences).
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultTempo is the tempo in microseconds per quarter note until the first
+// tempo event, 120 BPM.
+const DefaultTempo = 500000
+
+// MaxEvents is the most events of all tracks Parse reads, well above real
+// files, so that crafted ones cannot make it use excessive time and memory.
+const MaxEvents = 1 << 20
+
+// Sequence is a parsed MIDI file.
+type Sequence struct {
+	Format          int
+	TicksPerQuarter int // 0 if time division is SMPTE based
+	TicksPerSecond  int // Set if time division is SMPTE based
+	Tracks          []Track
+	Tempos          []Tempo         // Ordered by tick, from all tracks
+	TimeSignatures  []TimeSignature // Ordered by tick, from all tracks
+	KeySignatures   []KeySignature  // Ordered by tick, from all tracks
+	Length          int             // Ticks, end of the longest track
+}
+
+type Track struct {
+	Name       string
+	Instrument string // Instrument name meta event
+	Notes      []Note // Ordered by tick, key
+	Programs   []ProgramChange
+	Length     int // Ticks
+}
+
+type Note struct {
+	Tick     int `json:"tick"`
+	Duration int `json:"duration"` // Ticks
+	Channel  int `json:"channel"`  // 0-15
+	Key      int `json:"key"`      // 0-127, 60 is middle C
+	Velocity int `json:"velocity"`
+}
+
+type ProgramChange struct {
+	Tick    int
+	Channel int
+	Program int // 0-127, General MIDI program number - 1
+}
+
+type Tempo struct {
+	Tick             int
+	MicrosPerQuarter int
+}
+
+// BPM returns tempo in quarter notes per minute.
+func (t Tempo) BPM() float64 {
+	return 60e6 / float64(t.MicrosPerQuarter)
+}
+
+type TimeSignature struct {
+	Tick        int
+	Numerator   int
+	Denominator int
+}
+
+type KeySignature struct {
+	Tick  int
+	Sharp int // Sharps if positive, flats if negative
+	Minor bool
+}
+
+// Name returns the key's name, e.g. "F# minor".
+func (k KeySignature) Name() string {
+	major := [...]string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	minor := [...]string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+	if k.Sharp < -7 || k.Sharp > 7 {
+		return ""
+	}
+	if k.Minor {
+		return minor[k.Sharp+7] + " minor"
+	}
+	return major[k.Sharp+7] + " major"
+}
+
+// IsMIDI reports whether data looks like a Standard MIDI File.
+func IsMIDI(data []byte) bool {
+	return len(data) >= 14 && bytes.Equal(data[:4], []byte("MThd"))
+}
+
+// Parse parses Standard MIDI File.
+func Parse(data []byte) (*Sequence, error) {
+	if !IsMIDI(data) {
+		return nil, errors.New("midi: not a standard midi file")
+	}
+	headerLen := int(binary.BigEndian.Uint32(data[4:]))
+	if headerLen < 6 || 8+headerLen > len(data) {
+		return nil, errors.New("midi: invalid header")
+	}
+
+	s := &Sequence{Format: int(binary.BigEndian.Uint16(data[8:]))}
+	if s.Format > 2 {
+		return nil, fmt.Errorf("midi: unsupported format %d", s.Format)
+	}
+	tracks := int(binary.BigEndian.Uint16(data[10:]))
+	division := binary.BigEndian.Uint16(data[12:])
+	if division&0x8000 != 0 {
+		fps := -int(int8(division >> 8))
+		if fps == 29 {
+			fps = 30 // drop frame timecode runs at 29.97
+		}
+		s.TicksPerSecond = fps * int(division&0xff)
+	} else {
+		s.TicksPerQuarter = int(division)
+	}
+	if s.TicksPerQuarter == 0 && s.TicksPerSecond <= 0 {
+		return nil, errors.New("midi: invalid time division")
+	}
+
+	off := 8 + headerLen
+	events := MaxEvents
+	s.Tracks = make([]Track, 0, tracks)
+	for off+8 <= len(data) {
+		id := string(data[off : off+4])
+		size := int(binary.BigEndian.Uint32(data[off+4:]))
+		off += 8
+		if size < 0 || off+size > len(data) {
+			size = len(data) - off // truncated file, read what's there
+		}
+		if id == "MTrk" {
+			t, err := s.parseTrack(data[off:off+size], &events)
+			if err != nil {
+				return nil, fmt.Errorf("midi: track %d: %w", len(s.Tracks), err)
+			}
+			s.Tracks = append(s.Tracks, *t)
+			if t.Length > s.Length {
+				s.Length = t.Length
+			}
+		}
+		off += size
+	}
+
+	sort.SliceStable(s.Tempos, func(i, j int) bool { return s.Tempos[i].Tick < s.Tempos[j].Tick })
+	sort.SliceStable(s.TimeSignatures, func(i, j int) bool { return s.TimeSignatures[i].Tick < s.TimeSignatures[j].Tick })
+	sort.SliceStable(s.KeySignatures, func(i, j int) bool { return s.KeySignatures[i].Tick < s.KeySignatures[j].Tick })
+	return s, nil
+}
+
+// parseTrack parses track's events, at most as many as left in events. Global
+// meta events, such as tempo, are added to s.
+func (s *Sequence) parseTrack(data []byte, events *int) (*Track, error) {
+	var (
+		t       = &Track{Notes: make([]Note, 0), Programs: make([]ProgramChange, 0)}
+		r       = reader{data: data}
+		tick    int
+		running byte
+		playing = make(map[int][]int) // Indices of sounding notes by channel<<8|key
+	)
+
+	for r.pos < len(data) {
+		tick += r.varint()
+		status := r.byte()
+		if r.err != nil {
+			break // truncated, keep what was read
+		}
+		if *events--; *events < 0 {
+			return nil, fmt.Errorf("too many events, max %d", MaxEvents)
+		}
+		if status < 0x80 { // running status
+			if running == 0 {
+				return nil, errors.New("data byte without status")
+			}
+			status = running
+			r.pos--
+		}
+
+		switch {
+		case status < 0xf0:
+			running = status
+			ch := int(status & 0x0f)
+			switch status & 0xf0 {
+			case 0x80, 0x90:
+				key, vel := int(r.byte()), int(r.byte())
+				k := ch<<8 | key
+				if status&0xf0 == 0x90 && vel > 0 {
+					playing[k] = append(playing[k], len(t.Notes))
+					t.Notes = append(t.Notes, Note{Tick: tick, Channel: ch, Key: key, Velocity: vel})
+				} else if on := playing[k]; len(on) > 0 {
+					t.Notes[on[0]].Duration = tick - t.Notes[on[0]].Tick
+					playing[k] = on[1:]
+				}
+			case 0xc0:
+				t.Programs = append(t.Programs, ProgramChange{Tick: tick, Channel: ch, Program: int(r.byte())})
+			case 0xd0:
+				r.byte()
+			default: // 0xa0, 0xb0, 0xe0
+				r.byte()
+				r.byte()
+			}
+
+		case status == 0xf0 || status == 0xf7: // sysex
+			running = 0
+			r.skip(r.varint())
+
+		case status == 0xff: // meta
+			running = 0
+			typ := r.byte()
+			body := r.bytes(r.varint())
+			if r.err != nil {
+				break
+			}
+			if err := s.meta(t, tick, typ, body); err != nil {
+				return nil, err
+			}
+			if typ == 0x2f { // end of track
+				r.pos = len(data)
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid status byte 0x%02x", status)
+		}
+
+		if r.err != nil {
+			break // truncated, keep what was read
+		}
+	}
+
+	// Notes left sounding end with the track.
+	for _, on := range playing {
+		for _, i := range on {
+			t.Notes[i].Duration = tick - t.Notes[i].Tick
+		}
+	}
+	t.Length = tick
+	sort.SliceStable(t.Notes, func(i, j int) bool {
+		a, b := t.Notes[i], t.Notes[j]
+		return a.Tick < b.Tick || a.Tick == b.Tick && a.Key < b.Key
+	})
+	return t, nil
+}
+
+func (s *Sequence) meta(t *Track, tick int, typ byte, body []byte) error {
+	switch typ {
+	case 0x03:
+		t.Name = string(body)
+	case 0x04:
+		t.Instrument = string(body)
+	case 0x51:
+		if len(body) != 3 {
+			return errors.New("invalid tempo event")
+		}
+		tempo := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+		if tempo > 0 {
+			s.Tempos = append(s.Tempos, Tempo{Tick: tick, MicrosPerQuarter: tempo})
+		}
+	case 0x58:
+		if len(body) < 2 || body[1] > 30 {
+			return errors.New("invalid time signature event")
+		}
+		s.TimeSignatures = append(s.TimeSignatures, TimeSignature{
+			Tick:        tick,
+			Numerator:   int(body[0]),
+			Denominator: 1 << body[1],
+		})
+	case 0x59:
+		if len(body) != 2 {
+			return errors.New("invalid key signature event")
+		}
+		s.KeySignatures = append(s.KeySignatures, KeySignature{
+			Tick:  tick,
+			Sharp: int(int8(body[0])),
+			Minor: body[1] == 1,
+		})
+	}
+	return nil
+}
+
+// Duration converts tick to time from the start, following the tempo map.
+// Use TempoMap to convert many ticks.
+func (s *Sequence) Duration(tick int) time.Duration {
+	return s.TempoMap().Duration(tick)
+}
+
+// TempoMap converts ticks to time in O(log n) of tempo changes. It does not
+// follow changes to the sequence made after it was built.
+type TempoMap struct {
+	ticksPerQuarter int
+	ticksPerSecond  int
+	points          []tempoPoint
+}
+
+// tempoPoint is a tempo change with the time it happens at.
+type tempoPoint struct {
+	tick   int
+	micros float64 // From the start
+	tempo  int     // Microseconds per quarter note
+}
+
+// TempoMap builds the tempo map of the sequence.
+func (s *Sequence) TempoMap() *TempoMap {
+	m := &TempoMap{ticksPerQuarter: s.TicksPerQuarter, ticksPerSecond: s.TicksPerSecond}
+	if s.TicksPerQuarter == 0 {
+		return m
+	}
+	m.points = make([]tempoPoint, 0, len(s.Tempos)+1)
+	prev := tempoPoint{tempo: DefaultTempo}
+	m.points = append(m.points, prev)
+	for _, t := range s.Tempos {
+		prev = tempoPoint{
+			tick:   t.Tick,
+			micros: prev.micros + float64(t.Tick-prev.tick)*float64(prev.tempo)/float64(s.TicksPerQuarter),
+			tempo:  t.MicrosPerQuarter,
+		}
+		m.points = append(m.points, prev)
+	}
+	return m
+}
+
+// Duration converts tick to time from the start.
+func (m *TempoMap) Duration(tick int) time.Duration {
+	if m.ticksPerQuarter == 0 {
+		return time.Duration(float64(tick) / float64(m.ticksPerSecond) * float64(time.Second))
+	}
+	// Last tempo change before tick, the default tempo if there's none.
+	i := sort.Search(len(m.points)-1, func(i int) bool { return m.points[i+1].tick >= tick })
+	p := m.points[i]
+	micros := p.micros + float64(tick-p.tick)*float64(p.tempo)/float64(m.ticksPerQuarter)
+	return time.Duration(micros * float64(time.Microsecond))
+}
+
+// reader reads track data. Reading past the end sets err and yields zeros.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = errors.New("unexpected end of track")
+		r.pos++
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errors.New("unexpected end of track")
+		r.pos = len(r.data)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+// varint reads variable-length quantity of at most 4 bytes.
+func (r *reader) varint() int {
+	v := 0
+	for i := 0; i < 4; i++ {
+		b := r.byte()
+		v = v<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
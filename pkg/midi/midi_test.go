@@ -0,0 +1,260 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func smf(format, division int, tracks ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("MThd\x00\x00\x00\x06")
+	_ = binary.Write(&buf, binary.BigEndian, []uint16{uint16(format), uint16(len(tracks)), uint16(division)})
+	for _, t := range tracks {
+		buf.WriteString("MTrk")
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(t)))
+		buf.Write(t)
+	}
+	return buf.Bytes()
+}
+
+// Events are written with delta times as single byte or two byte varints.
+const endOfTrack = "\x00\xff\x2f\x00"
+
+func TestParse(t *testing.T) {
+	conductor := []byte("" +
+		"\x00\xff\x51\x03\x07\xa1\x20" + // 120 BPM
+		"\x00\xff\x58\x04\x03\x02\x18\x08" + // 3/4
+		"\x00\xff\x59\x02\xfd\x01" + // 3 flats, minor: C minor
+		"\x83\x60\xff\x51\x03\x0f\x42\x40" + // at 480: 60 BPM
+		endOfTrack)
+	piano := []byte("" +
+		"\x00\xff\x03\x05Piano" +
+		"\x00\xc0\x00" + // program: Acoustic Grand Piano
+		"\x00\x90\x3c\x64" + // C4 on
+		"\x00\x40\x50" + // E4 on, running status
+		"\x83\x60\x80\x3c\x00" + // at 480: C4 off
+		"\x00\x90\x40\x00" + // E4 off, by zero velocity
+		"\x00\x90\x43\x64" + // G4 on, never off
+		"\x83\x60\xff\x2f\x00") // at 960: end
+	drums := []byte("" +
+		"\x00\xff\x03\x05Drums" +
+		"\x00\xff\x04\x03Kit" +
+		"\x00\xf0\x03\x01\x02\xf7" + // sysex
+		"\x00\x99\x24\x7f" + // kick on channel 10
+		"\x60\x89\x24\x00" + // at 96: off
+		endOfTrack)
+
+	s, err := Parse(smf(1, 480, conductor, piano, drums))
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Format)
+	assert.Equal(t, 480, s.TicksPerQuarter)
+	require.Len(t, s.Tracks, 3)
+	assert.Equal(t, []Tempo{{0, 500000}, {480, 1000000}}, s.Tempos)
+	assert.Equal(t, []TimeSignature{{0, 3, 4}}, s.TimeSignatures)
+	assert.Equal(t, []KeySignature{{0, -3, true}}, s.KeySignatures)
+	assert.Equal(t, 960, s.Length)
+
+	p := s.Tracks[1]
+	assert.Equal(t, "Piano", p.Name)
+	assert.Equal(t, []ProgramChange{{0, 0, 0}}, p.Programs)
+	assert.Equal(t, []Note{
+		{Tick: 0, Duration: 480, Channel: 0, Key: 60, Velocity: 100},
+		{Tick: 0, Duration: 480, Channel: 0, Key: 64, Velocity: 80},
+		{Tick: 480, Duration: 480, Channel: 0, Key: 67, Velocity: 100},
+	}, p.Notes)
+
+	// 480 ticks at 120 BPM, then 480 at 60 BPM
+	assert.Equal(t, 1500*time.Millisecond, s.Duration(960))
+
+	sum := s.Summary()
+	assert.Equal(t, 4, sum.Notes)
+	assert.Equal(t, 1.5, sum.Duration)
+	assert.Equal(t, []TempoSummary{{0, 0, 120}, {480, 0.5, 60}}, sum.Tempos)
+	assert.Equal(t, []KeySignatureSummary{{0, "C minor"}}, sum.KeySignatures)
+	assert.Equal(t, TrackSummary{
+		Name:       "Piano",
+		Instrument: "Acoustic Grand Piano",
+		Programs:   []string{"Acoustic Grand Piano"},
+		Channels:   []int{0},
+		Notes:      3,
+		Length:     960,
+	}, sum.Tracks[1])
+	assert.Equal(t, "Kit", sum.Tracks[2].Instrument)
+	assert.Equal(t, []int{9}, sum.Tracks[2].Channels)
+}
+
+func TestParseSMPTE(t *testing.T) {
+	// 25 fps, 40 ticks per frame: 1000 ticks per second
+	s, err := Parse(smf(0, 0xe728, []byte("\x87\x68\xff\x2f\x00")))
+	require.NoError(t, err)
+	assert.Equal(t, 0, s.TicksPerQuarter)
+	assert.Equal(t, 1000, s.TicksPerSecond)
+	assert.Equal(t, time.Second, s.Duration(s.Length))
+}
+
+func TestParseTruncated(t *testing.T) {
+	track := []byte("\x00\x90\x3c\x64\x83\x60\x80\x3c")
+	data := smf(0, 96, track)
+	s, err := Parse(data[:len(data)-1])
+	require.NoError(t, err)
+	require.Len(t, s.Tracks, 1)
+	assert.Len(t, s.Tracks[0].Notes, 1)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte("RIFF"))
+	assert.Error(t, err)
+	_, err = Parse(smf(3, 96))
+	assert.Error(t, err)
+	_, err = Parse(smf(0, 96, []byte("\x00\x3c\x64"))) // data without status
+	assert.Error(t, err)
+}
+
+func TestParseTooManyEvents(t *testing.T) {
+	track := bytes.Repeat([]byte("\x00\xd0\x00"), MaxEvents+1) // channel pressure
+	_, err := Parse(smf(0, 96, track))
+	assert.Error(t, err)
+}
+
+func TestTempoMap(t *testing.T) {
+	s := &Sequence{TicksPerQuarter: 96}
+	for i := 1; i <= 100000; i++ {
+		s.Tempos = append(s.Tempos, Tempo{Tick: 96 * i, MicrosPerQuarter: 250000 + i%2*250000})
+	}
+	tm := s.TempoMap()
+	assert.Equal(t, time.Duration(0), tm.Duration(0))
+	assert.Equal(t, 500*time.Millisecond, tm.Duration(96))     // default tempo
+	assert.Equal(t, 1000*time.Millisecond, tm.Duration(192))   // 120 BPM
+	assert.Equal(t, 1125*time.Millisecond, tm.Duration(240))   // 240 BPM from tick 192
+	assert.Equal(t, tm.Duration(96*5000), s.Duration(96*5000)) // same as without the map
+
+	sum := s.Summary() // one conversion per tempo event
+	require.Len(t, sum.Tempos, 100000)
+	assert.Equal(t, 1.0, sum.Tempos[1].Time)
+}
+
+func TestKeyName(t *testing.T) {
+	assert.Equal(t, "C major", KeySignature{Sharp: 0}.Name())
+	assert.Equal(t, "F# minor", KeySignature{Sharp: 3, Minor: true}.Name())
+	assert.Equal(t, "Cb major", KeySignature{Sharp: -7}.Name())
+	assert.Equal(t, "", KeySignature{Sharp: 8}.Name())
+}
+
+func TestCompare(t *testing.T) {
+	base := &Sequence{
+		TicksPerQuarter: 96,
+		Tracks: []Track{
+			{Name: "Lead", Notes: []Note{
+				{Tick: 0, Duration: 96, Key: 60, Velocity: 100},   // unchanged
+				{Tick: 96, Duration: 96, Key: 62, Velocity: 100},  // moved by a beat
+				{Tick: 192, Duration: 96, Key: 64, Velocity: 100}, // transposed
+				{Tick: 288, Duration: 96, Key: 65, Velocity: 100}, // removed
+			}},
+			{Name: "Pad", Programs: []ProgramChange{{Program: 88}}},
+		},
+		Length: 384,
+	}
+	head := &Sequence{
+		TicksPerQuarter: 192, // base is rescaled
+		Tracks: []Track{
+			{Name: "Bass", Programs: []ProgramChange{{Program: 33}}},
+			{Name: "Lead", Notes: []Note{
+				{Tick: 0, Duration: 192, Key: 60, Velocity: 100},
+				{Tick: 384, Duration: 192, Key: 62, Velocity: 100},
+				{Tick: 384, Duration: 192, Key: 67, Velocity: 100},
+				{Tick: 2000, Duration: 192, Key: 62, Velocity: 100}, // added, too far to be moved
+			}, Programs: []ProgramChange{{Program: 80}}},
+		},
+		Tempos:         []Tempo{{0, 500000}, {768, 250000}},
+		TimeSignatures: []TimeSignature{{0, 3, 4}},
+		Length:         2192,
+	}
+
+	d := Compare(base, head)
+	assert.Equal(t, 192, d.TicksPerQuarter)
+	assert.Equal(t, 2192, d.Length)
+	require.Len(t, d.Tracks, 3)
+
+	bass := d.Tracks[0]
+	assert.Equal(t, StatusAdded, bass.Status)
+	assert.Equal(t, -1, bass.Base)
+	require.Len(t, bass.Programs, 1)
+	assert.Nil(t, bass.Programs[0].From)
+	assert.Equal(t, &Program{33, "Electric Bass (finger)"}, bass.Programs[0].To)
+
+	lead := d.Tracks[1]
+	assert.Equal(t, StatusModified, lead.Status)
+	assert.Equal(t, 0, lead.Base)
+	assert.Equal(t, 1, lead.Head)
+	require.Len(t, lead.Unchanged, 1)
+	assert.Equal(t, 60, lead.Unchanged[0].Key)
+	assert.Equal(t, 0.5, lead.Unchanged[0].End)
+	require.Len(t, lead.Moved, 2)
+	assert.Equal(t, Note{Tick: 192, Duration: 192, Key: 62, Velocity: 100}, lead.Moved[0].From.Note)
+	assert.Equal(t, 384, lead.Moved[0].To.Tick)
+	assert.Equal(t, 64, lead.Moved[1].From.Key)
+	assert.Equal(t, 67, lead.Moved[1].To.Key)
+	require.Len(t, lead.Removed, 1)
+	assert.Equal(t, 65, lead.Removed[0].Key)
+	assert.Equal(t, 1.5, lead.Removed[0].Time)
+	require.Len(t, lead.Added, 1)
+	assert.Equal(t, 2000, lead.Added[0].Tick)
+	require.Len(t, lead.Programs, 1)
+	assert.Equal(t, 80, lead.Programs[0].To.Number)
+
+	pad := d.Tracks[2]
+	assert.Equal(t, StatusRemoved, pad.Status)
+	assert.Equal(t, -1, pad.Head)
+	require.Len(t, pad.Programs, 1)
+	assert.Nil(t, pad.Programs[0].To)
+
+	require.Len(t, d.Tempos, 1)
+	assert.Equal(t, 768, d.Tempos[0].Tick)
+	assert.Equal(t, 2.0, d.Tempos[0].Time)
+	assert.Nil(t, d.Tempos[0].From)
+	assert.Equal(t, 240.0, *d.Tempos[0].To)
+	require.Len(t, d.TimeSignatures, 1)
+	assert.Equal(t, "4/4", *d.TimeSignatures[0].From)
+	assert.Equal(t, "3/4", *d.TimeSignatures[0].To)
+}
+
+func TestCompareAdded(t *testing.T) {
+	head := &Sequence{TicksPerQuarter: 96, Tracks: []Track{{Notes: []Note{{Duration: 96, Key: 60}}}}}
+	d := Compare(nil, head)
+	require.Len(t, d.Tracks, 1)
+	assert.Equal(t, StatusAdded, d.Tracks[0].Status)
+	assert.Len(t, d.Tracks[0].Added, 1)
+	assert.Empty(t, d.Tempos)
+	assert.Empty(t, d.TimeSignatures)
+
+	d = Compare(head, head)
+	assert.Equal(t, StatusUnchanged, d.Tracks[0].Status)
+	assert.Len(t, d.Tracks[0].Unchanged, 1)
+}
+
+func TestCompareManyNotes(t *testing.T) {
+	const n = 50000
+	base := &Sequence{TicksPerQuarter: 96, Tracks: []Track{{}}}
+	head := &Sequence{TicksPerQuarter: 96, Tracks: []Track{{}}}
+	for i := 0; i < n; i++ {
+		base.Tracks[0].Notes = append(base.Tracks[0].Notes, Note{Tick: 10 * i, Duration: 5, Key: 42})
+		head.Tracks[0].Notes = append(head.Tracks[0].Notes, Note{Tick: 10*i + 1, Duration: 5, Key: 42})
+	}
+
+	d := Compare(base, head)
+	require.Len(t, d.Tracks, 1)
+	moved := d.Tracks[0].Moved
+	require.Len(t, moved, n)
+	for _, m := range moved {
+		if !assert.Equal(t, m.From.Tick+1, m.To.Tick) {
+			break
+		}
+	}
+	assert.Empty(t, d.Tracks[0].Added)
+	assert.Empty(t, d.Tracks[0].Removed)
+}
@@ -0,0 +1,165 @@
+package midi
+
+// Summary is a compact description of a sequence, without its notes.
+type Summary struct {
+	Format          int                    `json:"format"`
+	TicksPerQuarter int                    `json:"ticksPerQuarter"` // 0 if time division is SMPTE based
+	Tracks          []TrackSummary         `json:"tracks"`
+	Tempos          []TempoSummary         `json:"tempos"`
+	TimeSignatures  []TimeSignatureSummary `json:"timeSignatures"`
+	KeySignatures   []KeySignatureSummary  `json:"keySignatures"`
+	Notes           int                    `json:"notes"`
+	Length          int                    `json:"length"`   // Ticks
+	Duration        float64                `json:"duration"` // Seconds
+}
+
+type TrackSummary struct {
+	Name       string   `json:"name"`
+	Instrument string   `json:"instrument"` // Instrument name, or General MIDI name of the first program
+	Programs   []string `json:"programs"`   // General MIDI names of distinct programs, in order of use
+	Channels   []int    `json:"channels"`   // Distinct channels of notes, 0-15
+	Notes      int      `json:"notes"`
+	Length     int      `json:"length"` // Ticks
+}
+
+type TempoSummary struct {
+	Tick int     `json:"tick"`
+	Time float64 `json:"time"` // Seconds
+	BPM  float64 `json:"bpm"`
+}
+
+type TimeSignatureSummary struct {
+	Tick        int `json:"tick"`
+	Numerator   int `json:"numerator"`
+	Denominator int `json:"denominator"`
+}
+
+type KeySignatureSummary struct {
+	Tick int    `json:"tick"`
+	Key  string `json:"key"` // e.g. "F# minor"
+}
+
+// Summary summarizes the sequence.
+func (s *Sequence) Summary() *Summary {
+	tm := s.TempoMap()
+	sum := &Summary{
+		Format:          s.Format,
+		TicksPerQuarter: s.TicksPerQuarter,
+		Tracks:          make([]TrackSummary, 0, len(s.Tracks)),
+		Tempos:          make([]TempoSummary, 0, len(s.Tempos)),
+		TimeSignatures:  make([]TimeSignatureSummary, 0, len(s.TimeSignatures)),
+		KeySignatures:   make([]KeySignatureSummary, 0, len(s.KeySignatures)),
+		Length:          s.Length,
+		Duration:        tm.Duration(s.Length).Seconds(),
+	}
+
+	for _, t := range s.Tracks {
+		ts := TrackSummary{
+			Name:       t.Name,
+			Instrument: t.Instrument,
+			Programs:   make([]string, 0),
+			Channels:   make([]int, 0),
+			Notes:      len(t.Notes),
+			Length:     t.Length,
+		}
+		seen := make(map[int]bool)
+		for _, p := range t.Programs {
+			if !seen[p.Program] {
+				seen[p.Program] = true
+				ts.Programs = append(ts.Programs, ProgramName(p.Channel, p.Program))
+			}
+		}
+		if ts.Instrument == "" && len(ts.Programs) > 0 {
+			ts.Instrument = ts.Programs[0]
+		}
+		var channels [16]bool
+		for _, n := range t.Notes {
+			channels[n.Channel] = true
+		}
+		for ch, used := range channels {
+			if used {
+				ts.Channels = append(ts.Channels, ch)
+			}
+		}
+		sum.Tracks = append(sum.Tracks, ts)
+		sum.Notes += ts.Notes
+	}
+
+	for _, t := range s.Tempos {
+		sum.Tempos = append(sum.Tempos, TempoSummary{
+			Tick: t.Tick,
+			Time: tm.Duration(t.Tick).Seconds(),
+			BPM:  t.BPM(),
+		})
+	}
+	for _, t := range s.TimeSignatures {
+		sum.TimeSignatures = append(sum.TimeSignatures, TimeSignatureSummary(t))
+	}
+	for _, k := range s.KeySignatures {
+		sum.KeySignatures = append(sum.KeySignatures, KeySignatureSummary{Tick: k.Tick, Key: k.Name()})
+	}
+	return sum
+}
+
+// ProgramName returns General MIDI name of the program. Channel 10 (9 when
+// counting from 0) is reserved for percussion.
+func ProgramName(channel, program int) string {
+	if channel == 9 {
+		return "Drum Kit"
+	}
+	if program < 0 || program >= len(gmPrograms) {
+		return ""
+	}
+	return gmPrograms[program]
+}
+
+var gmPrograms = [128]string{
+	// Piano
+	"Acoustic Grand Piano", "Bright Acoustic Piano", "Electric Grand Piano", "Honky-tonk Piano",
+	"Electric Piano 1", "Electric Piano 2", "Harpsichord", "Clavinet",
+	// Chromatic Percussion
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone",
+	"Marimba", "Xylophone", "Tubular Bells", "Dulcimer",
+	// Organ
+	"Drawbar Organ", "Percussive Organ", "Rock Organ", "Church Organ",
+	"Reed Organ", "Accordion", "Harmonica", "Tango Accordion",
+	// Guitar
+	"Acoustic Guitar (nylon)", "Acoustic Guitar (steel)", "Electric Guitar (jazz)", "Electric Guitar (clean)",
+	"Electric Guitar (muted)", "Overdriven Guitar", "Distortion Guitar", "Guitar Harmonics",
+	// Bass
+	"Acoustic Bass", "Electric Bass (finger)", "Electric Bass (pick)", "Fretless Bass",
+	"Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	// Strings
+	"Violin", "Viola", "Cello", "Contrabass",
+	"Tremolo Strings", "Pizzicato Strings", "Orchestral Harp", "Timpani",
+	// Ensemble
+	"String Ensemble 1", "String Ensemble 2", "Synth Strings 1", "Synth Strings 2",
+	"Choir Aahs", "Voice Oohs", "Synth Voice", "Orchestra Hit",
+	// Brass
+	"Trumpet", "Trombone", "Tuba", "Muted Trumpet",
+	"French Horn", "Brass Section", "Synth Brass 1", "Synth Brass 2",
+	// Reed
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax",
+	"Oboe", "English Horn", "Bassoon", "Clarinet",
+	// Pipe
+	"Piccolo", "Flute", "Recorder", "Pan Flute",
+	"Blown Bottle", "Shakuhachi", "Whistle", "Ocarina",
+	// Synth Lead
+	"Lead 1 (square)", "Lead 2 (sawtooth)", "Lead 3 (calliope)", "Lead 4 (chiff)",
+	"Lead 5 (charang)", "Lead 6 (voice)", "Lead 7 (fifths)", "Lead 8 (bass + lead)",
+	// Synth Pad
+	"Pad 1 (new age)", "Pad 2 (warm)", "Pad 3 (polysynth)", "Pad 4 (choir)",
+	"Pad 5 (bowed)", "Pad 6 (metallic)", "Pad 7 (halo)", "Pad 8 (sweep)",
+	// Synth Effects
+	"FX 1 (rain)", "FX 2 (soundtrack)", "FX 3 (crystal)", "FX 4 (atmosphere)",
+	"FX 5 (brightness)", "FX 6 (goblins)", "FX 7 (echoes)", "FX 8 (sci-fi)",
+	// Ethnic
+	"Sitar", "Banjo", "Shamisen", "Koto",
+	"Kalimba", "Bagpipe", "Fiddle", "Shanai",
+	// Percussive
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock",
+	"Taiko Drum", "Melodic Tom", "Synth Drum", "Reverse Cymbal",
+	// Sound Effects
+	"Guitar Fret Noise", "Breath Noise", "Seashore", "Bird Tweet",
+	"Telephone Ring", "Helicopter", "Applause", "Gunshot",
+}
@@ -0,0 +1,152 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "munit"
+	testClientSecret = "secret"
+	testCode         = "code123"
+	testKid          = "key1"
+)
+
+// mockProvider is a minimal OpenID provider issuing ID tokens with claims.
+type mockProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims Claims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKid,
+				"use": "sig",
+				"n":   enc.EncodeToString(key.N.Bytes()),
+				"e":   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != testClientID || secret != testClientSecret || r.PostFormValue("code") != testCode {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = testKid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	m.claims = Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.URL,
+			Subject:   "user1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		Nonce:         "nonce",
+		Email:         "linus@torvalds.com",
+		EmailVerified: true,
+	}
+	return m
+}
+
+func (m *mockProvider) provider() *Provider {
+	return New(Config{
+		Issuer:       m.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "https://munit.digital/callback",
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockProvider(t)
+	u, err := m.provider().AuthCodeURL(context.Background(), "state", "nonce")
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	q := parsed.Query()
+	assert.Equal(t, "/authorize", parsed.Path)
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, testClientID, q.Get("client_id"))
+	assert.Equal(t, "state", q.Get("state"))
+	assert.Equal(t, "nonce", q.Get("nonce"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+
+	claims, err := p.Exchange(context.Background(), testCode, "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.Subject)
+	assert.Equal(t, "linus@torvalds.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+
+	_, err = p.Exchange(context.Background(), "wrong", "nonce")
+	assert.Error(t, err)
+
+	_, err = p.Exchange(context.Background(), testCode, "other")
+	assert.ErrorIs(t, err, ErrInvalidNonce)
+}
+
+func TestExchangeInvalidClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Claims)
+	}{
+		{"audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }},
+		{"issuer", func(c *Claims) { c.Issuer = "https://evil.example" }},
+		{"expired", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+		{"no expiry", func(c *Claims) { c.ExpiresAt = nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			test.modify(&m.claims)
+			_, err := m.provider().Exchange(context.Background(), testCode, "nonce")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows at most Limit attempts per key within each Window. Safe
+// for concurrent use. Zero value is not usable, use NewRateLimiter.
+type RateLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastPrune time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int, per time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit:   limit,
+		Window:  per,
+		now:     time.Now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit.
+// If not, returns how long to wait until the next window.
+func (l *RateLimiter) Allow(key string) (retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	w, found := l.windows[key]
+	if !found || now.Sub(w.start) >= l.Window {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.Limit {
+		return w.start.Add(l.Window).Sub(now), false
+	}
+	w.count++
+	return 0, true
+}
+
+// prune removes finished windows, at most once per Window.
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.Window {
+		return
+	}
+	l.lastPrune = now
+	for k, w := range l.windows {
+		if now.Sub(w.start) >= l.Window {
+			delete(l.windows, k)
+		}
+	}
+}
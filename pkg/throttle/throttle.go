@@ -0,0 +1,164 @@
+// Package throttle limits attempts per key. Throttle delays attempts after
+// failures with an exponential backoff, eventually locking the key out
+// temporarily, while RateLimiter caps attempts per time window.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle is safe for concurrent use. Zero value is not usable, use New.
+//
+// Allow reserves an attempt, which is then either recorded as failed with Fail
+// or released with Release or Reset. Attempts in progress are limited to the
+// failures left without delay, but one is always allowed, so that concurrent
+// attempts cannot bypass the backoff.
+type Throttle struct {
+	Free         int           // Failures allowed without any delay
+	Base         time.Duration // Delay after the first failure beyond Free, doubled with each next one
+	Max          time.Duration // Backoff cap
+	LockoutAfter int           // Failures that trigger a lockout, 0 disables lockouts
+	Lockout      time.Duration // Lockout duration
+	Forget       time.Duration // Failures are forgotten after this long without new ones
+	Hold         time.Duration // Reserved attempts not failed or released in this long are released
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+}
+
+type entry struct {
+	failures int
+	last     time.Time // Last failure
+	until    time.Time // Blocked until
+	reserved int       // Attempts in progress
+	reserve  time.Time // Last reservation
+}
+
+// New returns a throttle with reasonable defaults for login attempts.
+func New() *Throttle {
+	return &Throttle{
+		Free:         3,
+		Base:         time.Second,
+		Max:          5 * time.Minute,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+		Forget:       time.Hour,
+		Hold:         time.Minute,
+
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Allow reserves an attempt for key, if it may be made now. If not, returns
+// how long to wait. A reserved attempt must be either failed or released.
+func (t *Throttle) Allow(key string) (retryAfter time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	e, found := t.entries[key]
+	if !found {
+		e = new(entry)
+		t.entries[key] = e
+	}
+	if now.Sub(e.reserve) > t.Hold {
+		e.reserved = 0
+	}
+	if now.Sub(e.last) > t.Forget {
+		e.failures = 0
+	}
+	if now.Before(e.until) {
+		return e.until.Sub(now), false
+	}
+	if e.reserved > 0 && e.failures+e.reserved >= t.Free {
+		return t.Base, false // wait for attempts in progress
+	}
+	e.reserved++
+	e.reserve = now
+	return 0, true
+}
+
+// Fail records a failed attempt for key. Returns how long further attempts are
+// blocked, and whether this failure triggered a lockout.
+func (t *Throttle) Fail(key string) (retryAfter time.Duration, lockout bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	e, found := t.entries[key]
+	if !found {
+		e = new(entry)
+		t.entries[key] = e
+	}
+	if e.reserved > 0 {
+		e.reserved--
+	}
+	if now.Sub(e.last) > t.Forget {
+		e.failures = 0
+	}
+	e.failures++
+	e.last = now
+
+	switch {
+	case t.LockoutAfter > 0 && e.failures >= t.LockoutAfter:
+		retryAfter = t.Lockout
+		lockout = e.failures == t.LockoutAfter
+		if lockout {
+			// Start over once the lockout is over
+			e.failures = 0
+		}
+	case e.failures > t.Free:
+		retryAfter = t.Base
+		for i := t.Free + 1; i < e.failures && retryAfter < t.Max; i++ {
+			retryAfter *= 2
+		}
+		if retryAfter > t.Max {
+			retryAfter = t.Max
+		}
+	}
+	if until := now.Add(retryAfter); until.After(e.until) {
+		e.until = until
+	}
+	return e.until.Sub(now), lockout
+}
+
+// Release releases an attempt for key reserved by Allow, which did not fail.
+// Failures are kept.
+func (t *Throttle) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, found := t.entries[key]; found && e.reserved > 0 {
+		e.reserved--
+	}
+}
+
+// Reset forgets failures and reserved attempts of key, usually after a
+// successful attempt.
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	delete(t.entries, key)
+	t.mu.Unlock()
+}
+
+// prune removes forgotten entries, at most once per Forget period.
+func (t *Throttle) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.Forget {
+		return
+	}
+	t.lastPrune = now
+	for k, e := range t.entries {
+		if now.Sub(e.last) > t.Forget && !now.Before(e.until) && now.Sub(e.reserve) > t.Hold {
+			delete(t.entries, k)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTest() (*Throttle, *clock) {
+	c := &clock{time.Unix(1e9, 0)}
+	t := New()
+	t.now = c.now
+	return t, c
+}
+
+func TestBackoff(t *testing.T) {
+	th, c := newTest()
+	const key = "user"
+
+	for i := 0; i < th.Free; i++ {
+		retry, lockout := th.Fail(key)
+		assert.Zero(t, retry)
+		assert.False(t, lockout)
+		_, ok := th.Allow(key)
+		assert.True(t, ok)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for _, exp := range expected {
+		retry, lockout := th.Fail(key)
+		assert.Equal(t, exp, retry)
+		assert.False(t, lockout)
+
+		retry, ok := th.Allow(key)
+		assert.False(t, ok)
+		assert.Equal(t, exp, retry)
+
+		c.advance(exp)
+		_, ok = th.Allow(key)
+		assert.True(t, ok)
+	}
+
+	_, ok := th.Allow("other")
+	assert.True(t, ok)
+}
+
+func TestMax(t *testing.T) {
+	th, _ := newTest()
+	th.LockoutAfter = 0
+	var retry time.Duration
+	for i := 0; i < 50; i++ {
+		retry, _ = th.Fail("user")
+	}
+	assert.Equal(t, th.Max, retry)
+}
+
+func TestLockout(t *testing.T) {
+	th, c := newTest()
+	const key = "user"
+
+	var lockouts int
+	for i := 0; i < th.LockoutAfter; i++ {
+		retry, lockout := th.Fail(key)
+		if lockout {
+			lockouts++
+			assert.Equal(t, th.Lockout, retry)
+			break
+		}
+		c.advance(retry)
+	}
+	assert.Equal(t, 1, lockouts)
+
+	// Lockout is not shortened by further failures
+	c.advance(th.Lockout / 3)
+	retry, lockout := th.Fail(key)
+	assert.False(t, lockout)
+	assert.Equal(t, th.Lockout-th.Lockout/3, retry)
+
+	retry, ok := th.Allow(key)
+	assert.False(t, ok)
+	assert.Equal(t, th.Lockout-th.Lockout/3, retry)
+
+	c.advance(retry)
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+}
+
+func TestReserve(t *testing.T) {
+	th, c := newTest()
+	const key = "user"
+
+	// Concurrent attempts are limited to the free failures left.
+	for i := 0; i < th.Free; i++ {
+		_, ok := th.Allow(key)
+		assert.True(t, ok)
+	}
+	retry, ok := th.Allow(key)
+	assert.False(t, ok)
+	assert.Equal(t, th.Base, retry)
+
+	th.Release(key)
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+	for i := 0; i < th.Free; i++ {
+		th.Fail(key)
+	}
+
+	// With no free failures left, one attempt at a time is allowed.
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+	_, ok = th.Allow(key)
+	assert.False(t, ok)
+	retry, _ = th.Fail(key)
+	assert.Equal(t, th.Base, retry)
+	_, ok = th.Allow(key)
+	assert.False(t, ok)
+	c.advance(retry)
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+
+	// Attempts never failed nor released are released eventually.
+	_, ok = th.Allow(key)
+	assert.False(t, ok)
+	c.advance(th.Hold + time.Second)
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+}
+
+func TestResetAndForget(t *testing.T) {
+	th, c := newTest()
+	const key = "user"
+
+	for i := 0; i <= th.Free; i++ {
+		th.Fail(key)
+	}
+	_, ok := th.Allow(key)
+	assert.False(t, ok)
+	th.Reset(key)
+	_, ok = th.Allow(key)
+	assert.True(t, ok)
+
+	for i := 0; i < th.Free; i++ {
+		th.Fail(key)
+	}
+	c.advance(th.Forget + time.Second)
+	retry, _ := th.Fail(key)
+	assert.Zero(t, retry)
+}
+
+func TestRateLimiter(t *testing.T) {
+	c := &clock{time.Unix(1e9, 0)}
+	l := NewRateLimiter(3, time.Minute)
+	l.now = c.now
+
+	for i := 0; i < 3; i++ {
+		_, ok := l.Allow("user")
+		assert.True(t, ok)
+	}
+	c.advance(20 * time.Second)
+	retry, ok := l.Allow("user")
+	assert.False(t, ok)
+	assert.Equal(t, 40*time.Second, retry)
+
+	_, ok = l.Allow("other")
+	assert.True(t, ok)
+
+	c.advance(40 * time.Second)
+	_, ok = l.Allow("user")
+	assert.True(t, ok)
+}
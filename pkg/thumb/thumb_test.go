@@ -0,0 +1,67 @@
+package thumb
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	data := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 40, 20)))
+
+	img, format, err := Decode(data, 40)
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+
+	_, _, err = Decode(data, 39)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, _, err = Decode([]byte("not an image"), 40)
+	assert.Error(t, err)
+}
+
+func TestSquare(t *testing.T) {
+	// Left half red, right half blue, wider than tall.
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 150 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	dst := Square(src, 10, color.White)
+	assert.Equal(t, image.Rect(0, 0, 10, 10), dst.Bounds())
+	// Center crop covers x 100..200: red on the left, blue on the right.
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, dst.RGBAAt(0, 5))
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, dst.RGBAAt(9, 5))
+}
+
+func TestSquareTransparent(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4)) // fully transparent
+	dst := Square(src, 2, color.White)
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, dst.RGBAAt(1, 1))
+}
+
+func TestSquareUpscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{G: 255, A: 255})
+	dst := Square(src, 8, color.Black)
+	assert.Equal(t, color.RGBA{G: 255, A: 255}, dst.RGBAAt(3, 3))
+	assert.Equal(t, color.RGBA{A: 255}, dst.RGBAAt(4, 4))
+}
@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 Appendix B, SHA1 test vectors.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, test := range rfcVectors {
+		t.Run(fmt.Sprint(test.unix), func(t *testing.T) {
+			counter := uint64(Step(time.Unix(test.unix, 0)))
+			assert.Equal(t, test.code, hotp(key, counter, 8))
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+	for _, test := range rfcVectors {
+		t.Run(fmt.Sprint(test.unix), func(t *testing.T) {
+			code, err := Code(secret, time.Unix(test.unix, 0))
+			require.NoError(t, err)
+			assert.Equal(t, test.code[len(test.code)-Digits:], code)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := Code(secret, now.Add(-Period))
+	require.NoError(t, err)
+
+	step, ok := Verify(secret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	_, ok = Verify(secret, code, now, 0)
+	assert.False(t, ok)
+	_, ok = Verify(secret, "12345", now, 1)
+	assert.False(t, ok)
+	_, ok = Verify("not base32!", code, now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("munit", "linus@torvalds.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/munit:linus@torvalds.com?algorithm=SHA1&digits=6&issuer=munit&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
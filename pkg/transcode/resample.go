@@ -0,0 +1,135 @@
+package transcode
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	zeroCrossings = 16   // Of the sinc kernel on each side, at cutoff
+	tableRes      = 256  // Kernel table entries per input frame
+	rolloff       = 0.95 // Cutoff below output Nyquist frequency, for filter's transition band
+)
+
+// Limits of resampling, as kernel's size grows with the ratio of sample rates.
+const (
+	MaxSampleRate = 768000
+	MaxDownsample = 128 // Max ratio of input to output sample rate
+)
+
+// Resampler converts sample rate of audio with windowed sinc interpolation,
+// low-pass filtering it when downsampling.
+type Resampler struct {
+	channels int
+	step     float64   // Input frames per output frame
+	width    int       // Input frames on each side of an output frame
+	kernel   []float64 // Half of the kernel, tableRes entries per input frame
+
+	in     []float64 // Input frames still needed, interleaved
+	first  int64     // Index of in's first frame
+	frames int64     // Input frames written
+	n      int64     // Output frames made
+	out    []float64
+}
+
+// NewResampler returns a resampler from sample rate from to sample rate to.
+// Rates must be within MaxSampleRate and downsampling within MaxDownsample.
+func NewResampler(from, to, channels int) (*Resampler, error) {
+	switch {
+	case from < 1 || from > MaxSampleRate || to < 1 || to > MaxSampleRate:
+		return nil, fmt.Errorf("transcode: unsupported resampling: %d Hz to %d Hz", from, to)
+	case from > to*MaxDownsample:
+		return nil, fmt.Errorf("transcode: unsupported resampling: %d Hz to %d Hz, downsampling by more than %d", from, to, MaxDownsample)
+	case channels < 1:
+		return nil, fmt.Errorf("transcode: invalid channel count: %d", channels)
+	}
+
+	cutoff := 1.0 // Relative to input Nyquist frequency
+	if to < from {
+		cutoff = rolloff * float64(to) / float64(from)
+	}
+	width := int(math.Ceil(zeroCrossings / cutoff))
+
+	// Sinc windowed by Blackman window.
+	kernel := make([]float64, width*tableRes+1)
+	for i := range kernel {
+		x := float64(i) / tableRes
+		v := cutoff
+		if i > 0 {
+			v = math.Sin(math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		t := math.Pi * x / float64(width)
+		kernel[i] = v * (0.42 + 0.5*math.Cos(t) + 0.08*math.Cos(2*t))
+	}
+
+	return &Resampler{
+		channels: channels,
+		step:     float64(from) / float64(to),
+		width:    width,
+		kernel:   kernel,
+	}, nil
+}
+
+// Write resamples whole frames of samples, interleaved by channel, and returns
+// output samples which can be made so far. Returned slice is reused by the
+// next call.
+func (r *Resampler) Write(samples []float64) []float64 {
+	r.in = append(r.in, samples[:len(samples)-len(samples)%r.channels]...)
+	r.frames += int64(len(samples) / r.channels)
+	return r.resample(false)
+}
+
+// Flush returns the remaining output samples, treating input as ended.
+func (r *Resampler) Flush() []float64 {
+	return r.resample(true)
+}
+
+func (r *Resampler) resample(flush bool) []float64 {
+	r.out = r.out[:0]
+	total := int64(math.Ceil(float64(r.frames) / r.step))
+	for r.n < total {
+		pos := float64(r.n) * r.step
+		center := int64(pos)
+		if !flush && center+int64(r.width) >= r.frames {
+			break // needs more input
+		}
+
+		start := len(r.out)
+		for c := 0; c < r.channels; c++ {
+			r.out = append(r.out, 0)
+		}
+		for k := center - int64(r.width) + 1; k <= center+int64(r.width); k++ {
+			if k < r.first || k >= r.frames {
+				continue // zero before the start and past the end
+			}
+			w := r.weight(pos - float64(k))
+			frame := r.in[int(k-r.first)*r.channels:]
+			for c := 0; c < r.channels; c++ {
+				r.out[start+c] += w * frame[c]
+			}
+		}
+		r.n++
+	}
+
+	// Drop frames before the window of the next output frame.
+	keep := int64(float64(r.n)*r.step) - int64(r.width) + 1
+	if drop := keep - r.first; drop > 0 {
+		if drop > int64(len(r.in)/r.channels) {
+			drop = int64(len(r.in) / r.channels)
+		}
+		r.in = r.in[:copy(r.in, r.in[int(drop)*r.channels:])]
+		r.first += drop
+	}
+	return r.out
+}
+
+// weight returns kernel's value at distance x from an output frame.
+func (r *Resampler) weight(x float64) float64 {
+	x = math.Abs(x) * tableRes
+	i := int(x)
+	if i >= len(r.kernel)-1 {
+		return 0
+	}
+	frac := x - float64(i)
+	return r.kernel[i] + frac*(r.kernel[i+1]-r.kernel[i])
+}
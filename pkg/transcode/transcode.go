@@ -0,0 +1,90 @@
+// Package transcode encodes decoded audio into lightweight renditions, e.g.
+// for auditioning over slow connections, downsampling and downmixing it on the
+// way.
+//
+// 16-bit WAV is built in. Encoders of compressed formats, e.g. wrapping native
+// libraries, are plugged in with Register.
+package transcode
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// Encoder encodes audio into a format.
+type Encoder interface {
+	// ContentType returns the MIME type of encoded data.
+	ContentType() string
+
+	// NewWriter starts encoding audio of given sample rate and channel count
+	// into w.
+	NewWriter(w io.Writer, rate, channels int) (SampleWriter, error)
+}
+
+// SampleWriter encodes blocks of samples, which are interleaved by channel and
+// scaled to [-1, 1]. Blocks may be reused by the caller after Write returns.
+// Close finishes encoding, but doesn't close the underlying writer.
+type SampleWriter interface {
+	Write(samples []float64) error
+	Close() error
+}
+
+var (
+	mu       sync.RWMutex
+	encoders = map[string]Encoder{"wav": WAV}
+)
+
+// Register makes encoder available under format name, replacing any encoder
+// registered under it before.
+func Register(format string, e Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	encoders[format] = e
+}
+
+// Lookup returns the encoder registered under format name.
+func Lookup(format string) (Encoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := encoders[format]
+	return e, ok
+}
+
+// Formats returns sorted names of registered formats.
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	formats := make([]string, 0, len(encoders))
+	for f := range encoders {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Downmix mixes samples of from channels down to to channels, appending them
+// to dst. Mono is the mean of all channels. Stereo takes the mean of even
+// channels on the left and odd ones on the right, as in common L, R, C, LFE,
+// Ls, Rs layouts. Samples are returned as they are, if channel counts are the
+// same or to is not fewer.
+func Downmix(dst, samples []float64, from, to int) []float64 {
+	if to >= from || to <= 0 {
+		return samples
+	}
+	for off := 0; off+from <= len(samples); off += from {
+		frame := samples[off : off+from]
+		for c := 0; c < to; c++ {
+			var (
+				sum float64
+				n   int
+			)
+			for i := c; i < from; i += to {
+				sum += frame[i]
+				n++
+			}
+			dst = append(dst, sum/float64(n))
+		}
+	}
+	return dst
+}
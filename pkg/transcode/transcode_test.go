@@ -0,0 +1,135 @@
+package transcode
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sewiti/munit-backend/pkg/audio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sine(freq float64, rate, frames int) []float64 {
+	s := make([]float64, frames)
+	for i := range s {
+		s[i] = math.Sin(2 * math.Pi * freq * float64(i) / float64(rate))
+	}
+	return s
+}
+
+// resample resamples samples in blocks, as they are decoded.
+func resample(r *Resampler, samples []float64, block int) []float64 {
+	var out []float64
+	for off := 0; off < len(samples); off += block {
+		end := off + block
+		if end > len(samples) {
+			end = len(samples)
+		}
+		out = append(out, r.Write(samples[off:end])...)
+	}
+	return append(out, r.Flush()...)
+}
+
+func peak(samples []float64) float64 {
+	var p float64
+	for _, v := range samples {
+		p = math.Max(p, math.Abs(v))
+	}
+	return p
+}
+
+func TestResampler(t *testing.T) {
+	rs, err := NewResampler(48000, 22050, 1)
+	require.NoError(t, err)
+	in := sine(1000, 48000, 48000)
+	out := resample(rs, in, 4096)
+	require.Len(t, out, 22050)
+	assert.InDelta(t, 1, peak(out[1000:21000]), 0.01)
+	for i := 1000; i < 21000; i += 997 {
+		want := math.Sin(2 * math.Pi * 1000 * float64(i) / 22050)
+		assert.InDelta(t, want, out[i], 0.01)
+	}
+
+	// Above output Nyquist frequency, filtered out instead of aliased.
+	rs, err = NewResampler(48000, 22050, 1)
+	require.NoError(t, err)
+	out = resample(rs, sine(16000, 48000, 48000), 1000)
+	assert.Less(t, peak(out[1000:21000]), 0.01)
+
+	// Channels are kept apart.
+	stereo := make([]float64, 0, 2*48000)
+	for _, v := range in {
+		stereo = append(stereo, v, 0)
+	}
+	rs, err = NewResampler(48000, 24000, 2)
+	require.NoError(t, err)
+	out = resample(rs, stereo, 334)
+	require.Len(t, out, 2*24000)
+	left, right := make([]float64, 0, 24000), make([]float64, 0, 24000)
+	for i := 0; i < len(out); i += 2 {
+		left = append(left, out[i])
+		right = append(right, out[i+1])
+	}
+	assert.InDelta(t, 1, peak(left[1000:23000]), 0.01)
+	assert.Zero(t, peak(right))
+}
+
+func TestResamplerLimits(t *testing.T) {
+	_, err := NewResampler(4000000000, 22050, 2)
+	assert.Error(t, err)
+	_, err = NewResampler(768000, 10, 2)
+	assert.Error(t, err)
+	_, err = NewResampler(0, 22050, 2)
+	assert.Error(t, err)
+	_, err = NewResampler(768000, 8000, 2)
+	assert.NoError(t, err)
+}
+
+func TestDownmix(t *testing.T) {
+	surround := []float64{0.2, 0.4, 0.6, 0, 0.1, 0.3} // L, R, C, LFE, Ls, Rs
+	assert.InDeltaSlice(t, []float64{0.3, 0.7 / 3}, Downmix(nil, surround, 6, 2), 1e-9)
+	assert.InDeltaSlice(t, []float64{0.3, -0.5}, Downmix(nil, []float64{0.5, 0.1, -0.5, -0.5}, 2, 1), 1e-9)
+
+	stereo := []float64{0.5, 0.1}
+	assert.Equal(t, stereo, Downmix(nil, stereo, 2, 2))
+}
+
+func TestWAV(t *testing.T) {
+	e, ok := Lookup("wav")
+	require.True(t, ok)
+	assert.Equal(t, "audio/wav", e.ContentType())
+	assert.Contains(t, Formats(), "wav")
+
+	var buf bytes.Buffer
+	w, err := e.NewWriter(&buf, 22050, 2)
+	require.NoError(t, err)
+	require.NoError(t, w.Write([]float64{1, -1, 0, 2}))
+	require.NoError(t, w.Write(make([]float64, 2*22050-4)))
+	require.NoError(t, w.Close())
+
+	info, err := audio.Parse(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, &audio.Info{
+		Format:     "wav",
+		Codec:      audio.CodecPCM,
+		SampleRate: 22050,
+		BitDepth:   16,
+		Channels:   2,
+		Duration:   time.Second,
+	}, info)
+
+	var first []float64
+	_, err = audio.Decode(buf.Bytes(), func(samples []float64) error {
+		if first == nil {
+			first = append(first, samples[:4]...)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{1, -1, 0, 1}, first, 2.0/math.MaxInt16)
+
+	_, err = e.NewWriter(&buf, 0, 2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package transcode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const wavHeader = 44
+
+// WAV encodes 16-bit PCM WAV. Samples are dithered with triangular noise.
+var WAV Encoder = wavEncoder{}
+
+type wavEncoder struct{}
+
+func (wavEncoder) ContentType() string {
+	return "audio/wav"
+}
+
+func (wavEncoder) NewWriter(w io.Writer, rate, channels int) (SampleWriter, error) {
+	if rate <= 0 || channels <= 0 || channels > math.MaxUint16 {
+		return nil, errors.New("transcode: wav: invalid format")
+	}
+	return &wavWriter{w: w, rate: rate, channels: channels, seed: 1}, nil
+}
+
+// wavWriter buffers samples, as the header precedes them with their size.
+type wavWriter struct {
+	w        io.Writer
+	rate     int
+	channels int
+	data     bytes.Buffer
+	seed     uint32 // Dither noise state
+}
+
+func (w *wavWriter) Write(samples []float64) error {
+	var b [2]byte
+	for _, v := range samples {
+		v = v*math.MaxInt16 + w.noise() - w.noise()
+		v = math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v)))
+		binary.LittleEndian.PutUint16(b[:], uint16(int16(v)))
+		w.data.Write(b[:])
+	}
+	if w.data.Len() > math.MaxUint32-wavHeader {
+		return errors.New("transcode: wav: too long")
+	}
+	return nil
+}
+
+// noise returns uniform noise in [0, 1), from a xorshift generator.
+func (w *wavWriter) noise() float64 {
+	w.seed ^= w.seed << 13
+	w.seed ^= w.seed >> 17
+	w.seed ^= w.seed << 5
+	return float64(w.seed) / (1 << 32)
+}
+
+func (w *wavWriter) Close() error {
+	const bytesPerSample = 2
+	blockAlign := w.channels * bytesPerSample
+
+	h := make([]byte, wavHeader)
+	copy(h, "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(wavHeader-8+w.data.Len()))
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(w.rate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(w.rate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], 8*bytesPerSample)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(w.data.Len()))
+
+	if _, err := w.w.Write(h); err != nil {
+		return err
+	}
+	_, err := w.data.WriteTo(w.w)
+	return err
+}
@@ -0,0 +1,225 @@
+// Package waveform computes min/max peaks of audio for drawing waveforms.
+//
+// Peaks are encoded in BBC audiowaveform's binary (.dat, version 2) and JSON
+// formats, which are understood by common renderers such as peaks.js and
+// wavesurfer.js.
+package waveform
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrResolution is returned by Resample if resolution is not a multiple of
+// peaks' samples per pixel.
+var ErrResolution = errors.New("waveform: resolution must be a positive multiple of base resolution")
+
+const (
+	datVersion = 2
+	datHeader  = 24
+	flag8Bit   = 0x1
+)
+
+// Peaks are minimums and maximums of each channel over consecutive blocks of
+// SamplesPerPixel frames.
+type Peaks struct {
+	SampleRate      int
+	SamplesPerPixel int
+	Channels        int
+	Data            []int16 // For each pixel, min and max of each channel
+}
+
+// Length returns the number of pixels.
+func (p *Peaks) Length() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Data) / (2 * p.Channels)
+}
+
+// Resample merges pixels, so that each covers resolution samples, which must
+// be a multiple of p.SamplesPerPixel.
+func (p *Peaks) Resample(resolution int) (*Peaks, error) {
+	if resolution <= 0 || resolution%p.SamplesPerPixel != 0 {
+		return nil, ErrResolution
+	}
+	factor := resolution / p.SamplesPerPixel
+	if factor == 1 {
+		return p, nil
+	}
+
+	stride := 2 * p.Channels
+	length := (p.Length() + factor - 1) / factor
+	out := &Peaks{
+		SampleRate:      p.SampleRate,
+		SamplesPerPixel: resolution,
+		Channels:        p.Channels,
+		Data:            make([]int16, 0, length*stride),
+	}
+	for i := 0; i < p.Length(); i += factor {
+		px := append([]int16(nil), p.Data[i*stride:(i+1)*stride]...)
+		for j := i + 1; j < i+factor && j < p.Length(); j++ {
+			for k := 0; k < stride; k += 2 {
+				px[k] = min16(px[k], p.Data[j*stride+k])
+				px[k+1] = max16(px[k+1], p.Data[j*stride+k+1])
+			}
+		}
+		out.Data = append(out.Data, px...)
+	}
+	return out, nil
+}
+
+// MarshalBinary encodes peaks in audiowaveform's binary format with 16-bit
+// values.
+func (p *Peaks) MarshalBinary() ([]byte, error) {
+	b := make([]byte, datHeader+2*len(p.Data))
+	binary.LittleEndian.PutUint32(b, datVersion)
+	binary.LittleEndian.PutUint32(b[4:], 0) // 16-bit
+	binary.LittleEndian.PutUint32(b[8:], uint32(p.SampleRate))
+	binary.LittleEndian.PutUint32(b[12:], uint32(p.SamplesPerPixel))
+	binary.LittleEndian.PutUint32(b[16:], uint32(p.Length()))
+	binary.LittleEndian.PutUint32(b[20:], uint32(p.Channels))
+	for i, v := range p.Data {
+		binary.LittleEndian.PutUint16(b[datHeader+2*i:], uint16(v))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes peaks in audiowaveform's binary format. 8-bit values
+// are scaled to 16 bits.
+func (p *Peaks) UnmarshalBinary(b []byte) error {
+	if len(b) < datHeader {
+		return errors.New("waveform: data is too short")
+	}
+	if v := binary.LittleEndian.Uint32(b); v != datVersion {
+		return fmt.Errorf("waveform: unsupported version %d", v)
+	}
+	flags := binary.LittleEndian.Uint32(b[4:])
+	p.SampleRate = int(binary.LittleEndian.Uint32(b[8:]))
+	p.SamplesPerPixel = int(binary.LittleEndian.Uint32(b[12:]))
+	length := int(binary.LittleEndian.Uint32(b[16:]))
+	p.Channels = int(binary.LittleEndian.Uint32(b[20:]))
+	if p.SamplesPerPixel <= 0 || p.Channels <= 0 {
+		return errors.New("waveform: invalid header")
+	}
+
+	n := length * 2 * p.Channels
+	values := b[datHeader:]
+	if flags&flag8Bit != 0 {
+		if len(values) < n {
+			return errors.New("waveform: data is truncated")
+		}
+		p.Data = make([]int16, n)
+		for i := range p.Data {
+			p.Data[i] = int16(int8(values[i])) << 8
+		}
+		return nil
+	}
+	if len(values) < 2*n {
+		return errors.New("waveform: data is truncated")
+	}
+	p.Data = make([]int16, n)
+	for i := range p.Data {
+		p.Data[i] = int16(binary.LittleEndian.Uint16(values[2*i:]))
+	}
+	return nil
+}
+
+// MarshalJSON encodes peaks in audiowaveform's JSON format with 16-bit values.
+func (p *Peaks) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version         int     `json:"version"`
+		Channels        int     `json:"channels"`
+		SampleRate      int     `json:"sample_rate"`
+		SamplesPerPixel int     `json:"samples_per_pixel"`
+		Bits            int     `json:"bits"`
+		Length          int     `json:"length"`
+		Data            []int16 `json:"data"`
+	}{datVersion, p.Channels, p.SampleRate, p.SamplesPerPixel, 16, p.Length(), p.Data})
+}
+
+// Builder computes peaks from samples.
+type Builder struct {
+	peaks *Peaks
+	px    []int16 // Current pixel
+	n     int     // Frames in current pixel
+}
+
+// NewBuilder returns a Builder of peaks with given samples per pixel.
+func NewBuilder(sampleRate, channels, samplesPerPixel int) *Builder {
+	b := &Builder{
+		peaks: &Peaks{
+			SampleRate:      sampleRate,
+			SamplesPerPixel: samplesPerPixel,
+			Channels:        channels,
+			Data:            make([]int16, 0),
+		},
+		px: make([]int16, 2*channels),
+	}
+	b.reset()
+	return b
+}
+
+func (b *Builder) reset() {
+	for i := 0; i < len(b.px); i += 2 {
+		b.px[i] = math.MaxInt16
+		b.px[i+1] = math.MinInt16
+	}
+	b.n = 0
+}
+
+// Write adds samples interleaved by channel and scaled to [-1, 1]. Samples of
+// an incomplete frame are ignored.
+func (b *Builder) Write(samples []float64) error {
+	channels := b.peaks.Channels
+	for i := 0; i+channels <= len(samples); i += channels {
+		for ch := 0; ch < channels; ch++ {
+			v := scale(samples[i+ch])
+			b.px[2*ch] = min16(b.px[2*ch], v)
+			b.px[2*ch+1] = max16(b.px[2*ch+1], v)
+		}
+		b.n++
+		if b.n == b.peaks.SamplesPerPixel {
+			b.peaks.Data = append(b.peaks.Data, b.px...)
+			b.reset()
+		}
+	}
+	return nil
+}
+
+// Peaks returns the peaks, including the last incomplete pixel.
+func (b *Builder) Peaks() *Peaks {
+	if b.n > 0 {
+		b.peaks.Data = append(b.peaks.Data, b.px...)
+		b.reset()
+	}
+	return b.peaks
+}
+
+func scale(v float64) int16 {
+	v = math.Round(v * 32768)
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func min16(a, b int16) int16 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max16(a, b int16) int16 {
+	if a > b {
+		return a
+	}
+	return b
+}
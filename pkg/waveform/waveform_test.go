@@ -0,0 +1,79 @@
+package waveform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(44100, 2, 2)
+	// Frames: (0.5, -0.5), (-1, 1), (0.25, 0)
+	require.NoError(t, b.Write([]float64{0.5, -0.5, -1, 1}))
+	require.NoError(t, b.Write([]float64{0.25, 0, 1})) // trailing incomplete frame
+
+	p := b.Peaks()
+	assert.Equal(t, 2, p.Length())
+	assert.Equal(t, []int16{
+		-32768, 16384, -16384, 32767, // pixel 0: ch0 min/max, ch1 min/max
+		8192, 8192, 0, 0, // pixel 1, incomplete
+	}, p.Data)
+}
+
+func TestResample(t *testing.T) {
+	p := &Peaks{
+		SampleRate:      48000,
+		SamplesPerPixel: 256,
+		Channels:        1,
+		Data:            []int16{-1, 1, -5, 2, -3, 7},
+	}
+
+	r, err := p.Resample(512)
+	require.NoError(t, err)
+	assert.Equal(t, 512, r.SamplesPerPixel)
+	assert.Equal(t, []int16{-5, 2, -3, 7}, r.Data)
+
+	r, err = p.Resample(256 * 8)
+	require.NoError(t, err)
+	assert.Equal(t, []int16{-5, 7}, r.Data)
+
+	_, err = p.Resample(300)
+	assert.ErrorIs(t, err, ErrResolution)
+	_, err = p.Resample(0)
+	assert.ErrorIs(t, err, ErrResolution)
+}
+
+func TestBinary(t *testing.T) {
+	p := &Peaks{
+		SampleRate:      44100,
+		SamplesPerPixel: 512,
+		Channels:        2,
+		Data:            []int16{-100, 100, -32768, 32767},
+	}
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	assert.Len(t, b, 24+8)
+
+	var got Peaks
+	require.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, p, &got)
+
+	assert.Error(t, got.UnmarshalBinary(b[:len(b)-1]))
+}
+
+func TestJSON(t *testing.T) {
+	p := &Peaks{SampleRate: 8000, SamplesPerPixel: 256, Channels: 1, Data: []int16{-1, 2}}
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": 2,
+		"channels": 1,
+		"sample_rate": 8000,
+		"samples_per_pixel": 256,
+		"bits": 16,
+		"length": 1,
+		"data": [-1, 2]
+	}`, string(b))
+}